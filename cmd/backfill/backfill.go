@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bybit_connector/pkg/market"
+	"bybit_connector/pkg/recorder"
+	"bybit_connector/pkg/rest"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// backfill pages through the market data endpoints of one symbol
+type backfill struct {
+	client   *rest.Client
+	writer   *recorder.Writer
+	dir      string
+	category market.Category
+	symbol   string
+	start    time.Time
+	end      time.Time
+
+	// stored holds the keys of the records of the pending window that are
+	// already on disk, which are not written again
+	stored map[string]bool
+}
+
+// progress is the saved state of one kind
+type progress struct {
+	// Done are the sorted, disjoint spans whose records are on disk
+	Done []span `json:"done"`
+	// Pending is the window being written. When a run stops before
+	// saving it, its records may be partly on disk.
+	Pending *span `json:"pending,omitempty"`
+}
+
+// span is the time range [Start, End)
+type span struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// add marks a span as done, merging it with the spans it touches
+func (p *progress) add(s span) {
+	var merged []span
+	for _, d := range p.Done {
+		switch {
+		case d.End.Before(s.Start):
+			merged = append(merged, d)
+		case s.End.Before(d.Start):
+			merged = append(merged, s)
+			s = d
+		default:
+			if d.Start.Before(s.Start) {
+				s.Start = d.Start
+			}
+			if d.End.After(s.End) {
+				s.End = d.End
+			}
+		}
+	}
+	p.Done = append(merged, s)
+}
+
+// gaps returns the parts of [start, end) that are not done
+func (p *progress) gaps(start, end time.Time) []span {
+	var gaps []span
+	for _, d := range p.Done {
+		if !d.End.After(start) {
+			continue
+		}
+		if !d.Start.Before(end) {
+			break
+		}
+		if d.Start.After(start) {
+			gaps = append(gaps, span{start, d.Start})
+		}
+		start = d.End
+	}
+	if start.Before(end) {
+		gaps = append(gaps, span{start, end})
+	}
+	return gaps
+}
+
+// covers reports whether t lies within a done span
+func (p *progress) covers(t time.Time) bool {
+	for _, d := range p.Done {
+		if !t.Before(d.Start) && t.Before(d.End) {
+			return true
+		}
+	}
+	return false
+}
+
+// klines stores closed exchange klines, 1000 per request
+func (b *backfill) klines(ctx context.Context, interval string) error {
+	d, err := market.KlineInterval(interval)
+	if err != nil {
+		return err
+	}
+	kind := recorder.KlineKind(interval)
+	return b.page(ctx, kind, 1000*d, func(from, to time.Time) (int, error) {
+		candles, err := b.client.GetKlines(ctx, b.category, b.symbol, interval, from, to.Add(-time.Millisecond), 1000)
+		if err != nil {
+			return 0, err
+		}
+		n := 0
+		for _, c := range candles {
+			if !c.Closed || c.Start.Before(from) || !c.Start.Before(to) {
+				continue
+			}
+			if err := b.write(kind, c.Start, c); err != nil {
+				return n, err
+			}
+			n++
+		}
+		return n, nil
+	})
+}
+
+// funding stores settled funding rates. Windows of 200 hours hold at most
+// the 200 rates a request returns, even at hourly funding.
+func (b *backfill) funding(ctx context.Context) error {
+	if b.category != market.CategoryLinear && b.category != market.CategoryInverse {
+		return fmt.Errorf("funding history is only available for linear and inverse contracts")
+	}
+	return b.page(ctx, recorder.KindFunding, 200*time.Hour, func(from, to time.Time) (int, error) {
+		rates, err := b.client.GetFundingHistory(ctx, b.category, b.symbol, from, to.Add(-time.Millisecond), 200)
+		if err != nil {
+			return 0, err
+		}
+		n := 0
+		for _, r := range rates {
+			if r.Time.Before(from) || !r.Time.Before(to) {
+				continue
+			}
+			if err := b.write(recorder.KindFunding, r.Time, r); err != nil {
+				return n, err
+			}
+			n++
+		}
+		return n, nil
+	})
+}
+
+// openInterest stores open interest samples, 200 per window
+func (b *backfill) openInterest(ctx context.Context, interval string) error {
+	d, ok := rest.OpenInterestIntervals[interval]
+	if !ok {
+		return fmt.Errorf("invalid open interest interval %q", interval)
+	}
+	kind := recorder.OpenInterestKind(interval)
+	return b.page(ctx, kind, 200*d, func(from, to time.Time) (int, error) {
+		values, err := b.client.GetOpenInterest(ctx, b.category, b.symbol, interval, from, to.Add(-time.Millisecond))
+		if err != nil {
+			return 0, err
+		}
+		n := 0
+		for _, v := range values {
+			if v.Time.Before(from) || !v.Time.Before(to) {
+				continue
+			}
+			if err := b.write(kind, v.Time, v); err != nil {
+				return n, err
+			}
+			n++
+		}
+		return n, nil
+	})
+}
+
+// trades stores public trades. /v5/market/recent-trade has no time range:
+// it only serves the latest 1000 trades (60 for spot), so older trades in
+// the range cannot be recovered and a gap is logged.
+func (b *backfill) trades(ctx context.Context) error {
+	p, err := b.resume(recorder.KindTrades)
+	if err != nil {
+		return err
+	}
+	trades, err := b.client.GetRecentTrades(ctx, b.category, b.symbol, 1000)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(trades, func(i, j int) bool { return trades[i].Time.Before(trades[j].Time) })
+
+	var fresh []market.Trade
+	for _, t := range trades {
+		if !t.Time.Before(b.start) && t.Time.Before(b.end) && !p.covers(t.Time) {
+			fresh = append(fresh, t)
+		}
+	}
+	if gaps := p.gaps(b.start, b.end); len(fresh) > 0 && len(gaps) > 0 && fresh[0].Time.After(gaps[0].Start) {
+		log.Printf("%s trades: history before %s is not available from the REST API", b.symbol, fresh[0].Time.UTC().Format(time.RFC3339))
+	}
+	if len(fresh) == 0 {
+		log.Printf("%s trades: 0 stored", b.symbol)
+		return nil
+	}
+
+	n, err := b.window(recorder.KindTrades, &p, span{fresh[0].Time, fresh[len(fresh)-1].Time.Add(time.Millisecond)}, func() (int, error) {
+		n := 0
+		for _, t := range fresh {
+			if err := b.write(recorder.KindTrades, t.Time, t); err != nil {
+				return n, err
+			}
+			n++
+		}
+		return n, nil
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("%s trades: %d stored", b.symbol, n)
+	return nil
+}
+
+// page calls fetch over consecutive [from, to) windows of the parts of the
+// range that are not done yet. Records of an earlier part of the range are
+// appended after those already stored.
+func (b *backfill) page(ctx context.Context, kind string, window time.Duration, fetch func(from, to time.Time) (int, error)) error {
+	p, err := b.resume(kind)
+	if err != nil {
+		return err
+	}
+
+	total := 0
+	for _, gap := range p.gaps(b.start, b.end) {
+		if gap.Start.After(b.start) {
+			log.Printf("%s %s: resuming from %s", b.symbol, kind, gap.Start.UTC().Format(time.RFC3339))
+		}
+		for from := gap.Start; from.Before(gap.End); {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			to := from.Add(window)
+			if to.After(gap.End) {
+				to = gap.End
+			}
+			n, err := b.window(kind, &p, span{from, to}, func() (int, error) { return fetch(from, to) })
+			if err != nil {
+				return fmt.Errorf("%s %s from %s: %w", b.symbol, kind, from.UTC().Format(time.RFC3339), err)
+			}
+			total += n
+			from = to
+		}
+	}
+	log.Printf("%s %s: %d stored", b.symbol, kind, total)
+	return nil
+}
+
+// window writes the records of one span with write. The span is saved as
+// pending first and as done once its records are on disk, so that a run
+// stopping in between skips the records it already wrote when resumed.
+func (b *backfill) window(kind string, p *progress, s span, write func() (int, error)) (int, error) {
+	p.Pending = &s
+	if err := b.save(kind, *p); err != nil {
+		return 0, err
+	}
+	n, err := write()
+	if err != nil {
+		return n, err
+	}
+	if err := b.writer.Flush(); err != nil {
+		return n, err
+	}
+	p.add(s)
+	p.Pending = nil
+	b.stored = nil
+	return n, b.save(kind, *p)
+}
+
+// write stores a record unless it is already on disk
+func (b *backfill) write(kind string, t time.Time, v interface{}) error {
+	if b.stored[recordKey(t, v)] {
+		return nil
+	}
+	return b.writer.Write(b.category, b.symbol, kind, t, v)
+}
+
+// recordKey identifies a record: trades by ID, other kinds by their time
+func recordKey(t time.Time, v interface{}) string {
+	if trade, ok := v.(market.Trade); ok && trade.TradeId != "" {
+		return "trade:" + trade.TradeId
+	}
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// resume loads the progress of a kind and the keys of the records of its
+// pending window that are already on disk
+func (b *backfill) resume(kind string) (progress, error) {
+	p := b.load(kind)
+	b.stored = nil
+	if p.Pending == nil {
+		return p, nil
+	}
+
+	b.stored = make(map[string]bool)
+	for _, path := range recorder.Files(b.dir, b.category, b.symbol, kind, p.Pending.Start, p.Pending.End) {
+		err := recorder.ReadFile(path, func(line []byte) error {
+			var r struct {
+				Start   time.Time `json:"start"`
+				Time    time.Time `json:"time"`
+				TradeID string    `json:"trade_id"`
+			}
+			if err := json.Unmarshal(line, &r); err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			t := r.Time
+			if !r.Start.IsZero() {
+				t = r.Start
+			}
+			if !t.Before(p.Pending.Start) && t.Before(p.Pending.End) {
+				b.stored[recordKey(t, market.Trade{TradeId: r.TradeID})] = true
+			}
+			return nil
+		})
+		if err != nil {
+			return p, err
+		}
+	}
+	return p, nil
+}
+
+// statePath returns the progress file of a kind
+func (b *backfill) statePath(kind string) string {
+	return filepath.Join(b.dir, ".backfill", fmt.Sprintf("%s-%s-%s.json", b.category, b.symbol, kind))
+}
+
+// load returns the saved progress of a kind, empty if there is none
+func (b *backfill) load(kind string) progress {
+	var p progress
+	raw, err := os.ReadFile(b.statePath(kind))
+	if err != nil {
+		return p
+	}
+	if err := json.Unmarshal(raw, &p); err != nil {
+		log.Printf("Ignoring corrupt progress file %s: %v", b.statePath(kind), err)
+		return progress{}
+	}
+	return p
+}
+
+// save writes the progress of a kind atomically
+func (b *backfill) save(kind string, p progress) error {
+	path := b.statePath(kind)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to save progress: %w", err)
+	}
+	raw, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("failed to save progress: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o644); err != nil {
+		return fmt.Errorf("failed to save progress: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to save progress: %w", err)
+	}
+	return nil
+}
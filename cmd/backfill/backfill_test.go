@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bybit_connector/internal/config"
+	"bybit_connector/pkg/market"
+	"bybit_connector/pkg/recorder"
+	"bybit_connector/pkg/rest"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var day = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// klineServer serves minute klines of any range and records the start of
+// every request
+type klineServer struct {
+	*httptest.Server
+	mu     sync.Mutex
+	starts []time.Time
+}
+
+func newKlineServer(t *testing.T) *klineServer {
+	s := &klineServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start, _ := strconv.ParseInt(r.URL.Query().Get("start"), 10, 64)
+		end, _ := strconv.ParseInt(r.URL.Query().Get("end"), 10, 64)
+		s.mu.Lock()
+		s.starts = append(s.starts, time.UnixMilli(start).UTC())
+		s.mu.Unlock()
+
+		var list []string
+		for ms := start; ms <= end; ms += time.Minute.Milliseconds() {
+			list = append([]string{fmt.Sprintf(`["%d","1","2","0.5","1.5","10","15"]`, ms)}, list...)
+		}
+		fmt.Fprintf(w, `{"retCode":0,"retMsg":"OK","result":{"symbol":"BTCUSDT","list":[%s]},"time":1}`, strings.Join(list, ","))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// requests returns the starts of the requests so far and resets them
+func (s *klineServer) requests() []time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	starts := s.starts
+	s.starts = nil
+	return starts
+}
+
+// run backfills minute klines of [start, end) into dir
+func run(t *testing.T, server *klineServer, dir string, start, end time.Time) {
+	t.Helper()
+	writer := recorder.NewWriter(dir)
+	b := &backfill{
+		client:   rest.NewClient(&config.Config{BybitRESTBaseURL: server.URL}),
+		writer:   writer,
+		dir:      dir,
+		category: market.CategoryLinear,
+		symbol:   "BTCUSDT",
+		start:    start,
+		end:      end,
+	}
+	if err := b.klines(context.Background(), "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// stored returns the candle starts on disk, failing on duplicates
+func stored(t *testing.T, dir string) []time.Time {
+	t.Helper()
+	var starts []time.Time
+	seen := make(map[time.Time]bool)
+	for _, path := range recorder.Files(dir, market.CategoryLinear, "BTCUSDT", recorder.KlineKind("1"), day, day.Add(time.Hour)) {
+		err := recorder.ReadFile(path, func(line []byte) error {
+			var c market.Candle
+			if err := json.Unmarshal(line, &c); err != nil {
+				return err
+			}
+			if seen[c.Start] {
+				t.Errorf("duplicate candle %s", c.Start)
+			}
+			seen[c.Start] = true
+			starts = append(starts, c.Start)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return starts
+}
+
+func TestBackfillResume(t *testing.T) {
+	server, dir := newKlineServer(t), t.TempDir()
+
+	run(t, server, dir, day, day.Add(10*time.Minute))
+	if n := len(stored(t, dir)); n != 10 {
+		t.Fatalf("expected 10 candles, got %d", n)
+	}
+	server.requests()
+
+	// Extending the range fetches only the missing part
+	run(t, server, dir, day, day.Add(20*time.Minute))
+	if starts := server.requests(); len(starts) != 1 || !starts[0].Equal(day.Add(10*time.Minute)) {
+		t.Fatalf("expected one request from 00:10, got %v", starts)
+	}
+	if n := len(stored(t, dir)); n != 20 {
+		t.Fatalf("expected 20 candles, got %d", n)
+	}
+
+	// A finished range fetches nothing
+	run(t, server, dir, day.Add(5*time.Minute), day.Add(15*time.Minute))
+	if starts := server.requests(); len(starts) != 0 {
+		t.Fatalf("expected no requests, got %v", starts)
+	}
+}
+
+func TestBackfillEarlierStart(t *testing.T) {
+	server, dir := newKlineServer(t), t.TempDir()
+
+	run(t, server, dir, day.Add(10*time.Minute), day.Add(20*time.Minute))
+	server.requests()
+
+	run(t, server, dir, day, day.Add(30*time.Minute))
+	starts := server.requests()
+	if len(starts) != 2 || !starts[0].Equal(day) || !starts[1].Equal(day.Add(20*time.Minute)) {
+		t.Fatalf("expected requests from 00:00 and 00:20, got %v", starts)
+	}
+	if n := len(stored(t, dir)); n != 30 {
+		t.Fatalf("expected 30 candles, got %d", n)
+	}
+}
+
+func TestBackfillPendingWindowNoDuplicates(t *testing.T) {
+	server, dir := newKlineServer(t), t.TempDir()
+
+	// A run that stopped after writing part of its window
+	writer := recorder.NewWriter(dir)
+	kind := recorder.KlineKind("1")
+	for i := 0; i < 4; i++ {
+		start := day.Add(time.Duration(i) * time.Minute)
+		if err := writer.Write(market.CategoryLinear, "BTCUSDT", kind, start, market.Candle{Symbol: "BTCUSDT", Start: start}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b := &backfill{dir: dir, category: market.CategoryLinear, symbol: "BTCUSDT"}
+	if err := b.save(kind, progress{Pending: &span{day, day.Add(10 * time.Minute)}}); err != nil {
+		t.Fatal(err)
+	}
+
+	run(t, server, dir, day, day.Add(10*time.Minute))
+	if n := len(stored(t, dir)); n != 10 {
+		t.Fatalf("expected 10 candles, got %d", n)
+	}
+	if p := b.load(kind); p.Pending != nil || len(p.Done) != 1 || !p.Done[0].Start.Equal(day) || !p.Done[0].End.Equal(day.Add(10*time.Minute)) {
+		t.Fatalf("unexpected progress: %+v", p)
+	}
+}
+
+func TestProgressSpans(t *testing.T) {
+	var p progress
+	p.add(span{day.Add(20 * time.Minute), day.Add(30 * time.Minute)})
+	p.add(span{day, day.Add(5 * time.Minute)})
+	p.add(span{day.Add(5 * time.Minute), day.Add(10 * time.Minute)})
+	if len(p.Done) != 2 || !p.Done[0].End.Equal(day.Add(10*time.Minute)) || !p.Done[1].Start.Equal(day.Add(20*time.Minute)) {
+		t.Fatalf("unexpected spans: %+v", p.Done)
+	}
+
+	gaps := p.gaps(day.Add(-time.Minute), day.Add(40*time.Minute))
+	want := []span{{day.Add(-time.Minute), day}, {day.Add(10 * time.Minute), day.Add(20 * time.Minute)}, {day.Add(30 * time.Minute), day.Add(40 * time.Minute)}}
+	if len(gaps) != len(want) {
+		t.Fatalf("expected gaps %v, got %v", want, gaps)
+	}
+	for i := range want {
+		if !gaps[i].Start.Equal(want[i].Start) || !gaps[i].End.Equal(want[i].End) {
+			t.Fatalf("expected gaps %v, got %v", want, gaps)
+		}
+	}
+	if !p.covers(day.Add(25*time.Minute)) || p.covers(day.Add(10*time.Minute)) {
+		t.Fatal("unexpected coverage")
+	}
+}
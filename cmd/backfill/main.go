@@ -0,0 +1,106 @@
+// Command backfill downloads historical klines, trades, funding rates and
+// open interest of a symbol into the recorder's storage layout. It saves
+// the spans it has stored after every page, and a later run fetches only
+// the parts of its range that are missing.
+package main
+
+import (
+	"bybit_connector/internal/config"
+	"bybit_connector/pkg/market"
+	"bybit_connector/pkg/recorder"
+	"bybit_connector/pkg/rest"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+func main() {
+	symbol := flag.String("symbol", "BTCUSDT", "symbol to backfill")
+	categoryFlag := flag.String("category", "linear", "spot, linear, inverse or option")
+	startFlag := flag.String("start", "", "start of the range, 2006-01-02 or RFC 3339 (required)")
+	endFlag := flag.String("end", "", "end of the range, 2006-01-02 or RFC 3339 (default now)")
+	kinds := flag.String("kinds", "klines,trades,funding,oi", "comma separated data kinds")
+	interval := flag.String("interval", "1", "kline interval")
+	oiInterval := flag.String("oi-interval", "5min", "open interest interval: 5min, 15min, 30min, 1h, 4h or 1d")
+	dir := flag.String("dir", "data", "storage directory")
+	flag.Parse()
+
+	category, err := market.ParseCategory(*categoryFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *startFlag == "" {
+		log.Fatal("-start is required")
+	}
+	start, err := parseTime(*startFlag)
+	if err != nil {
+		log.Fatalf("invalid -start: %v", err)
+	}
+	end := time.Now()
+	if *endFlag != "" {
+		if end, err = parseTime(*endFlag); err != nil {
+			log.Fatalf("invalid -end: %v", err)
+		}
+	}
+	if now := time.Now(); end.After(now) {
+		end = now
+	}
+	if !start.Before(end) {
+		log.Fatal("-start must be before -end")
+	}
+
+	conf, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	writer := recorder.NewWriter(*dir)
+	defer writer.Close()
+
+	b := &backfill{
+		client:   rest.NewClient(conf),
+		writer:   writer,
+		dir:      *dir,
+		category: category,
+		symbol:   *symbol,
+		start:    start,
+		end:      end,
+	}
+
+	for _, kind := range strings.Split(*kinds, ",") {
+		switch strings.TrimSpace(kind) {
+		case "klines":
+			err = b.klines(ctx, *interval)
+		case "trades":
+			err = b.trades(ctx)
+		case "funding":
+			err = b.funding(ctx)
+		case "oi":
+			err = b.openInterest(ctx, *oiInterval)
+		default:
+			err = fmt.Errorf("unknown kind %q", kind)
+		}
+		if err != nil {
+			writer.Close()
+			log.Fatalf("Backfill failed: %v", err)
+		}
+	}
+	log.Println("Backfill complete")
+}
+
+// parseTime accepts a date or an RFC 3339 timestamp, in UTC
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
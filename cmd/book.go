@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bybit_connector/pkg/market"
+	"flag"
+	"os"
+	"strconv"
+	"time"
+)
+
+// bookColumns are the text and CSV columns of a book level
+var bookColumns = []string{"time", "symbol", "level", "bid_size", "bid", "ask", "ask_size"}
+
+// bookView is the top of a book as printed in JSON
+type bookView struct {
+	Symbol string        `json:"symbol"`
+	Time   time.Time     `json:"time"`
+	Spread float64       `json:"spread"`
+	Mid    float64       `json:"mid"`
+	Bids   []market.Item `json:"bids"`
+	Asks   []market.Item `json:"asks"`
+}
+
+func runBook(args []string) error {
+	var o options
+	fs := newFlagSet("book", &o)
+	o.liveFlags(fs)
+	levels := fs.Int("levels", 10, "levels per side to print")
+	interval := fs.Duration("interval", time.Second, "print interval, or refresh interval of the ladder")
+	tui := fs.Bool("tui", false, "show a live depth ladder with a trade tape instead of printing")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	intervalSet := false
+	fs.Visit(func(f *flag.Flag) { intervalSet = intervalSet || f.Name == "interval" })
+	conf, err := o.load()
+	if err != nil {
+		return err
+	}
+	out, err := newOutput(o.format, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	s, err := startSession(ctx, &o, conf, nil)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	if *tui {
+		refresh := *interval
+		if !intervalSet {
+			refresh = 250 * time.Millisecond
+		}
+		return runTUI(ctx, s, *levels, refresh)
+	}
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		for _, sym := range s.symbols() {
+			book := s.handler.GetOrderBook(sym.Symbol)
+			if book == nil || (len(book.Bids) == 0 && len(book.Asks) == 0) {
+				continue
+			}
+			printBook(out, sym.Symbol, book, *levels)
+		}
+	}
+}
+
+// printBook prints the top levels of a book: one object in JSON, one row
+// per level in text and CSV
+func printBook(out *output, symbol string, book *market.OrderBook, levels int) {
+	bids, asks := top(book.Bids, levels), top(book.Asks, levels)
+	view := bookView{Symbol: symbol, Time: book.Timestamp, Bids: bids, Asks: asks}
+	if len(bids) > 0 && len(asks) > 0 {
+		view.Spread = asks[0].Price - bids[0].Price
+		view.Mid = (asks[0].Price + bids[0].Price) / 2
+	}
+	if out.format == "json" {
+		out.row(view, nil)
+		return
+	}
+
+	for i := 0; i < len(bids) || i < len(asks); i++ {
+		v := []string{stamp(book.Timestamp), symbol, strconv.Itoa(i + 1), "", "", "", ""}
+		if i < len(bids) {
+			v[3], v[4] = num(bids[i].Amount), num(bids[i].Price)
+		}
+		if i < len(asks) {
+			v[5], v[6] = num(asks[i].Price), num(asks[i].Amount)
+		}
+		out.row(nil, bookColumns, v...)
+	}
+	out.separator()
+}
+
+func top(items []market.Item, n int) []market.Item {
+	if n > 0 && len(items) > n {
+		return items[:n]
+	}
+	return items
+}
@@ -0,0 +1,38 @@
+// Command keystore encrypts a JSON secrets file into a keystore for the
+// "keystore:<path>" secrets provider. The passphrase is read from
+// BYBIT_KEYSTORE_PASSPHRASE.
+//
+//	keystore -in secrets.json -out keys.json && rm secrets.json
+package main
+
+import (
+	"bybit_connector/internal/config"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+)
+
+func main() {
+	in := flag.String("in", "", "plaintext secrets file: {\"default\": {\"api_key\": ..., \"api_secret\": ...}}")
+	out := flag.String("out", "keystore.json", "keystore to write")
+	flag.Parse()
+
+	passphrase := os.Getenv("BYBIT_KEYSTORE_PASSPHRASE")
+	if *in == "" || passphrase == "" {
+		log.Fatal("usage: BYBIT_KEYSTORE_PASSPHRASE=... keystore -in secrets.json [-out keystore.json]")
+	}
+
+	data, err := os.ReadFile(*in)
+	if err != nil {
+		log.Fatalf("Failed to read secrets: %v", err)
+	}
+	var accounts map[string]config.Credentials
+	if err := json.Unmarshal(data, &accounts); err != nil {
+		log.Fatalf("Invalid secrets file: %v", err)
+	}
+	if err := config.WriteKeystore(*out, passphrase, accounts); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Wrote %d accounts to %s", len(accounts), *out)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bybit_connector/internal/config"
+	"bybit_connector/pkg/logging"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// logLevel follows log_level across config reloads
+var logLevel slog.LevelVar
+
+// logOutput is where records are written, switched while the TUI owns the screen
+var logOutput = &switchWriter{w: os.Stderr}
+
+// switchWriter forwards writes to a writer that can be replaced
+type switchWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *switchWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
+
+func (s *switchWriter) set(w io.Writer) {
+	s.mu.Lock()
+	s.w = w
+	s.mu.Unlock()
+}
+
+// setupLogging installs the logger of conf as the default one, which the
+// log package writes through as well
+func setupLogging(conf *config.Config) error {
+	level, err := logging.ParseLevel(conf.LogLevel)
+	if err != nil {
+		return err
+	}
+	logLevel.Set(level)
+	logger, err := logging.New(logOutput, conf.LogFormat, &logLevel)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+	return nil
+}
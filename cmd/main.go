@@ -1,146 +1,59 @@
-// cmd/main.go
+// Command main is the connector's command line. Each subcommand takes the
+// common flags -config, -profile, -symbols, -category, -depth and -format.
 package main
 
 import (
-	"bybit_connector/handler"
-	"bybit_connector/internal/config"
-	"bybit_connector/pkg/market"
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
-	"os/signal"
-	"strconv"
-	"syscall"
-	"time"
+	"sort"
 )
 
-func main() {
-	// Load environment variables
-	if err := godotenv.Load(); err != nil {
-		log.Printf("Warning: .env file not found or cannot be loaded: %v", err)
-	}
-
-	// Initialize configuration
-	cfg := &config.Config{
-		WebSocketURL:   getEnvWithDefault("TESTNET_MODE", "false") == "true",
-			"wss://stream-testnet.bybit.com/v5/public/spot" : 
-			"wss://stream.bybit.com/v5/public/spot",
-		Symbol:         getEnvWithDefault("SYMBOL", "BTCUSDT"),
-		APIKey:         os.Getenv("API_KEY"),
-		APISecret:      os.Getenv("API_SECRET"),
-		HeartbeatTimer: getDurationEnv("HEARTBEAT_INTERVAL", 20),
-		ReconnectTimer: getDurationEnv("RECONNECT_INTERVAL", 5),
-		OrderBookDepth: getIntEnv("ORDERBOOK_DEPTH", 25),
-	}
-
-	// Initialize order book
-	orderBook := market.NewOrderBookLocal()
-	
-	// Create WebSocket handler
-	wsHandler := handler.NewWebSocketHandler(orderBook)
-	
-	// Create WebSocket client
-	wsClient, err := socket.NewWebSocketClient(cfg.WebSocketURL, wsHandler)
-	if err != nil {
-		log.Fatalf("Failed to create WebSocket client: %v", err)
-	}
-
-	// Connect to WebSocket
-	if err := wsClient.Connect(); err != nil {
-		log.Fatalf("Failed to connect to WebSocket: %v", err)
-	}
-	defer wsClient.Disconnect()
-
-	// Subscribe to orderbook
-	if err := wsClient.SubscribeToOrderbook(cfg.Symbol); err != nil {
-		log.Fatalf("Failed to subscribe to orderbook: %v", err)
-	}
-
-	// Monitor connection status and handle reconnection
-	go monitorConnection(wsClient, cfg)
-
-	// Setup ticker to print orderbook status periodically
-	go monitorOrderbook(orderBook)
-
-	// Wait for termination signal
-	signalChan := make(chan os.Signal, 1)
-	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
-	<-signalChan
-
-	log.Println("Shutting down...")
+// commands are the subcommands by name
+var commands = map[string]struct {
+	run  func(args []string) error
+	help string
+}{
+	"stream": {runStream, "subscribe and print trades and best bid/offer updates"},
+	"book":   {runBook, "print the top of the local order books periodically"},
+	"record": {runRecord, "record trades, tickers and order book snapshots to disk"},
+	"replay": {runReplay, "print recorded data, optionally at the original pace"},
+	"status": {runStatus, "show exchange time, tickers, rate limits and balances"},
+	"orders": {runOrders, "list open orders or the order history"},
 }
 
-// monitorConnection checks connection status and reconnects if needed
-func monitorConnection(wsClient *socket.WebSocketClient, cfg *config.Config) {
-	ticker := time.NewTicker(cfg.ReconnectTimer * time.Second)
-	defer ticker.Stop()
-	
-	for range ticker.C {
-		if !wsClient.IsConnected() {
-			log.Println("WebSocket disconnected, attempting to reconnect...")
-			if err := wsClient.Connect(); err != nil {
-				log.Printf("Failed to reconnect: %v", err)
-			} else {
-				// Resubscribe on reconnection
-				if err := wsClient.SubscribeToOrderbook(cfg.Symbol); err != nil {
-					log.Printf("Failed to resubscribe to orderbook: %v", err)
-				} else {
-					log.Println("Successfully reconnected and resubscribed")
-				}
-			}
-		}
+func main() {
+	log.SetOutput(os.Stderr)
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
 	}
-}
 
-// monitorOrderbook periodically prints the state of the order book
-func monitorOrderbook(orderBook market.OrderBookLocal) {
-	ticker := time.NewTicker(30 * time.Second)
-	defer ticker.Stop()
-	
-	for range ticker.C {
-		ob := &market.OrderBook{
-			Bids: []market.Item{},
-			Asks: []market.Item{},
-		}
-		ticker := &market.Ticker{}
-		orderBook.GetOrderBook(ob, ticker)
-		
-		if len(ob.Bids) > 0 && len(ob.Asks) > 0 {
-			fmt.Printf("[%s] Current Orderbook - Top Bid: %.2f (%.6f), Top Ask: %.2f (%.6f), Spread: %.2f\n", 
-				time.Now().Format("15:04:05"),
-				ticker.Bid, ticker.BidSize, 
-				ticker.Ask, ticker.AskSize,
-				ticker.Ask - ticker.Bid)
-		} else {
-			log.Println("Orderbook is empty")
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		if os.Args[1] != "help" && os.Args[1] != "-h" && os.Args[1] != "--help" {
+			fmt.Fprintf(os.Stderr, "unknown command %q\n\n", os.Args[1])
 		}
+		usage()
+		os.Exit(2)
 	}
-}
-
-// Helper functions for environment variables
-func getEnvWithDefault(key, defaultValue string) string {
-	value := os.Getenv(key)
-	if value == "" {
-		return defaultValue
+	if err := cmd.run(os.Args[2:]); err != nil {
+		slog.Error("Command failed", "command", os.Args[1], "error", err)
+		os.Exit(1)
 	}
-	return value
 }
 
-func getIntEnv(key string, defaultValue int) int {
-	strValue := os.Getenv(key)
-	if strValue == "" {
-		return defaultValue
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
 	}
-	
-	value, err := strconv.Atoi(strValue)
-	if err != nil {
-		log.Printf("Warning: Invalid value for %s, using default: %v", key, err)
-		return defaultValue
+	sort.Strings(names)
+
+	fmt.Fprintf(os.Stderr, "usage: %s <command> [flags]\n\ncommands:\n", os.Args[0])
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", name, commands[name].help)
 	}
-	
-	return value
+	fmt.Fprintf(os.Stderr, "\nRun %s <command> -h for the flags of a command.\n", os.Args[0])
 }
-
-func getDurationEnv(key string, defaultValue int) time.Duration {
-	return time.Duration(getIntEnv(key, defaultValue)) * time.Second
-}
\ No newline at end of file
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bybit_connector/internal/config"
+	"bybit_connector/pkg/market"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/subosito/gotenv"
+)
+
+// options are the flags shared by every subcommand
+type options struct {
+	configPath string
+	profile    string
+	symbols    string
+	category   string
+	depth      int
+	format     string
+	httpAddr   string
+	grpcAddr   string
+	grpcTrade  bool
+}
+
+// newFlagSet creates the flag set of a subcommand with the common flags
+func newFlagSet(name string, o *options) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(&o.configPath, "config", os.Getenv("BYBIT_CONFIG"), "TOML, YAML or JSON config file")
+	fs.StringVar(&o.profile, "profile", os.Getenv("BYBIT_PROFILE"), "config profile: mainnet, testnet, demo or a profile of the file")
+	fs.StringVar(&o.symbols, "symbols", "", "comma separated symbols, replacing those of the config")
+	fs.StringVar(&o.category, "category", "", "category of -symbols: spot, linear, inverse or option")
+	fs.IntVar(&o.depth, "depth", 0, "order book depth of -symbols")
+	fs.StringVar(&o.format, "format", "text", "output format: text, json or csv")
+	return fs
+}
+
+// liveFlags adds the flags of subcommands keeping a live session
+func (o *options) liveFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.httpAddr, "http", "", "serve the HTTP API and the WebSocket gateway on this address, e.g. :8080")
+	fs.StringVar(&o.grpcAddr, "grpc", "", "serve the gRPC market data API on this address, e.g. 127.0.0.1:9090")
+	fs.BoolVar(&o.grpcTrade, "grpc-trading", false, "also serve the gRPC trading API, authenticated with the BYBIT_GRPC_TOKEN bearer token")
+}
+
+// load builds the configuration and applies the symbol flags
+func (o *options) load() (*config.Config, error) {
+	if err := gotenv.Load(); err != nil && !os.IsNotExist(err) {
+		slog.Warn("Failed to load .env", "error", err)
+	}
+	conf, err := config.Load(o.configPath, o.profile)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.symbols != "" {
+		category := conf.Category
+		if o.category != "" {
+			if category, err = market.ParseCategory(o.category); err != nil {
+				return nil, err
+			}
+		}
+		depth := o.depth
+		if depth == 0 {
+			depth = 50
+		}
+		conf.Symbols = nil
+		for _, s := range strings.Split(o.symbols, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				conf.Symbols = append(conf.Symbols, config.SymbolConfig{Symbol: strings.ToUpper(s), Category: category, Depth: depth})
+			}
+		}
+		if err := conf.Validate(); err != nil {
+			return nil, err
+		}
+	} else if o.category != "" || o.depth != 0 {
+		return nil, fmt.Errorf("-category and -depth apply to -symbols")
+	}
+	if err := setupLogging(conf); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// watchConfig reports whether the symbol set follows the config file
+func (o *options) watchConfig() bool {
+	return o.configPath != "" && o.symbols == ""
+}
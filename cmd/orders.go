@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bybit_connector/pkg/market"
+	"bybit_connector/pkg/rest"
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// orderColumns are the text and CSV columns of an order
+var orderColumns = []string{"time", "symbol", "order_id", "link_id", "side", "type", "price", "qty", "leaves_qty", "status"}
+
+func runOrders(args []string) error {
+	var o options
+	fs := newFlagSet("orders", &o)
+	history := fs.Bool("history", false, "list the order history instead of open orders")
+	limit := fs.Int("limit", 50, "orders per symbol of the history")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	conf, err := o.load()
+	if err != nil {
+		return err
+	}
+	out, err := newOutput(o.format, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	creds, err := conf.Credentials(conf.Account)
+	if err != nil {
+		return err
+	}
+	if creds.APIKey == "" || creds.APISecret == "" {
+		return fmt.Errorf("orders require API credentials")
+	}
+	client := rest.NewClient(conf)
+	client.SetCredentials(creds.APIKey, creds.APISecret)
+
+	ctx, stop := signalContext()
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	// Without symbols, all orders of the default category are listed
+	type query struct {
+		category market.Category
+		symbol   string
+	}
+	queries := []query{{category: conf.Category}}
+	if len(conf.Symbols) > 0 {
+		queries = queries[:0]
+		for _, sym := range conf.Symbols {
+			queries = append(queries, query{sym.Category, sym.Symbol})
+		}
+	}
+
+	for _, q := range queries {
+		var orders []market.Order
+		if *history {
+			orders, err = client.GetOrderHistory(ctx, q.category, q.symbol, *limit)
+		} else {
+			orders, err = client.GetOpenOrders(ctx, q.category, q.symbol)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to list %s orders of %s: %w", q.category, q.symbol, err)
+		}
+		for _, ord := range orders {
+			out.row(ord, orderColumns, stamp(ord.Timestamp), ord.Symbol, ord.OrderID, ord.OrderLinkID, ord.Side, ord.OrderType,
+				num(ord.Price), num(ord.Qty), num(ord.LeavesQty), ord.OrderStatus)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// output prints records as aligned text, JSON lines or CSV. It is safe
+// for use from several goroutines.
+type output struct {
+	format  string
+	w       io.Writer
+	csv     *csv.Writer
+	mu      sync.Mutex
+	columns []string
+}
+
+func newOutput(format string, w io.Writer) (*output, error) {
+	switch format {
+	case "text", "json", "csv":
+	default:
+		return nil, fmt.Errorf("format must be text, json or csv, got %q", format)
+	}
+	return &output{format: format, w: w, csv: csv.NewWriter(w)}, nil
+}
+
+// row prints a record: v as JSON, or the values of columns as text or
+// CSV. A header is printed whenever the columns change.
+func (o *output) row(v interface{}, columns []string, values ...string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.format == "json" {
+		line, err := json.Marshal(v)
+		if err != nil {
+			return
+		}
+		o.w.Write(append(line, '\n'))
+		return
+	}
+
+	if !equalStrings(o.columns, columns) {
+		o.columns = columns
+		o.write(columns, true)
+	}
+	o.write(values, false)
+}
+
+// separator prints a blank line between groups of text rows
+func (o *output) separator() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.format == "text" {
+		fmt.Fprintln(o.w)
+	}
+}
+
+func (o *output) write(values []string, header bool) {
+	if o.format == "csv" {
+		o.csv.Write(values)
+		o.csv.Flush()
+		return
+	}
+	var b strings.Builder
+	for i, v := range values {
+		if header {
+			v = strings.ToUpper(v)
+		}
+		if i < len(values)-1 {
+			width := 14
+			if i < len(o.columns) && strings.Contains(o.columns[i], "time") {
+				width = 24
+			}
+			fmt.Fprintf(&b, "%-*s ", width, v)
+		} else {
+			b.WriteString(v)
+		}
+	}
+	fmt.Fprintln(o.w, b.String())
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// num formats a number without exponent or trailing zeros
+func num(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// stamp formats a time in UTC with milliseconds
+func stamp(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
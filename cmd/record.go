@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bybit_connector/handler"
+	"bybit_connector/pkg/market"
+	"bybit_connector/pkg/recorder"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// recordColumns are the text and CSV columns of the progress report
+var recordColumns = []string{"time", "symbol", "trades", "tickers", "books"}
+
+// recordCounts are the records written for a symbol since the last report
+type recordCounts struct {
+	Time    time.Time `json:"time"`
+	Symbol  string    `json:"symbol"`
+	Trades  int       `json:"trades"`
+	Tickers int       `json:"tickers"`
+	Books   int       `json:"books"`
+}
+
+func runRecord(args []string) error {
+	var o options
+	fs := newFlagSet("record", &o)
+	o.liveFlags(fs)
+	dir := fs.String("dir", "data", "storage directory")
+	snapshotInterval := fs.Duration("snapshot-interval", time.Minute, "order book snapshot interval, 0 disables snapshots")
+	levels := fs.Int("levels", 0, "levels per side of order book snapshots, 0 keeps all")
+	report := fs.Duration("report", time.Minute, "progress report interval, 0 disables reports")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	conf, err := o.load()
+	if err != nil {
+		return err
+	}
+	out, err := newOutput(o.format, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	writer := recorder.NewWriter(*dir)
+	defer writer.Close()
+
+	var (
+		mu     sync.Mutex
+		counts = make(map[string]*recordCounts)
+		s      *session
+	)
+	write := func(symbol, kind string, t time.Time, v interface{}) {
+		category, ok := s.category(symbol)
+		if !ok {
+			return
+		}
+		if err := writer.Write(category, symbol, kind, t, v); err != nil {
+			slog.Error("Failed to record", "symbol", symbol, "kind", kind, "error", err)
+			return
+		}
+		mu.Lock()
+		c, ok := counts[symbol]
+		if !ok {
+			c = &recordCounts{Symbol: symbol}
+			counts[symbol] = c
+		}
+		switch kind {
+		case recorder.KindTrades:
+			c.Trades++
+		case recorder.KindTickers:
+			c.Tickers++
+		case recorder.KindOrderBook:
+			c.Books++
+		}
+		mu.Unlock()
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	// Messages may arrive before startSession returns
+	ready := make(chan struct{})
+	s, err = startSession(ctx, &o, conf, func(h *handler.WebSocketHandler) {
+		h.BBOIncludeTickers = true
+		h.OnTrade = func(t market.Trade) {
+			<-ready
+			write(t.Symbol, recorder.KindTrades, t.Time, t)
+		}
+		h.OnBBO = func(t market.Ticker) {
+			if t.Derived {
+				return
+			}
+			<-ready
+			write(t.Symbol, recorder.KindTickers, t.Time, t)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	close(ready)
+	defer s.close()
+	slog.Info("Recording", "symbols", len(conf.Symbols), "dir", *dir)
+
+	flush := time.NewTicker(time.Second)
+	defer flush.Stop()
+	snapshots := newTicker(*snapshotInterval)
+	defer snapshots.Stop()
+	reports := newTicker(*report)
+	defer reports.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return writer.Flush()
+		case <-flush.C:
+			if err := writer.Flush(); err != nil {
+				return err
+			}
+		case <-snapshots.C:
+			for _, sym := range s.symbols() {
+				book := s.handler.GetOrderBook(sym.Symbol)
+				if book == nil || book.Timestamp.IsZero() {
+					continue
+				}
+				book.Bids, book.Asks = top(book.Bids, *levels), top(book.Asks, *levels)
+				write(sym.Symbol, recorder.KindOrderBook, book.Timestamp, book)
+			}
+		case now := <-reports.C:
+			mu.Lock()
+			for _, sym := range s.symbols() {
+				c := recordCounts{Symbol: sym.Symbol}
+				if counted, ok := counts[sym.Symbol]; ok {
+					c = *counted
+				}
+				c.Time = now
+				out.row(c, recordColumns, stamp(c.Time), c.Symbol, strconv.Itoa(c.Trades), strconv.Itoa(c.Tickers), strconv.Itoa(c.Books))
+			}
+			counts = make(map[string]*recordCounts)
+			mu.Unlock()
+		}
+	}
+}
+
+// newTicker returns a ticker of interval, or one that never fires when
+// interval is not positive
+func newTicker(interval time.Duration) *time.Ticker {
+	if interval <= 0 {
+		t := time.NewTicker(time.Hour)
+		t.Stop()
+		return t
+	}
+	return time.NewTicker(interval)
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bybit_connector/pkg/market"
+	"bybit_connector/pkg/recorder"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// replayColumns are the text and CSV columns of each recorded kind. Kinds
+// not listed print their top-level fields in name order.
+var replayColumns = map[string][]string{
+	recorder.KindTrades:  {"time", "symbol", "side", "price", "size", "trade_id"},
+	recorder.KindTickers: {"time", "symbol", "bid", "bid_size", "ask", "ask_size", "last_price"},
+	recorder.KindFunding: {"time", "symbol", "rate"},
+}
+
+// replayRecord is one recorded line with the time it is ordered by
+type replayRecord struct {
+	time   time.Time
+	symbol string
+	line   json.RawMessage
+}
+
+func runReplay(args []string) error {
+	var o options
+	fs := newFlagSet("replay", &o)
+	dir := fs.String("dir", "data", "storage directory")
+	kind := fs.String("kind", recorder.KindTrades, "recorded kind: trades, tickers, orderbook, funding, kline_<interval> or open_interest_<interval>")
+	startFlag := fs.String("start", "", "start of the range, 2006-01-02 or RFC 3339 (default today)")
+	endFlag := fs.String("end", "", "end of the range, 2006-01-02 or RFC 3339 (default now)")
+	speed := fs.Float64("speed", 0, "replay speed relative to the recorded pace, 0 prints as fast as possible")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	conf, err := o.load()
+	if err != nil {
+		return err
+	}
+	out, err := newOutput(o.format, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	end := time.Now().UTC()
+	if *endFlag != "" {
+		if end, err = parseTime(*endFlag); err != nil {
+			return fmt.Errorf("invalid -end: %w", err)
+		}
+	}
+	start := end.Truncate(24 * time.Hour)
+	if *startFlag != "" {
+		if start, err = parseTime(*startFlag); err != nil {
+			return fmt.Errorf("invalid -start: %w", err)
+		}
+	}
+	if start.After(end) {
+		return fmt.Errorf("-start must be before -end")
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	// Records are merged across symbols one day at a time
+	var (
+		first time.Time
+		began = time.Now()
+	)
+	for day := start.Truncate(24 * time.Hour); !day.After(end); day = day.Add(24 * time.Hour) {
+		var records []replayRecord
+		for _, sym := range conf.Symbols {
+			next := day.Add(24*time.Hour - time.Nanosecond)
+			for _, path := range recorder.Files(*dir, sym.Category, sym.Symbol, *kind, day, next) {
+				err := recorder.ReadFile(path, func(line []byte) error {
+					t, err := recordTime(line)
+					if err != nil {
+						return fmt.Errorf("%s: %w", path, err)
+					}
+					if !t.Before(start) && !t.After(end) {
+						records = append(records, replayRecord{time: t, symbol: sym.Symbol, line: append(json.RawMessage(nil), line...)})
+					}
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+		sort.SliceStable(records, func(i, j int) bool { return records[i].time.Before(records[j].time) })
+
+		for _, r := range records {
+			if *speed > 0 {
+				if first.IsZero() {
+					first = r.time
+				}
+				wait := time.Duration(float64(r.time.Sub(first))/(*speed)) - time.Since(began)
+				if err := sleep(ctx, wait); err != nil {
+					return nil
+				}
+			} else if ctx.Err() != nil {
+				return nil
+			}
+			if err := printRecord(out, *kind, r); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// recordTime extracts the time of a recorded line. Order books carry a
+// timestamp and klines a start instead of a time.
+func recordTime(line []byte) (time.Time, error) {
+	var r struct {
+		Time      time.Time `json:"time"`
+		Timestamp time.Time `json:"timestamp"`
+		Start     time.Time `json:"start"`
+	}
+	if err := json.Unmarshal(line, &r); err != nil {
+		return time.Time{}, err
+	}
+	switch {
+	case !r.Time.IsZero():
+		return r.Time, nil
+	case !r.Timestamp.IsZero():
+		return r.Timestamp, nil
+	default:
+		return r.Start, nil
+	}
+}
+
+// printRecord prints a line as recorded in JSON, and its scalar fields in
+// text and CSV. Order books print their best bid and offer.
+func printRecord(out *output, kind string, r replayRecord) error {
+	if out.format == "json" {
+		out.row(r.line, nil)
+		return nil
+	}
+
+	if kind == recorder.KindOrderBook {
+		var book market.OrderBook
+		if err := json.Unmarshal(r.line, &book); err != nil {
+			return err
+		}
+		v := []string{stamp(r.time), r.symbol, "", "", "", ""}
+		if len(book.Bids) > 0 {
+			v[2], v[3] = num(book.Bids[0].Price), num(book.Bids[0].Amount)
+		}
+		if len(book.Asks) > 0 {
+			v[4], v[5] = num(book.Asks[0].Price), num(book.Asks[0].Amount)
+		}
+		out.row(nil, []string{"time", "symbol", "bid", "bid_size", "ask", "ask_size"}, v...)
+		return nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(r.line, &fields); err != nil {
+		return err
+	}
+	if _, ok := fields["symbol"]; !ok {
+		fields["symbol"] = r.symbol
+	}
+	columns, ok := replayColumns[kind]
+	if !ok {
+		for name, v := range fields {
+			switch v.(type) {
+			case map[string]interface{}, []interface{}:
+			default:
+				columns = append(columns, name)
+			}
+		}
+		sort.Strings(columns)
+	}
+
+	values := make([]string, len(columns))
+	for i, name := range columns {
+		switch v := fields[name].(type) {
+		case nil:
+		case float64:
+			values[i] = num(v)
+		case string:
+			if t, err := time.Parse(time.RFC3339Nano, v); err == nil && strings.Contains(v, "T") {
+				values[i] = stamp(t)
+			} else {
+				values[i] = v
+			}
+		default:
+			values[i] = fmt.Sprint(v)
+		}
+	}
+	out.row(nil, columns, values...)
+	return nil
+}
+
+// parseTime accepts a date or an RFC 3339 timestamp, in UTC
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
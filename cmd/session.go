@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bybit_connector/handler"
+	"bybit_connector/internal/config"
+	"bybit_connector/internal/grpcapi"
+	"bybit_connector/internal/server"
+	"bybit_connector/internal/socket"
+	"bybit_connector/pkg/logging"
+	"bybit_connector/pkg/market"
+	"bybit_connector/pkg/metrics"
+	"bybit_connector/pkg/rest"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// session is a live connection to the public streams of the configured
+// symbols, feeding one handler
+type session struct {
+	handler *handler.WebSocketHandler
+	streams *socket.Streams
+	rest    *rest.Client
+	conf    atomic.Pointer[config.Config]
+	// gateway re-broadcasts the handler's data when the HTTP API is enabled
+	gateway *server.Gateway
+	// service serves the handler's data when the gRPC API is enabled
+	service *grpcapi.Service
+	// metrics are recorded when the HTTP API is enabled and served on /metrics
+	metrics *metrics.Connector
+	// clock estimates the offset of the local clock from the exchange's
+	clock *market.ClockSkew
+
+	// messages counts the received messages, last is the UnixNano time of
+	// the latest one
+	messages atomic.Int64
+	last     atomic.Int64
+}
+
+// startSession subscribes the symbols of conf. setup is called before the
+// first message so that it can install the handler's callbacks. When the
+// symbols come from a config file, the file is watched and the streams
+// follow its changes until ctx is done.
+func startSession(ctx context.Context, o *options, conf *config.Config, setup func(h *handler.WebSocketHandler)) (*session, error) {
+	if len(conf.Symbols) == 0 {
+		return nil, fmt.Errorf("no symbols configured, use -symbols or the config file")
+	}
+	token := os.Getenv("BYBIT_GRPC_TOKEN")
+	if o.grpcTrade && (o.grpcAddr == "" || token == "") {
+		return nil, fmt.Errorf("-grpc-trading requires -grpc and BYBIT_GRPC_TOKEN")
+	}
+
+	s := &session{handler: handler.NewWebSocketHandler(), rest: rest.NewClient(conf), clock: market.NewClockSkew()}
+	s.conf.Store(conf)
+	s.handler.Logger = slog.Default()
+	s.handler.Parser.Logger = slog.Default()
+	s.handler.Parser.Clock = s.clock
+	s.handler.SnapshotFetcher = s.fetchSnapshot
+	s.handler.OnCascade = func(e market.CascadeEvent) {
+		slog.Warn("Liquidation cascade", "symbol", e.Symbol, "side", e.Side, "window", e.Window,
+			"count", e.Count, "notional", e.Notional, "ratio", e.Ratio, "threshold", e.Threshold)
+	}
+	if setup != nil {
+		setup(s.handler)
+	}
+
+	s.streams = socket.NewStreams(conf, s.handleMessage, func(err error) {
+		slog.Warn("Stream error", "error", err)
+	})
+	s.streams.Logger = slog.Default()
+	s.handler.Resubscribe = s.streams.ResubscribeBook
+	if o.httpAddr != "" {
+		s.metrics = metrics.NewConnector()
+		s.handler.Metrics = s.metrics
+		s.handler.Parser.Metrics = s.metrics
+		s.streams.Metrics = s.metrics
+	}
+	if o.httpAddr != "" {
+		s.gateway = server.NewGateway(s.streams)
+		s.gateway.Attach(s.handler)
+	}
+	if o.grpcAddr != "" {
+		s.service = grpcapi.NewService(s.handler, s.streams)
+		s.service.Trading, s.service.Token = o.grpcTrade, token
+		s.service.Attach(s.handler)
+		// The ticker streams serve the exchange tickers too
+		s.handler.BBOIncludeTickers = true
+	}
+	if err := s.streams.Apply(conf.Symbols, nil); err != nil {
+		s.streams.Close()
+		return nil, err
+	}
+	for _, sym := range conf.Symbols {
+		s.handler.Bootstrap(sym.Symbol)
+	}
+	go s.syncClock(ctx)
+	go s.handler.RunCandleClock(ctx)
+
+	if o.httpAddr != "" {
+		srv := server.New(s.handler, s.streams)
+		srv.LastMessage = s.lastMessage
+		srv.Handle("GET /ws", s.gateway)
+		srv.Handle("GET /metrics", s.metrics)
+		go func() {
+			if err := srv.ListenAndServe(ctx, o.httpAddr); err != nil {
+				slog.Error("HTTP API stopped", "error", err)
+			}
+		}()
+		slog.Info("Serving the HTTP API, the WebSocket gateway (/ws) and metrics (/metrics)", "addr", o.httpAddr)
+	}
+	if o.grpcTrade {
+		if !loopback(o.grpcAddr) {
+			slog.Warn("The gRPC trading API is served without TLS beyond the loopback interface", "addr", o.grpcAddr)
+		}
+		if creds, err := conf.Credentials(conf.Account); err != nil {
+			slog.Warn("gRPC order entry disabled", "error", err)
+		} else if creds.APIKey != "" && creds.APISecret != "" {
+			client := rest.NewClient(conf)
+			client.SetCredentials(creds.APIKey, creds.APISecret)
+			s.service.REST = client
+		}
+	}
+	if o.grpcAddr != "" {
+		go func() {
+			if err := s.service.ListenAndServe(ctx, o.grpcAddr); err != nil {
+				slog.Error("gRPC API stopped", "error", err)
+			}
+		}()
+		slog.Info("Serving the gRPC API", "addr", o.grpcAddr, "trading", s.service.Trading, "order_entry", s.service.REST != nil)
+	}
+
+	if o.watchConfig() {
+		w := config.NewWatcher(o.configPath, o.profile, conf)
+		w.OnReload = s.reload
+		w.OnError = func(err error) { slog.Error("Config reload failed", "error", err) }
+		go w.Run(ctx)
+	}
+	return s, nil
+}
+
+// clockSyncInterval is the time between server time requests
+const clockSyncInterval = 30 * time.Second
+
+// maxClockOffset is the offset beyond the measurement uncertainty at which
+// the local clock is reported as off
+const maxClockOffset = time.Second
+
+// syncClock measures the clock offset with server time requests until ctx
+// is done, and records the estimate in the metrics
+func (s *session) syncClock(ctx context.Context) {
+	ticker := time.NewTicker(clockSyncInterval)
+	defer ticker.Stop()
+	for {
+		sent := time.Now()
+		server, err := s.rest.GetServerTime(ctx)
+		if err == nil {
+			s.clock.ObserveServerTime(sent, server, time.Now())
+		} else if ctx.Err() == nil {
+			slog.Warn("Server time request failed", "error", err)
+		}
+
+		skew := s.clock.Estimate(time.Now())
+		s.metrics.ClockSkew(skew)
+		if skew.Synced {
+			slog.Debug("Clock skew", "offset", skew.Offset, "uncertainty", skew.Uncertainty, "latency", skew.Latency())
+			if off := skew.Offset; off-skew.Uncertainty > maxClockOffset || -off-skew.Uncertainty > maxClockOffset {
+				slog.Warn("Local clock is off from the exchange's", "offset", off, "uncertainty", skew.Uncertainty)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *session) handleMessage(message []byte) {
+	received := time.Now()
+	s.messages.Add(1)
+	s.last.Store(received.UnixNano())
+	s.handler.HandleMessageAt(message, received)
+}
+
+// lastMessage returns the time of the latest message, zero before the first
+func (s *session) lastMessage() time.Time {
+	if last := s.last.Load(); last != 0 {
+		return time.Unix(0, last)
+	}
+	return time.Time{}
+}
+
+// reload follows a change of the symbol set. The watcher keeps the
+// settings that need a restart and reports them.
+func (s *session) reload(old, new *config.Config) {
+	if level, err := logging.ParseLevel(new.LogLevel); err == nil {
+		logLevel.Set(level)
+	}
+	s.conf.Store(new)
+	dropped, err := s.streams.Reconcile(old, new)
+	if err != nil {
+		slog.Error("Failed to apply symbol changes", "error", err)
+	}
+	for _, sym := range dropped {
+		s.handler.Forget(sym.Symbol)
+		if s.gateway != nil {
+			s.gateway.Forget(sym.Symbol)
+		}
+	}
+	added, _ := config.DiffSymbols(old.Symbols, new.Symbols)
+	for _, sym := range added {
+		s.handler.Bootstrap(sym.Symbol)
+	}
+}
+
+// symbols returns the currently tracked symbols
+func (s *session) symbols() []config.SymbolConfig {
+	return s.conf.Load().Symbols
+}
+
+// fetchSnapshot reseeds a book from REST at the depth it is streamed with
+func (s *session) fetchSnapshot(ctx context.Context, symbol string) (*market.OrderBook, int64, error) {
+	for _, sym := range s.symbols() {
+		if sym.Symbol == symbol {
+			return s.rest.SnapshotFetcher(sym.Category, sym.Depth)(ctx, symbol)
+		}
+	}
+	return nil, 0, fmt.Errorf("symbol %s is not tracked", symbol)
+}
+
+func (s *session) close() {
+	s.streams.Close()
+}
+
+// signalContext is cancelled on SIGINT or SIGTERM
+func signalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+// category returns the category a symbol is streamed from
+func (s *session) category(symbol string) (market.Category, bool) {
+	for _, sym := range s.symbols() {
+		if sym.Symbol == symbol {
+			return sym.Category, true
+		}
+	}
+	return "", false
+}
+
+// loopback reports whether addr only listens on the loopback interface
+func loopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bybit_connector/internal/config"
+	"bybit_connector/pkg/ratelimit"
+	"bybit_connector/pkg/rest"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// statusReport is the status as printed in JSON
+type statusReport struct {
+	Environment string               `json:"environment"`
+	Region      string               `json:"region,omitempty"`
+	Profile     string               `json:"profile,omitempty"`
+	RESTBaseURL string               `json:"rest_base_url"`
+	ServerTime  time.Time            `json:"server_time"`
+	ClockSkew   float64              `json:"clock_skew_ms"`
+	Tickers     []statusTicker       `json:"tickers"`
+	Wallets     []rest.WalletBalance `json:"wallets,omitempty"`
+	RateLimits  []ratelimit.Status   `json:"rate_limits"`
+}
+
+type statusTicker struct {
+	Symbol    string  `json:"symbol"`
+	Category  string  `json:"category"`
+	Bid       float64 `json:"bid"`
+	Ask       float64 `json:"ask"`
+	LastPrice float64 `json:"last_price"`
+	Error     string  `json:"error,omitempty"`
+}
+
+func runStatus(args []string) error {
+	var o options
+	fs := newFlagSet("status", &o)
+	account := fs.String("account-type", "UNIFIED", "wallet account type, shown when credentials are configured")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	conf, err := o.load()
+	if err != nil {
+		return err
+	}
+	out, err := newOutput(o.format, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	client := rest.NewClient(conf)
+	endpoints := conf.Endpoints()
+	report := statusReport{
+		Environment: endpoints.Environment,
+		Region:      endpoints.Region,
+		Profile:     conf.Profile,
+		RESTBaseURL: endpoints.REST(),
+	}
+
+	// The skew is measured against the midpoint of the request
+	sent := time.Now()
+	serverTime, err := client.GetServerTime(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to reach %s: %w", report.RESTBaseURL, err)
+	}
+	rtt := time.Since(sent)
+	report.ServerTime = serverTime
+	report.ClockSkew = float64(sent.Add(rtt/2).Sub(serverTime)) / float64(time.Millisecond)
+
+	for _, sym := range conf.Symbols {
+		t := statusTicker{Symbol: sym.Symbol, Category: string(sym.Category)}
+		tickers, err := client.GetTickers(ctx, sym.Category, sym.Symbol)
+		switch {
+		case err != nil:
+			t.Error = err.Error()
+		case len(tickers) == 0:
+			t.Error = "no ticker"
+		default:
+			t.Bid, t.Ask, t.LastPrice = tickers[0].Bid, tickers[0].Ask, tickers[0].LastPrice
+		}
+		report.Tickers = append(report.Tickers, t)
+	}
+
+	if creds, err := conf.Credentials(conf.Account); err == nil && creds.APIKey != "" {
+		client.SetCredentials(creds.APIKey, creds.APISecret)
+		if report.Wallets, err = client.GetWalletBalance(ctx, *account); err != nil {
+			return fmt.Errorf("failed to fetch the wallet balance: %w", err)
+		}
+	}
+	report.RateLimits = client.Limiter.Status()
+
+	if out.format == "json" {
+		out.row(report, nil)
+		return nil
+	}
+	printStatus(out, conf, report, rtt)
+	return nil
+}
+
+// printStatus prints the report as sections of rows
+func printStatus(out *output, conf *config.Config, r statusReport, rtt time.Duration) {
+	columns := []string{"key", "value"}
+	out.row(nil, columns, "config", conf.String())
+	out.row(nil, columns, "rest", r.RESTBaseURL)
+	out.row(nil, columns, "server_time", stamp(r.ServerTime))
+	out.row(nil, columns, "clock_skew_ms", strconv.FormatFloat(r.ClockSkew, 'f', 1, 64))
+	out.row(nil, columns, "round_trip", rtt.Round(time.Millisecond).String())
+	out.separator()
+
+	columns = []string{"symbol", "category", "bid", "ask", "last_price", "error"}
+	for _, t := range r.Tickers {
+		out.row(nil, columns, t.Symbol, t.Category, num(t.Bid), num(t.Ask), num(t.LastPrice), t.Error)
+	}
+	out.separator()
+
+	columns = []string{"account_type", "coin", "equity", "wallet_balance", "available"}
+	for _, w := range r.Wallets {
+		out.row(nil, columns, w.AccountType, "total", num(w.TotalEquity), num(w.TotalWalletBalance), num(w.TotalAvailableBalance))
+		for _, c := range w.Coins {
+			out.row(nil, columns, w.AccountType, c.Coin, num(c.Equity), num(c.WalletBalance), num(c.AvailableToWithdraw))
+		}
+	}
+	if len(r.Wallets) > 0 {
+		out.separator()
+	}
+
+	columns = []string{"rate_limit", "per_second", "burst", "remaining", "queued", "blocked_until"}
+	for _, s := range r.RateLimits {
+		blocked := ""
+		if !s.BlockedUntil.IsZero() {
+			blocked = stamp(s.BlockedUntil)
+		}
+		out.row(nil, columns, s.Group, num(s.PerSecond), strconv.Itoa(s.Burst), num(s.Remaining), strconv.Itoa(s.Queued), blocked)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bybit_connector/handler"
+	"bybit_connector/pkg/market"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// streamColumns are the text and CSV columns of every stream event
+var streamColumns = []string{"time", "type", "symbol", "side", "price", "size", "bid", "bid_size", "ask", "ask_size"}
+
+// streamEvent is one printed trade, liquidation, best bid/offer or ticker update
+type streamEvent struct {
+	Type    string    `json:"type"`
+	Time    time.Time `json:"time"`
+	Symbol  string    `json:"symbol"`
+	Side    string    `json:"side,omitempty"`
+	Price   float64   `json:"price,omitempty"`
+	Size    float64   `json:"size,omitempty"`
+	Bid     float64   `json:"bid,omitempty"`
+	BidSize float64   `json:"bid_size,omitempty"`
+	Ask     float64   `json:"ask,omitempty"`
+	AskSize float64   `json:"ask_size,omitempty"`
+}
+
+func (e streamEvent) values() []string {
+	v := []string{stamp(e.Time), e.Type, e.Symbol, e.Side, "", "", "", "", "", ""}
+	if e.Type == "trade" || e.Type == "liquidation" {
+		v[4], v[5] = num(e.Price), num(e.Size)
+	} else {
+		v[6], v[7], v[8], v[9] = num(e.Bid), num(e.BidSize), num(e.Ask), num(e.AskSize)
+	}
+	return v
+}
+
+func runStream(args []string) error {
+	var o options
+	fs := newFlagSet("stream", &o)
+	o.liveFlags(fs)
+	events := fs.String("events", "trades,bbo", "comma separated events: trades, liquidations, bbo (from the local book) and tickers")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	conf, err := o.load()
+	if err != nil {
+		return err
+	}
+	out, err := newOutput(o.format, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	enabled := make(map[string]bool)
+	for _, e := range strings.Split(*events, ",") {
+		switch e = strings.TrimSpace(e); e {
+		case "trades", "liquidations", "bbo", "tickers":
+			enabled[e] = true
+		default:
+			return fmt.Errorf("unknown event %q", e)
+		}
+	}
+
+	print := func(e streamEvent) { out.row(e, streamColumns, e.values()...) }
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	s, err := startSession(ctx, &o, conf, func(h *handler.WebSocketHandler) {
+		if enabled["trades"] {
+			h.OnTrade = func(t market.Trade) {
+				print(streamEvent{Type: "trade", Time: t.Time, Symbol: t.Symbol, Side: t.Side, Price: t.Price, Size: t.Size})
+			}
+		}
+		if enabled["liquidations"] {
+			h.OnLiquidation = func(l market.Liquidation) {
+				print(streamEvent{Type: "liquidation", Time: l.Time, Symbol: l.Symbol, Side: l.Side, Price: l.Price, Size: l.Size})
+			}
+		}
+		if enabled["bbo"] || enabled["tickers"] {
+			h.BBOIncludeTickers = enabled["tickers"]
+			h.OnBBO = func(t market.Ticker) {
+				typ := "ticker"
+				if t.Derived {
+					if !enabled["bbo"] {
+						return
+					}
+					typ = "bbo"
+				}
+				print(streamEvent{Type: typ, Time: t.Time, Symbol: t.Symbol, Bid: t.Bid, BidSize: t.BidSize, Ask: t.Ask, AskSize: t.AskSize})
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	<-ctx.Done()
+	return nil
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bybit_connector/pkg/market"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ANSI escape sequences used by the ladder
+const (
+	escClearLine = "\x1b[K"
+	escClearDown = "\x1b[J"
+	escHome      = "\x1b[H"
+	escRed       = "\x1b[31m"
+	escGreen     = "\x1b[32m"
+	escYellow    = "\x1b[33m"
+	escDim       = "\x1b[2m"
+	escBold      = "\x1b[1m"
+	escReset     = "\x1b[0m"
+)
+
+// Visible widths of a ladder line without its bar and of a tape line
+const (
+	ladderWidth = 46
+	tapeWidth   = 36
+)
+
+// terminal holds the terminal in cbreak mode on the alternate screen
+type terminal struct {
+	saved string
+}
+
+// openTerminal switches stdin to unbuffered, unechoed input with stty and
+// enters the alternate screen
+func openTerminal() (*terminal, error) {
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, fmt.Errorf("--tui needs a terminal and stty: %w", err)
+	}
+	if _, err := stty("cbreak", "-echo"); err != nil {
+		return nil, fmt.Errorf("failed to set the terminal mode: %w", err)
+	}
+	os.Stdout.WriteString("\x1b[?1049h\x1b[?25l")
+	return &terminal{saved: strings.TrimSpace(saved)}, nil
+}
+
+// size returns the rows and columns of the terminal
+func (t *terminal) size() (int, int) {
+	out, err := stty("size")
+	if err != nil {
+		return 24, 80
+	}
+	var rows, cols int
+	if _, err := fmt.Sscan(out, &rows, &cols); err != nil || rows == 0 || cols == 0 {
+		return 24, 80
+	}
+	return rows, cols
+}
+
+func (t *terminal) close() {
+	os.Stdout.WriteString("\x1b[?25h\x1b[?1049l")
+	stty(t.saved)
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return string(out), err
+}
+
+// readKeys sends the keys typed on stdin, decoding arrow keys and
+// shift-tab into "left", "right", "up", "down" and "backtab"
+func readKeys(keys chan<- string) {
+	buf := make([]byte, 64)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			close(keys)
+			return
+		}
+		in := string(buf[:n])
+		for len(in) > 0 {
+			key, size := in[:1], 1
+			if strings.HasPrefix(in, "\x1b[") && len(in) >= 3 {
+				size = 3
+				switch in[2] {
+				case 'A':
+					key = "up"
+				case 'B':
+					key = "down"
+				case 'C':
+					key = "right"
+				case 'D':
+					key = "left"
+				case 'Z':
+					key = "backtab"
+				default:
+					key = ""
+				}
+			}
+			in = in[size:]
+			if key != "" {
+				keys <- key
+			}
+		}
+	}
+}
+
+// logTail keeps the last line logged while the ladder owns the screen
+type logTail struct {
+	mu   sync.Mutex
+	line string
+}
+
+func (l *logTail) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	l.line = strings.TrimSpace(string(p))
+	l.mu.Unlock()
+	return len(p), nil
+}
+
+func (l *logTail) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.line
+}
+
+// ladder is the state of the terminal book view
+type ladder struct {
+	s      *session
+	levels int
+	index  int
+
+	// Rates over the last second, from the message count and the derived
+	// ticker sequence of the shown symbol
+	rateAt   time.Time
+	messages int64
+	seq      int64
+	symbol   string
+	msgRate  float64
+	bboRate  float64
+}
+
+// runTUI renders a live depth ladder of one symbol at a time until ctx is
+// done or q is pressed
+func runTUI(ctx context.Context, s *session, levels int, refresh time.Duration) error {
+	term, err := openTerminal()
+	if err != nil {
+		return err
+	}
+	defer term.close()
+
+	tail := &logTail{}
+	logOutput.set(tail)
+	defer logOutput.set(os.Stderr)
+
+	keys := make(chan string, 16)
+	go readKeys(keys)
+
+	l := &ladder{s: s, levels: levels}
+	rows, cols := term.size()
+	frame := time.NewTicker(refresh)
+	defer frame.Stop()
+	resize := time.NewTicker(time.Second)
+	defer resize.Stop()
+
+	for {
+		os.Stdout.WriteString(l.render(rows, cols, tail.String()))
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-frame.C:
+		case <-resize.C:
+			rows, cols = term.size()
+		case key, ok := <-keys:
+			if !ok || !l.key(key) {
+				return nil
+			}
+		}
+	}
+}
+
+// key applies a keybinding and reports whether the view stays open
+func (l *ladder) key(key string) bool {
+	n := len(l.s.symbols())
+	switch key {
+	case "q", "Q":
+		return false
+	case "right", "down", "\t", "n", "l", "j":
+		l.index++
+	case "left", "up", "backtab", "p", "h", "k":
+		l.index--
+	case "+", "=":
+		l.levels++
+	case "-", "_":
+		if l.levels > 1 {
+			l.levels--
+		}
+	default:
+		if d, err := strconv.Atoi(key); err == nil && d >= 1 && d <= n {
+			l.index = d - 1
+		}
+	}
+	if n > 0 {
+		l.index = (l.index%n + n) % n
+	}
+	return true
+}
+
+// render draws a frame of the current symbol
+func (l *ladder) render(rows, cols int, lastLog string) string {
+	var b strings.Builder
+	b.WriteString(escHome)
+	line := func(s string) {
+		b.WriteString(s)
+		b.WriteString(escClearLine + escReset + "\n")
+	}
+
+	symbols := l.s.symbols()
+	if len(symbols) == 0 {
+		line("no symbols")
+		b.WriteString(escClearDown)
+		return b.String()
+	}
+	if l.index >= len(symbols) {
+		l.index = 0
+	}
+	sym := symbols[l.index]
+	book := l.s.handler.GetOrderBook(sym.Symbol)
+	if book == nil {
+		book = &market.OrderBook{}
+	}
+	l.updateRates(sym.Symbol)
+
+	state := escGreen + "connected" + escReset
+	if !l.s.streams.Connected(sym.Category) {
+		state = escRed + "disconnected" + escReset
+	} else if last := l.s.lastMessage(); last.IsZero() || time.Since(last) > 5*time.Second {
+		state = escYellow + "stale" + escReset
+	}
+
+	var tabs []string
+	for i, other := range symbols {
+		name := fmt.Sprintf("%d:%s", i+1, other.Symbol)
+		if i == l.index {
+			name = escBold + "[" + name + "]" + escReset
+		}
+		tabs = append(tabs, name)
+	}
+	line(strings.Join(tabs, " "))
+	line(fmt.Sprintf("%s%s%s %s depth %d  %s  %.0f msg/s  %.0f bbo/s  book %s",
+		escBold, sym.Symbol, escReset, sym.Category, sym.Depth, state, l.msgRate, l.bboRate, book.Timestamp.Format("15:04:05.000")))
+
+	// Two header and two footer lines; the body holds the column titles,
+	// the spread line, the levels and the tape
+	body := rows - 4
+	levels := l.levels
+	if fit := (body - 2) / 2; levels > fit {
+		levels = fit
+	}
+	if levels < 1 {
+		levels = 1
+	}
+	bids, asks := top(book.Bids, levels), top(book.Asks, levels)
+	spread := "-"
+	if len(bids) > 0 && len(asks) > 0 {
+		s, mid := asks[0].Price-bids[0].Price, (asks[0].Price+bids[0].Price)/2
+		spread = fmt.Sprintf("spread %s (%.2f bps)  mid %s", num(s), s/mid*1e4, num(mid))
+	}
+
+	// The tape sits beside the ladder on wide terminals and below otherwise
+	barWidth := cols - ladderWidth - 1
+	beside := cols >= 110
+	if beside {
+		barWidth -= tapeWidth + 2
+	}
+	if barWidth < 0 {
+		barWidth = 0
+	}
+	ladder := l.ladderLines(bids, asks, spread, barWidth)
+	tape := l.tapeLines(sym.Symbol)
+
+	if beside {
+		for i := 0; i < body && (i < len(ladder) || i < len(tape)); i++ {
+			row := strings.Repeat(" ", ladderWidth+barWidth)
+			if i < len(ladder) {
+				row = ladder[i]
+			}
+			if i < len(tape) {
+				row += "  " + tape[i]
+			}
+			line(row)
+		}
+	} else {
+		for i := 0; i < len(ladder) && i < body; i++ {
+			line(ladder[i])
+		}
+		for i := 0; i < len(tape) && len(ladder)+i < body; i++ {
+			line(tape[i])
+		}
+	}
+
+	b.WriteString(escClearDown)
+	fmt.Fprintf(&b, "\x1b[%d;1H%s←/→ tab: symbol  1-9: jump  +/-: levels (%d)  q: quit%s%s", rows-1, escDim, l.levels, escReset, escClearLine)
+	if lastLog != "" {
+		fmt.Fprintf(&b, "\x1b[%d;1H%s%s%s", rows, escDim, truncate(lastLog, cols), escReset)
+	}
+	return b.String()
+}
+
+// ladderLines renders asks above bids, best prices next to the spread.
+// Each line starts with a fixed width of ladderWidth, followed by a size
+// bar of up to barWidth cells, padded so the tape can follow.
+func (l *ladder) ladderLines(bids, asks []market.Item, spread string, barWidth int) []string {
+	var largest float64
+	for _, items := range [][]market.Item{bids, asks} {
+		for _, it := range items {
+			if it.Amount > largest {
+				largest = it.Amount
+			}
+		}
+	}
+	bar := func(size float64) string {
+		n := 0
+		if largest > 0 {
+			n = int(size / largest * float64(barWidth))
+		}
+		return strings.Repeat("█", n) + strings.Repeat(" ", barWidth-n)
+	}
+
+	lines := []string{fmt.Sprintf("%s%14s %14s %14s  %-*s%s", escDim, "CUMULATIVE", "SIZE", "PRICE", barWidth, "", escReset)}
+
+	askLines := make([]string, len(asks))
+	var cum float64
+	for i, it := range asks {
+		cum += it.Amount
+		askLines[len(asks)-1-i] = fmt.Sprintf("%s%14s %14s %14s  %s%s", escRed, num(cum), num(it.Amount), num(it.Price), bar(it.Amount), escReset)
+	}
+	lines = append(lines, askLines...)
+	lines = append(lines, fmt.Sprintf("%s%-*s%s", escYellow, ladderWidth+barWidth, truncate("  "+spread, ladderWidth+barWidth), escReset))
+
+	cum = 0
+	for _, it := range bids {
+		cum += it.Amount
+		lines = append(lines, fmt.Sprintf("%s%14s %14s %14s  %s%s", escGreen, num(cum), num(it.Amount), num(it.Price), bar(it.Amount), escReset))
+	}
+	return lines
+}
+
+// tapeLines renders the latest trades of the handler's buffer, newest first
+func (l *ladder) tapeLines(symbol string) []string {
+	trades := l.s.handler.GetTrades(symbol)
+	lines := []string{fmt.Sprintf("%s%-12s %-4s %10s %7s%s", escDim, "TIME", "SIDE", "PRICE", "SIZE", escReset)}
+	for i := len(trades) - 1; i >= 0 && len(lines) < 200; i-- {
+		t := trades[i]
+		color := escGreen
+		if t.Side == "Sell" {
+			color = escRed
+		}
+		lines = append(lines, fmt.Sprintf("%s%-12s %-4s %10s %7s%s", color, t.Time.Local().Format("15:04:05.000"), t.Side, num(t.Price), num(t.Size), escReset))
+	}
+	return lines
+}
+
+// updateRates refreshes the update rates once a second
+func (l *ladder) updateRates(symbol string) {
+	now := time.Now()
+	messages := l.s.messages.Load()
+	var seq int64
+	if bbo := l.s.handler.GetBBO(symbol); bbo != nil {
+		seq = bbo.Seq
+	}
+	if symbol != l.symbol {
+		l.symbol, l.rateAt, l.messages, l.seq = symbol, now, messages, seq
+		l.msgRate, l.bboRate = 0, 0
+		return
+	}
+	if elapsed := now.Sub(l.rateAt).Seconds(); elapsed >= 1 {
+		l.msgRate = float64(messages-l.messages) / elapsed
+		l.bboRate = float64(seq-l.seq) / elapsed
+		l.rateAt, l.messages, l.seq = now, messages, seq
+	}
+}
+
+func truncate(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
@@ -2,43 +2,143 @@ package handler
 
 import (
 	"bybit_connector/internal/parser"
+	"bybit_connector/pkg/logging"
 	"bybit_connector/pkg/market"
+	"bybit_connector/pkg/metrics"
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
 )
 
 // HTTP/WebSocket handlers
-// WebSocketHandler handles WebSocket messages
+// WebSocketHandler handles WebSocket messages.
+// Messages are written from the read goroutine while the getters may be
+// called from anywhere, so all state is guarded by mu and every getter
+// returns a copy that the caller is free to keep or modify.
 type WebSocketHandler struct {
 	Parser        *parser.MessageParser
-	OrderBookMap  map[string]*market.OrderBook
-	TickerMap     map[string]*market.Ticker
-	TradeMap      map[string][]*market.Trade
 	MaxTradeCount int
+	// TradeWindows are the windows rolling trade aggregates are kept for.
+	// They cover every trade within their duration, regardless of
+	// MaxTradeCount. Both settings apply to trade buffers created after they are changed.
+	TradeWindows []time.Duration
+	// CandleIntervals are the intervals candles are built from the trade stream
+	CandleIntervals []time.Duration
+	// CandleCloseDelay is how long after the end of an interval
+	// RunCandleClock closes its candles, leaving time for late trades. It
+	// is capped at half the interval.
+	CandleCloseDelay time.Duration
+	// OnCandle receives every in-progress, closed and reconciled candle.
+	// It is called from the read goroutine outside the handler's lock.
+	OnCandle func(market.Candle)
+	// OnBBO receives a ticker derived from the local book each time the
+	// best bid or offer of a symbol changes. It is called from the read
+	// goroutine outside the handler's lock.
+	OnBBO func(market.Ticker)
+	// OnTrade receives every public trade after it was added to the buffer.
+	// It is called from the read goroutine outside the handler's lock.
+	OnTrade func(market.Trade)
+	// OnOrderBook receives the symbol and the new local book after every
+	// book update. The book is shared with the handler and must not be
+	// modified. It is called from the read goroutine outside the handler's lock.
+	OnOrderBook func(symbol string, book *market.OrderBook)
+	// OnLiquidation receives every liquidation of the allLiquidation topic.
+	// It is called from the read goroutine outside the handler's lock.
+	OnLiquidation func(market.Liquidation)
+	// OnCascade receives the cascade events of the symbols' liquidations,
+	// detected with Cascade against the local book. It is called from the
+	// read goroutine outside the handler's lock.
+	OnCascade func(market.CascadeEvent)
+	// Cascade applies to cascade detectors created after it is changed
+	Cascade market.CascadeConfig
+	// BBOIncludeTickers also passes tickers topic updates to OnBBO
+	BBOIncludeTickers bool
+	// SnapshotFetcher, when set, reseeds a book from REST after a sequence
+	// gap or when Bootstrap sees no snapshot within SnapshotTimeout. Events
+	// caused by a resync are delivered from the resync goroutine.
+	SnapshotFetcher market.SnapshotFetcher
+	SnapshotTimeout time.Duration
+	// Resubscribe, when set, resubscribes the orderbook topic of a symbol
+	// so that the exchange sends a new snapshot. It resyncs a book after a
+	// gap without a SnapshotFetcher, or once the REST resync gave up.
+	Resubscribe func(symbol string) error
+	// Metrics, when set, records the dispatch latency, book updates and
+	// resyncs. Set Parser.Metrics as well for the per-message metrics.
+	Metrics *metrics.Connector
+	// Logger receives the handler's records with the symbol they concern.
+	// The default logger is used when it is nil. Set Parser.Logger as well.
+	Logger *slog.Logger
+
+	mu         sync.RWMutex
+	orderBooks map[string]*market.OrderBook
+	tickers    map[string]*market.Ticker
+	trades     map[string]*market.TradeBuffer
+	candles    map[string]map[time.Duration]*market.CandleBuilder
+	bbo        map[string]*market.Ticker
+	cascades   map[string]*market.CascadeDetector
+
+	// Events queued under the lock and delivered by flush
+	emitted             []market.Candle
+	emittedBBO          []market.Ticker
+	emittedTrades       []market.Trade
+	emittedBooks        []emittedBook
+	emittedLiquidations []market.Liquidation
+	emittedCascades     []market.CascadeEvent
+}
+
+// emittedBook is a queued OnOrderBook event
+type emittedBook struct {
+	symbol string
+	book   *market.OrderBook
 }
 
 // NewWebSocketHandler creates a new WebSocket handler
 func NewWebSocketHandler() *WebSocketHandler {
 	return &WebSocketHandler{
-		Parser:        parser.NewMessageParser(),
-		OrderBookMap:  make(map[string]*market.OrderBook),
-		TickerMap:     make(map[string]*market.Ticker),
-		TradeMap:      make(map[string][]*market.Trade),
-		MaxTradeCount: 100, // Keep the last 100 trades
+		Parser:          parser.NewMessageParser(),
+		MaxTradeCount:   100, // Keep the last 100 trades
+		SnapshotTimeout: 5 * time.Second,
+		TradeWindows:    []time.Duration{time.Second, 10 * time.Second, time.Minute},
+		CandleIntervals: []time.Duration{
+			time.Second, time.Minute, 5 * time.Minute, time.Hour,
+		},
+		CandleCloseDelay: 500 * time.Millisecond,
+		Cascade:          market.DefaultCascadeConfig(),
+		orderBooks:       make(map[string]*market.OrderBook),
+		tickers:          make(map[string]*market.Ticker),
+		trades:           make(map[string]*market.TradeBuffer),
+		candles:          make(map[string]map[time.Duration]*market.CandleBuilder),
+		bbo:              make(map[string]*market.Ticker),
+		cascades:         make(map[string]*market.CascadeDetector),
 	}
 }
 
 // HandleMessage processes incoming WebSocket messages
 func (h *WebSocketHandler) HandleMessage(message []byte) {
+	h.HandleMessageAt(message, time.Now())
+}
+
+// HandleMessageAt processes a WebSocket message received at received,
+// which the delivered events carry in their Timestamps
+func (h *WebSocketHandler) HandleMessageAt(message []byte, received time.Time) {
 	if len(message) == 0 {
-		log.Println("Received empty message")
+		h.logger().Warn("Received empty message")
 		return
 	}
+	if h.Metrics != nil {
+		defer func(start time.Time) { h.Metrics.Dispatch(time.Since(start)) }(time.Now())
+	}
 
 	// Parse the message
-	parsedMsg, err := h.Parser.ParseMessage(message)
+	parsedMsg, err := h.Parser.ParseMessageAt(message, received)
 	if err != nil {
-		log.Printf("Error parsing message: %v", err)
+		// The parser logged the error with its topic
+		if errors.Is(err, market.ErrOrderBookGap) {
+			h.resync(topicSymbol(message))
+		}
 		return
 	}
 
@@ -46,30 +146,105 @@ func (h *WebSocketHandler) HandleMessage(message []byte) {
 	switch msg := parsedMsg.(type) {
 	case *market.OrderBookL2Delta:
 		if msg != nil {
-			h.handleOrderBookUpdate()
+			h.handleOrderBookUpdate(deltaSymbol(msg))
 		}
 	case []*market.OrderBookL2:
 		if len(msg) > 0 {
-			h.handleOrderBookUpdate()
+			h.handleOrderBookUpdate(msg[0].Symbol)
 		}
-	case *market.Trade:
-		if msg != nil {
-			h.addTrade(msg)
+	case []*market.Trade:
+		for _, trade := range msg {
+			h.addTrade(trade)
+		}
+		h.flush()
+	case []*market.Candle:
+		for _, kline := range msg {
+			h.reconcileCandle(kline)
 		}
+		h.flush()
 	case *market.Ticker:
 		if msg != nil && msg.Symbol != "" {
-			h.TickerMap[msg.Symbol] = msg
+			h.setTicker(msg)
 		}
+		h.flush()
+	case []*market.Liquidation:
+		for _, liquidation := range msg {
+			h.addLiquidation(liquidation)
+		}
+		h.flush()
 	default:
 		h.handleDefaultMessage(message)
 	}
 }
 
-// handleOrderBookUpdate updates all orderbooks
-func (h *WebSocketHandler) handleOrderBookUpdate() {
-	for symbol := range h.OrderBookMap {
-		h.updateOrderBook(symbol)
+// handleOrderBookUpdate updates the orderbook of the given symbol
+func (h *WebSocketHandler) handleOrderBookUpdate(symbol string) {
+	if symbol == "" {
+		return
 	}
+	h.updateOrderBook(symbol)
+	h.flush()
+}
+
+// Bootstrap resyncs the book of a symbol from REST if no WebSocket
+// snapshot arrived within SnapshotTimeout. Call it after subscribing.
+func (h *WebSocketHandler) Bootstrap(symbol string) {
+	if h.SnapshotFetcher == nil {
+		return
+	}
+	time.AfterFunc(h.SnapshotTimeout, func() {
+		if !h.Parser.OrderBookLocal.Synced(symbol) {
+			h.resync(symbol)
+		}
+	})
+}
+
+// resync reseeds the book of a symbol from a REST snapshot in the
+// background, retrying while the snapshot is older than the buffered deltas
+func (h *WebSocketHandler) resync(symbol string) {
+	if symbol == "" {
+		return
+	}
+	if h.SnapshotFetcher == nil {
+		h.resubscribe(symbol)
+		return
+	}
+
+	go func() {
+		for attempt := 1; attempt <= 5; attempt++ {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			err := h.Parser.OrderBookLocal.Resync(ctx, symbol, h.SnapshotFetcher)
+			cancel()
+			if err == nil {
+				h.Metrics.Resync(symbol, nil)
+				h.updateOrderBook(symbol)
+				h.flush()
+				return
+			}
+			h.logger().Warn("Failed to resync orderbook", "symbol", symbol, "attempt", attempt, "error", err)
+			if attempt == 5 {
+				h.Metrics.Resync(symbol, err)
+				h.resubscribe(symbol)
+				return
+			}
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+	}()
+}
+
+// resubscribe asks for a new WebSocket snapshot of a symbol's book in the
+// background. Without Resubscribe the book waits for the next snapshot.
+func (h *WebSocketHandler) resubscribe(symbol string) {
+	if h.Resubscribe == nil {
+		h.logger().Warn("Orderbook out of sync, waiting for the next snapshot", "symbol", symbol)
+		return
+	}
+	h.logger().Warn("Orderbook out of sync, resubscribing for a snapshot", "symbol", symbol)
+	go func() {
+		if err := h.Resubscribe(symbol); err != nil {
+			h.logger().Error("Failed to resubscribe orderbook", "symbol", symbol, "error", err)
+		}
+	}()
 }
 
 // handleDefaultMessage processes subscription and other messages
@@ -77,70 +252,449 @@ func (h *WebSocketHandler) handleDefaultMessage(message []byte) {
 	var baseMsg struct {
 		Topic   string `json:"topic,omitempty"`
 		Success bool   `json:"success,omitempty"`
+		Op      string `json:"op,omitempty"`
+		RetMsg  string `json:"ret_msg,omitempty"`
+		ReqID   string `json:"req_id,omitempty"`
+		ConnID  string `json:"conn_id,omitempty"`
 	}
 
 	if err := json.Unmarshal(message, &baseMsg); err != nil {
-		log.Printf("Error unmarshaling default message: %v", err)
+		h.logger().Warn("Failed to unmarshal message", "error", err)
 		return
 	}
 
+	if baseMsg.Op != "" {
+		l := h.logger().With("op", baseMsg.Op, "req_id", baseMsg.ReqID, "exchange_conn_id", baseMsg.ConnID)
+		switch {
+		case !baseMsg.Success:
+			l.Warn("Request rejected", "ret_msg", baseMsg.RetMsg)
+		case baseMsg.Op == "ping" || baseMsg.Op == "pong":
+			l.Debug("Pong received")
+		default:
+			l.Info("Request succeeded")
+		}
+		return
+	}
 	if baseMsg.Success {
-		log.Printf("Successfully subscribed/unsubscribed")
+		h.logger().Info("Request succeeded", "req_id", baseMsg.ReqID)
 		return
 	}
 
 	if baseMsg.Topic != "" {
-		parts := internal.SplitTopic(baseMsg.Topic)
+		parts := parser.SplitTopic(baseMsg.Topic)
 		if len(parts) >= 3 {
 			h.ensureOrderBook(parts[2])
 		}
 	}
 }
 
-// GetOrderBook gets the current orderbook for a symbol
+func (h *WebSocketHandler) logger() *slog.Logger {
+	return logging.Or(h.Logger)
+}
+
+// GetOrderBook gets a copy of the current orderbook for a symbol
 func (h *WebSocketHandler) GetOrderBook(symbol string) *market.OrderBook {
 	if symbol == "" {
 		return nil
 	}
-	h.ensureOrderBook(symbol)
-	return h.OrderBookMap[symbol]
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.orderBooks[symbol].Clone()
 }
 
-// GetTicker gets the current ticker for a symbol
+// GetOrderBookState gets the current orderbook of a symbol together with
+// its update ID and sync state, read at once from the local book
+func (h *WebSocketHandler) GetOrderBookState(symbol string) (book *market.OrderBook, updateID int64, synced bool) {
+	if symbol == "" {
+		return nil, 0, false
+	}
+	h.mu.RLock()
+	_, ok := h.orderBooks[symbol]
+	h.mu.RUnlock()
+	if !ok {
+		return nil, 0, false
+	}
+	return h.Parser.OrderBookLocal.SnapshotState(symbol)
+}
+
+// GetTicker gets a copy of the current ticker for a symbol
 func (h *WebSocketHandler) GetTicker(symbol string) *market.Ticker {
 	if symbol == "" {
 		return nil
 	}
-	return h.TickerMap[symbol]
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	t, ok := h.tickers[symbol]
+	if !ok {
+		return nil
+	}
+	ticker := *t
+	return &ticker
+}
+
+// GetBBO gets a copy of the latest ticker derived from the local book of a symbol
+func (h *WebSocketHandler) GetBBO(symbol string) *market.Ticker {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	t, ok := h.bbo[symbol]
+	if !ok {
+		return nil
+	}
+	ticker := *t
+	return &ticker
 }
 
-// GetTrades gets the trade history for a symbol
-func (h *WebSocketHandler) GetTrades(symbol string) []*market.Trade {
+// GetTrades gets a copy of the trade history for a symbol
+func (h *WebSocketHandler) GetTrades(symbol string) []market.Trade {
 	if symbol == "" {
 		return nil
 	}
-	return h.TradeMap[symbol]
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if b, ok := h.trades[symbol]; ok {
+		return b.Trades()
+	}
+	return nil
+}
+
+// GetTradesSince gets a copy of the trades of the last d for a symbol
+func (h *WebSocketHandler) GetTradesSince(symbol string, d time.Duration) []market.Trade {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if b, ok := h.trades[symbol]; ok {
+		return b.Since(d, time.Now())
+	}
+	return nil
+}
+
+// GetTradesSinceID gets a copy of the trades after the given trade ID for a symbol.
+// ok is false when the ID is no longer buffered and trades may have been missed.
+func (h *WebSocketHandler) GetTradesSinceID(symbol, id string) ([]market.Trade, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if b, ok := h.trades[symbol]; ok {
+		return b.SinceID(id)
+	}
+	return nil, false
+}
+
+// GetTradeStats gets the rolling trade aggregates of a symbol over the
+// given window, ending now
+func (h *WebSocketHandler) GetTradeStats(symbol string, window time.Duration) market.TradeStats {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if b, ok := h.trades[symbol]; ok {
+		return b.Stats(window, time.Now())
+	}
+	return market.TradeStats{}
+}
+
+// RangeTrades calls fn for each buffered trade of a symbol from oldest to
+// newest without copying. fn runs under the handler's read lock, so it
+// must not retain the trade or call back into the handler's setters.
+func (h *WebSocketHandler) RangeTrades(symbol string, fn func(*market.Trade) bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if b, ok := h.trades[symbol]; ok {
+		b.Range(fn)
+	}
+}
+
+// GetLiquidationStats gets the aggregates of the liquidations of a
+// position side of a symbol within window of the latest one
+func (h *WebSocketHandler) GetLiquidationStats(symbol, side string, window time.Duration) market.LiquidationStats {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if d, ok := h.cascades[symbol]; ok {
+		return d.Stats(side, window)
+	}
+	return market.LiquidationStats{}
+}
+
+// GetCandles gets a copy of the candles of a symbol for the given
+// interval, oldest first, ending with the in-progress candle if any
+func (h *WebSocketHandler) GetCandles(symbol string, interval time.Duration) []market.Candle {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	b, ok := h.candles[symbol][interval]
+	if !ok {
+		return nil
+	}
+	candles := b.Candles()
+	if c, ok := b.Current(); ok {
+		candles = append(candles, c)
+	}
+	return candles
+}
+
+// AdvanceCandles closes the candles of an interval that ended before now,
+// with flat candles for quiet intervals, on every symbol
+func (h *WebSocketHandler) AdvanceCandles(interval time.Duration, now time.Time) {
+	h.mu.Lock()
+	for _, builders := range h.candles {
+		if b, ok := builders[interval]; ok {
+			b.Advance(now)
+		}
+	}
+	h.mu.Unlock()
+	h.flush()
+}
+
+// RunCandleClock closes the candles of each interval when it ends, plus
+// CandleCloseDelay, so that quiet markets still get their candles. It
+// returns when ctx is done.
+func (h *WebSocketHandler) RunCandleClock(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, interval := range h.CandleIntervals {
+		if interval <= 0 {
+			continue
+		}
+		delay := min(h.CandleCloseDelay, interval/2)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				now := time.Now()
+				next := now.Add(-delay).Truncate(interval).Add(interval + delay)
+				timer := time.NewTimer(next.Sub(now))
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return
+				case <-timer.C:
+				}
+				h.AdvanceCandles(interval, time.Now().Add(-delay))
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Forget drops every state kept for a symbol, after it was unsubscribed
+func (h *WebSocketHandler) Forget(symbol string) {
+	h.Parser.OrderBookLocal.Remove(symbol)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.orderBooks, symbol)
+	delete(h.tickers, symbol)
+	delete(h.trades, symbol)
+	delete(h.candles, symbol)
+	delete(h.bbo, symbol)
+	delete(h.cascades, symbol)
 }
 
 // ensureOrderBook ensures that an order book exists for the given symbol
 func (h *WebSocketHandler) ensureOrderBook(symbol string) {
-	if _, exists := h.OrderBookMap[symbol]; !exists {
-		h.OrderBookMap[symbol] = &market.OrderBook{}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, exists := h.orderBooks[symbol]; !exists {
+		h.orderBooks[symbol] = &market.OrderBook{}
 	}
 }
 
-// updateOrderBook updates the order book for the given symbol
+// updateOrderBook replaces the order book for the given symbol with a
+// fresh snapshot of the parser's local book. The snapshot is built outside
+// the lock and swapped in, so readers never observe a partial update.
 func (h *WebSocketHandler) updateOrderBook(symbol string) {
-	// Implementation for updating the order book
+	ob := h.Parser.OrderBookLocal.Snapshot(symbol)
+	top, hasTop := ob.TopOfBook(symbol)
+	h.Metrics.BookUpdate(symbol)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.orderBooks[symbol] = ob
+	if h.OnOrderBook != nil {
+		h.emittedBooks = append(h.emittedBooks, emittedBook{symbol, ob})
+	}
+
+	if !hasTop {
+		return
+	}
+	prev, ok := h.bbo[symbol]
+	if ok && prev.Bid == top.Bid && prev.BidSize == top.BidSize &&
+		prev.Ask == top.Ask && prev.AskSize == top.AskSize {
+		return
+	}
+	if ok {
+		top.Seq = prev.Seq + 1
+	} else {
+		top.Seq = 1
+	}
+	h.bbo[symbol] = &top
+	if h.OnBBO != nil {
+		h.emittedBBO = append(h.emittedBBO, top)
+	}
+}
+
+// setTicker stores the ticker for its symbol. Tickers topic deltas only
+// carry changed fields, so zero fields keep their previous value.
+func (h *WebSocketHandler) setTicker(ticker *market.Ticker) {
+	t := *ticker
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if prev, ok := h.tickers[t.Symbol]; ok {
+		mergeTicker(&t, prev)
+	}
+	h.tickers[t.Symbol] = &t
+	if h.OnBBO != nil && h.BBOIncludeTickers {
+		h.emittedBBO = append(h.emittedBBO, t)
+	}
 }
 
-// addTrade adds a trade to the trade map
+// addTrade adds a trade to the trade buffer and candles of its symbol
 func (h *WebSocketHandler) addTrade(trade *market.Trade) {
 	if trade == nil || trade.Symbol == "" {
 		return
 	}
-	h.TradeMap[trade.Symbol] = append(h.TradeMap[trade.Symbol], trade)
-	if len(h.TradeMap[trade.Symbol]) > h.MaxTradeCount {
-		h.TradeMap[trade.Symbol] = h.TradeMap[trade.Symbol][1:]
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	b, ok := h.trades[trade.Symbol]
+	if !ok {
+		b = market.NewTradeBuffer(h.MaxTradeCount, h.TradeWindows...)
+		h.trades[trade.Symbol] = b
+	}
+	b.Add(*trade)
+	if h.OnTrade != nil {
+		h.emittedTrades = append(h.emittedTrades, *trade)
+	}
+
+	for _, cb := range h.candleBuilders(trade.Symbol) {
+		cb.AddTrade(*trade)
+	}
+}
+
+// addLiquidation passes a liquidation to the cascade detector of its symbol
+func (h *WebSocketHandler) addLiquidation(liquidation *market.Liquidation) {
+	if liquidation == nil || liquidation.Symbol == "" {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	d, ok := h.cascades[liquidation.Symbol]
+	if !ok {
+		d = market.NewCascadeDetector(liquidation.Symbol, h.Cascade, h.queueCascade)
+		h.cascades[liquidation.Symbol] = d
+	}
+	if h.OnLiquidation != nil {
+		h.emittedLiquidations = append(h.emittedLiquidations, *liquidation)
+	}
+	d.Add(*liquidation, h.orderBooks[liquidation.Symbol])
+}
+
+// queueCascade collects cascade events until the lock is released.
+// The caller must hold the write lock.
+func (h *WebSocketHandler) queueCascade(e market.CascadeEvent) {
+	if h.OnCascade != nil {
+		h.emittedCascades = append(h.emittedCascades, e)
+	}
+}
+
+// reconcileCandle corrects the locally built candle matching an exchange kline
+func (h *WebSocketHandler) reconcileCandle(kline *market.Candle) {
+	if kline == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if cb, ok := h.candles[kline.Symbol][kline.Interval]; ok {
+		cb.Reconcile(*kline)
+	}
+}
+
+// candleBuilders returns the candle builders of a symbol, creating them
+// on first use. The caller must hold the write lock.
+func (h *WebSocketHandler) candleBuilders(symbol string) map[time.Duration]*market.CandleBuilder {
+	builders, ok := h.candles[symbol]
+	if !ok {
+		builders = make(map[time.Duration]*market.CandleBuilder)
+		for _, interval := range h.CandleIntervals {
+			if interval > 0 {
+				builders[interval] = market.NewCandleBuilder(symbol, interval, h.queueCandle)
+			}
+		}
+		h.candles[symbol] = builders
+	}
+	return builders
+}
+
+// queueCandle collects emitted candles until the lock is released.
+// The caller must hold the write lock.
+func (h *WebSocketHandler) queueCandle(c market.Candle) {
+	if h.OnCandle != nil {
+		h.emitted = append(h.emitted, c)
+	}
+}
+
+// flush passes the queued events to their callbacks
+func (h *WebSocketHandler) flush() {
+	h.mu.Lock()
+	emitted, emittedBBO, emittedTrades, emittedBooks := h.emitted, h.emittedBBO, h.emittedTrades, h.emittedBooks
+	h.emitted, h.emittedBBO, h.emittedTrades, h.emittedBooks = nil, nil, nil, nil
+	emittedLiquidations, emittedCascades := h.emittedLiquidations, h.emittedCascades
+	h.emittedLiquidations, h.emittedCascades = nil, nil
+	h.mu.Unlock()
+
+	for _, b := range emittedBooks {
+		h.OnOrderBook(b.symbol, b.book)
+	}
+	for _, t := range emittedTrades {
+		h.OnTrade(t)
+	}
+	for _, c := range emitted {
+		h.OnCandle(c)
+	}
+	for _, t := range emittedBBO {
+		h.OnBBO(t)
+	}
+	for _, l := range emittedLiquidations {
+		h.OnLiquidation(l)
+	}
+	for _, e := range emittedCascades {
+		h.OnCascade(e)
+	}
+}
+
+// topicSymbol returns the symbol of a message's topic
+func topicSymbol(message []byte) string {
+	var baseMsg struct {
+		Topic string `json:"topic"`
+	}
+	if err := json.Unmarshal(message, &baseMsg); err != nil {
+		return ""
+	}
+	parts := parser.SplitTopic(baseMsg.Topic)
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[len(parts)-1]
+}
+
+// deltaSymbol returns the symbol carried by the entries of a delta
+func deltaSymbol(delta *market.OrderBookL2Delta) string {
+	for _, entries := range [][]*market.OrderBookL2{delta.Update, delta.Insert, delta.Delete} {
+		if len(entries) > 0 {
+			return entries[0].Symbol
+		}
+	}
+	return ""
+}
+
+// mergeTicker fills the zero fields of t from prev
+func mergeTicker(t, prev *market.Ticker) {
+	for _, f := range []struct{ dst, src *float64 }{
+		{&t.Bid, &prev.Bid},
+		{&t.BidSize, &prev.BidSize},
+		{&t.Ask, &prev.Ask},
+		{&t.AskSize, &prev.AskSize},
+		{&t.LastPrice, &prev.LastPrice},
+	} {
+		if *f.dst == 0 {
+			*f.dst = *f.src
+		}
 	}
 }
@@ -0,0 +1,388 @@
+package handler
+
+import (
+	"bybit_connector/pkg/market"
+	"bybit_connector/pkg/metrics"
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func orderbookSnapshot(symbol string, bid, ask float64) []byte {
+	return []byte(fmt.Sprintf(`{"topic":"orderbook.1.%s","type":"snapshot","ts":1,"data":{"s":"%s","b":[["%g","1"]],"a":[["%g","2"]],"u":1,"seq":1}}`,
+		symbol, symbol, bid, ask))
+}
+
+func TestGetOrderBookReturnsCopy(t *testing.T) {
+	h := NewWebSocketHandler()
+	h.HandleMessage(orderbookSnapshot("BTCUSDT", 100, 101))
+
+	ob := h.GetOrderBook("BTCUSDT")
+	if ob == nil || len(ob.Bids) != 1 || len(ob.Asks) != 1 {
+		t.Fatalf("unexpected orderbook: %+v", ob)
+	}
+	if ob.Bids[0].Price != 100 || ob.Asks[0].Price != 101 {
+		t.Fatalf("unexpected top of book: %+v", ob)
+	}
+
+	ob.Bids[0].Price = 1
+	if got := h.GetOrderBook("BTCUSDT").Bids[0].Price; got != 100 {
+		t.Fatalf("mutating the returned book changed handler state: %v", got)
+	}
+}
+
+func TestGettersDoNotCreateState(t *testing.T) {
+	h := NewWebSocketHandler()
+	if ob := h.GetOrderBook("ETHUSDT"); ob != nil {
+		t.Fatalf("expected nil orderbook, got %+v", ob)
+	}
+	if len(h.orderBooks) != 0 {
+		t.Fatalf("getter created an orderbook entry")
+	}
+}
+
+func TestGetTickerAndTradesReturnCopies(t *testing.T) {
+	h := NewWebSocketHandler()
+	h.setTicker(&market.Ticker{Symbol: "BTCUSDT", Bid: 100, Ask: 101})
+	h.addTrade(&market.Trade{Symbol: "BTCUSDT", Price: 100, Size: 1, TradeId: "1"})
+
+	ticker := h.GetTicker("BTCUSDT")
+	ticker.Bid = 0
+	if got := h.GetTicker("BTCUSDT").Bid; got != 100 {
+		t.Fatalf("mutating the returned ticker changed handler state: %v", got)
+	}
+
+	trades := h.GetTrades("BTCUSDT")
+	if len(trades) != 1 {
+		t.Fatalf("expected 1 trade, got %d", len(trades))
+	}
+	trades[0].Price = 0
+	if got := h.GetTrades("BTCUSDT")[0].Price; got != 100 {
+		t.Fatalf("mutating the returned trade changed handler state: %v", got)
+	}
+}
+
+func TestConcurrentReaders(t *testing.T) {
+	h := NewWebSocketHandler()
+	symbols := []string{"BTCUSDT", "ETHUSDT"}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 500; i++ {
+			symbol := symbols[i%len(symbols)]
+			h.HandleMessage(orderbookSnapshot(symbol, float64(100+i), float64(101+i)))
+			h.setTicker(&market.Ticker{Symbol: symbol, Bid: float64(i), Time: time.Now()})
+			h.addTrade(&market.Trade{Symbol: symbol, Price: float64(i), TradeId: fmt.Sprint(i)})
+		}
+		close(done)
+	}()
+
+	for r := 0; r < 8; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				for _, symbol := range symbols {
+					if ob := h.GetOrderBook(symbol); ob != nil {
+						for i := range ob.Bids {
+							ob.Bids[i].Amount = 0
+						}
+					}
+					if ticker := h.GetTicker(symbol); ticker != nil {
+						ticker.Bid = 0
+					}
+					trades := h.GetTrades(symbol)
+					for i := range trades {
+						trades[i].Price = 0
+					}
+					h.GetTradeStats(symbol, time.Second)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if got := len(h.GetTrades("BTCUSDT")); got != h.MaxTradeCount {
+		t.Fatalf("expected %d trades, got %d", h.MaxTradeCount, got)
+	}
+}
+
+func TestTradeMessagesBuildCandles(t *testing.T) {
+	h := NewWebSocketHandler()
+	h.CandleIntervals = []time.Duration{time.Second, time.Minute}
+	var closed []market.Candle
+	h.OnCandle = func(c market.Candle) {
+		if c.Closed && c.Interval == time.Second {
+			closed = append(closed, c)
+		}
+	}
+	var trades []market.Trade
+	h.OnTrade = func(t market.Trade) { trades = append(trades, t) }
+
+	h.HandleMessage([]byte(`{"topic":"publicTrade.BTCUSDT","type":"snapshot","ts":1000,"data":[` +
+		`{"T":1000,"s":"BTCUSDT","S":"Buy","v":"1","p":"100","L":"PlusTick","i":"a","BT":false},` +
+		`{"T":1500,"s":"BTCUSDT","S":"Sell","v":"2","p":"99","L":"MinusTick","i":"b","BT":false}]}`))
+	h.HandleMessage([]byte(`{"topic":"publicTrade.BTCUSDT","type":"snapshot","ts":2000,"data":[` +
+		`{"T":2100,"s":"BTCUSDT","S":"Buy","v":"1","p":"101","L":"PlusTick","i":"c","BT":false}]}`))
+
+	if got := len(h.GetTrades("BTCUSDT")); got != 3 {
+		t.Fatalf("expected 3 trades, got %d", got)
+	}
+	if len(trades) != 3 || trades[2].TradeId != "c" {
+		t.Fatalf("expected every trade passed to OnTrade in order, got %+v", trades)
+	}
+	if len(closed) != 1 || closed[0].TradeCount != 2 || closed[0].Close != 99 {
+		t.Fatalf("unexpected closed candles: %+v", closed)
+	}
+
+	if candles := h.GetCandles("BTCUSDT", time.Second); len(candles) != 2 {
+		t.Fatalf("expected a closed and an in-progress candle, got %+v", candles)
+	}
+
+	// The confirmed one minute kline corrects and closes the minute candle
+	var reconciled []market.Candle
+	h.OnCandle = func(c market.Candle) {
+		if c.Reconciled {
+			reconciled = append(reconciled, c)
+		}
+	}
+	h.HandleMessage([]byte(`{"topic":"kline.1.BTCUSDT","type":"snapshot","ts":60000,"data":[` +
+		`{"start":0,"end":59999,"interval":"1","open":"100.5","close":"101","high":"102","low":"98","volume":"4.5","turnover":"450","confirm":true}]}`))
+	candles := h.GetCandles("BTCUSDT", time.Minute)
+	if len(candles) != 1 || len(reconciled) != 1 {
+		t.Fatalf("expected one reconciled minute candle, got %+v", candles)
+	}
+	c := candles[0]
+	if !c.Closed || !c.Reconciled || c.Open != 100.5 || c.High != 102 || c.Low != 98 || c.Close != 101 ||
+		c.Volume != 4.5 || c.Turnover != 450 {
+		t.Fatalf("expected the kline's OHLCV, got %+v", c)
+	}
+	// The buy/sell split and trade count are kept from the trades
+	if c.BuyVolume != 2 || c.SellVolume != 2 || c.TradeCount != 3 {
+		t.Fatalf("expected the local split and count, got %+v", c)
+	}
+}
+
+func TestCandleClockClosesQuietCandles(t *testing.T) {
+	h := NewWebSocketHandler()
+	h.CandleIntervals = []time.Duration{50 * time.Millisecond}
+	closed := make(chan market.Candle, 16)
+	h.OnCandle = func(c market.Candle) {
+		if c.Closed {
+			closed <- c
+		}
+	}
+	h.HandleMessage([]byte(fmt.Sprintf(`{"topic":"publicTrade.BTCUSDT","type":"snapshot","ts":1,"data":[`+
+		`{"T":%d,"s":"BTCUSDT","S":"Buy","v":"1","p":"100","i":"a"}]}`, time.Now().UnixMilli())))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		h.RunCandleClock(ctx)
+		close(done)
+	}()
+	// No further trade arrives, yet the candle and the next quiet one close
+	for i := 0; i < 2; i++ {
+		select {
+		case c := <-closed:
+			if c.Close != 100 || (i == 0) != (c.TradeCount == 1) {
+				t.Fatalf("unexpected closed candle %d: %+v", i, c)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("candle %d was not closed", i)
+		}
+	}
+	cancel()
+	<-done
+}
+
+func TestBBOEmittedOnTopOfBookChange(t *testing.T) {
+	h := NewWebSocketHandler()
+	var bbo []market.Ticker
+	h.OnBBO = func(t market.Ticker) { bbo = append(bbo, t) }
+	var books []*market.OrderBook
+	h.OnOrderBook = func(symbol string, book *market.OrderBook) { books = append(books, book) }
+
+	h.HandleMessage(orderbookSnapshot("BTCUSDT", 100, 101))
+	// Same top of book, no new BBO
+	h.HandleMessage([]byte(`{"topic":"orderbook.1.BTCUSDT","type":"delta","ts":2,"data":{"s":"BTCUSDT","b":[["100","1"]],"a":[],"u":2,"seq":2}}`))
+	h.HandleMessage([]byte(`{"topic":"orderbook.1.BTCUSDT","type":"delta","ts":3,"data":{"s":"BTCUSDT","b":[["100","5"]],"a":[],"u":3,"seq":3}}`))
+
+	if len(bbo) != 2 {
+		t.Fatalf("expected 2 BBO updates, got %+v", bbo)
+	}
+	if len(books) != 3 || books[2].Bids[0].Amount != 5 {
+		t.Fatalf("expected every book update, got %d", len(books))
+	}
+	if bbo[1].Seq != 2 || bbo[1].BidSize != 5 || !bbo[1].Time.Equal(time.UnixMilli(3)) || !bbo[1].Derived {
+		t.Fatalf("unexpected BBO: %+v", bbo[1])
+	}
+	if got := h.GetBBO("BTCUSDT"); got == nil || got.Seq != 2 {
+		t.Fatalf("unexpected stored BBO: %+v", got)
+	}
+
+	h.BBOIncludeTickers = true
+	h.HandleMessage([]byte(`{"topic":"tickers.BTCUSDT","type":"snapshot","ts":4,"data":{"symbol":"BTCUSDT","lastPrice":"100.5","bid1Price":"100","bid1Size":"5","ask1Price":"101","ask1Size":"2"}}`))
+	h.HandleMessage([]byte(`{"topic":"tickers.BTCUSDT","type":"delta","ts":5,"data":{"symbol":"BTCUSDT","lastPrice":"100.7"}}`))
+	if len(bbo) != 4 || bbo[3].Derived || bbo[3].Bid != 100 || bbo[3].LastPrice != 100.7 {
+		t.Fatalf("unexpected tickers topic updates: %+v", bbo)
+	}
+}
+
+func TestGapWithoutFetcherResubscribes(t *testing.T) {
+	h := NewWebSocketHandler()
+	resubscribed := make(chan string, 1)
+	h.Resubscribe = func(symbol string) error {
+		resubscribed <- symbol
+		return nil
+	}
+
+	h.HandleMessage(orderbookSnapshot("BTCUSDT", 100, 101))
+	h.HandleMessage([]byte(`{"topic":"orderbook.1.BTCUSDT","type":"delta","ts":3,"data":{"s":"BTCUSDT","b":[["99","1"]],"a":[],"u":3,"seq":3}}`))
+	select {
+	case symbol := <-resubscribed:
+		if symbol != "BTCUSDT" {
+			t.Fatalf("resubscribed %s", symbol)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the orderbook to be resubscribed after a gap")
+	}
+
+	// The snapshot sent after resubscribing resyncs the book
+	h.HandleMessage([]byte(`{"topic":"orderbook.1.BTCUSDT","type":"snapshot","ts":4,"data":{"s":"BTCUSDT","b":[["98","1"]],"a":[["102","1"]],"u":10,"seq":10}}`))
+	if !h.Parser.OrderBookLocal.Synced("BTCUSDT") {
+		t.Fatal("expected the snapshot to resync the book")
+	}
+	if book := h.GetOrderBook("BTCUSDT"); book == nil || book.Bids[0].Price != 98 {
+		t.Fatalf("unexpected book after resync: %+v", book)
+	}
+}
+
+func TestForgetDropsSymbolState(t *testing.T) {
+	h := NewWebSocketHandler()
+	h.HandleMessage(orderbookSnapshot("BTCUSDT", 100, 101))
+	h.HandleMessage(orderbookSnapshot("ETHUSDT", 10, 11))
+
+	h.Forget("BTCUSDT")
+	if h.GetOrderBook("BTCUSDT") != nil || h.Parser.OrderBookLocal.Synced("BTCUSDT") {
+		t.Fatal("BTCUSDT state survived Forget")
+	}
+	if ob := h.GetOrderBook("ETHUSDT"); ob == nil || len(ob.Bids) != 1 {
+		t.Fatal("ETHUSDT book was not preserved")
+	}
+}
+
+func TestMetricsRecordBookHealth(t *testing.T) {
+	m := metrics.NewConnector()
+	h := NewWebSocketHandler()
+	h.Metrics, h.Parser.Metrics = m, m
+	h.SnapshotFetcher = func(ctx context.Context, symbol string) (*market.OrderBook, int64, error) {
+		return &market.OrderBook{Bids: []market.Item{{Price: 100, Amount: 1}}, Asks: []market.Item{{Price: 101, Amount: 1}}}, 4, nil
+	}
+
+	h.HandleMessage(orderbookSnapshot("BTCUSDT", 100, 101))
+	h.HandleMessage([]byte(`{"topic":"orderbook.1.BTCUSDT","type":"delta","ts":2,"data":{"s":"BTCUSDT","b":[["100","3"]],"a":[],"u":2,"seq":2}}`))
+	// Update 3 is missing
+	h.HandleMessage([]byte(`{"topic":"orderbook.1.BTCUSDT","type":"delta","ts":3,"data":{"s":"BTCUSDT","b":[["100","4"]],"a":[],"u":4,"seq":4}}`))
+	h.HandleMessage([]byte(`{"topic":"tickers.BTCUSDT","data":`))
+
+	want := []string{
+		`bybit_ws_messages_total{topic="orderbook.1.BTCUSDT"} 3`,
+		`bybit_book_sequence_gaps_total{symbol="BTCUSDT"} 1`,
+		`bybit_parse_errors_total{topic="unknown"} 1`,
+		`bybit_handler_dispatch_seconds_count 4`,
+		`bybit_book_resyncs_total{result="ok",symbol="BTCUSDT"} 1`,
+		`bybit_book_updates_total{symbol="BTCUSDT"} 3`,
+	}
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		out := httptest.NewRecorder()
+		m.ServeHTTP(out, httptest.NewRequest("GET", "/metrics", nil))
+		missing := ""
+		for _, line := range want {
+			if !strings.Contains(out.Body.String(), line+"\n") {
+				missing = line
+				break
+			}
+		}
+		if missing == "" {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("missing %s in:\n%s", missing, out.Body.String())
+		}
+	}
+}
+
+func TestEventsCarryTimestamps(t *testing.T) {
+	h := NewWebSocketHandler()
+	var trades []market.Trade
+	h.OnTrade = func(t market.Trade) { trades = append(trades, t) }
+	var books []*market.OrderBook
+	h.OnOrderBook = func(symbol string, book *market.OrderBook) { books = append(books, book) }
+	var bbo []market.Ticker
+	h.OnBBO = func(t market.Ticker) { bbo = append(bbo, t) }
+
+	received := time.Now()
+	h.HandleMessageAt([]byte(`{"topic":"orderbook.1.BTCUSDT","type":"snapshot","ts":1700000000200,"cts":1700000000150,`+
+		`"data":{"s":"BTCUSDT","b":[["100","1"]],"a":[["101","2"]],"u":1,"seq":1}}`), received)
+	h.HandleMessageAt([]byte(`{"topic":"publicTrade.BTCUSDT","type":"snapshot","ts":1700000000300,"data":[`+
+		`{"T":1700000000250,"s":"BTCUSDT","S":"Buy","v":"1","p":"100","L":"PlusTick","i":"a","BT":false}]}`), received)
+
+	want := market.Timestamps{
+		MatchingTime: time.UnixMilli(1700000000150),
+		ExchangeTime: time.UnixMilli(1700000000200),
+		ReceivedTime: received,
+	}
+	if len(books) != 1 || books[0].Timestamps != want || !books[0].Timestamp.Equal(want.ExchangeTime) {
+		t.Fatalf("unexpected book timestamps: %+v", books)
+	}
+	if len(bbo) != 1 || bbo[0].Timestamps != want {
+		t.Fatalf("unexpected BBO timestamps: %+v", bbo)
+	}
+	if len(trades) != 1 || !trades[0].MatchingTime.Equal(time.UnixMilli(1700000000250)) ||
+		!trades[0].ExchangeTime.Equal(time.UnixMilli(1700000000300)) || trades[0].ReceivedTime != received {
+		t.Fatalf("unexpected trade timestamps: %+v", trades)
+	}
+	if got := trades[0].Latency(); got != received.Sub(time.UnixMilli(1700000000300)) {
+		t.Fatalf("unexpected trade latency %v", got)
+	}
+}
+
+func TestLiquidationsRaiseCascades(t *testing.T) {
+	h := NewWebSocketHandler()
+	h.Cascade = market.CascadeConfig{Windows: []time.Duration{time.Minute}, Thresholds: []float64{1}, DepthBps: 100}
+	var liquidations []market.Liquidation
+	h.OnLiquidation = func(l market.Liquidation) { liquidations = append(liquidations, l) }
+	var cascades []market.CascadeEvent
+	h.OnCascade = func(e market.CascadeEvent) { cascades = append(cascades, e) }
+
+	h.HandleMessage(orderbookSnapshot("BTCUSDT", 100, 101))
+	h.HandleMessage([]byte(`{"topic":"allLiquidation.BTCUSDT","type":"snapshot","ts":1700000000100,"data":[` +
+		`{"T":1700000000000,"s":"BTCUSDT","S":"Buy","v":"0.4","p":"100.1"},` +
+		`{"T":1700000000050,"s":"BTCUSDT","S":"Buy","v":"0.7","p":"100"}]}`))
+
+	if len(liquidations) != 2 || liquidations[0].Size != 0.4 || liquidations[1].Price != 100 ||
+		!liquidations[1].MatchingTime.Equal(time.UnixMilli(1700000000050)) || liquidations[1].OrderSide() != "Sell" {
+		t.Fatalf("unexpected liquidations: %+v", liquidations)
+	}
+	if len(cascades) != 1 || cascades[0].Symbol != "BTCUSDT" || cascades[0].Side != "Buy" || cascades[0].Count != 2 {
+		t.Fatalf("expected one cascade against the 1 bid, got %+v", cascades)
+	}
+	if got := h.GetLiquidationStats("BTCUSDT", "Buy", time.Minute); got.Count != 2 {
+		t.Fatalf("unexpected stats: %+v", got)
+	}
+}
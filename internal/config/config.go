@@ -1,25 +1,101 @@
 package config
 
 import (
+	"bybit_connector/pkg/market"
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 
+	"github.com/BurntSushi/toml"
 	"github.com/subosito/gotenv"
+	"gopkg.in/yaml.v3"
 )
 
 // Configuration management
 type Config struct {
+	// Profile is the name of the profile the configuration was built from
+	Profile string
+	// Environment is mainnet, testnet or demo
+	Environment string
+	// Region selects a regional mainnet domain (nl, eu, tr, kz, ...)
+	Region string
+	// Category is the default category of symbols, whose public stream
+	// BybitWSBaseURL points at
+	Category          market.Category
 	BybitWSBaseURL    string
-	BybitAPIKey       string
-	BybitAPISecret    string
+	BybitWSPrivateURL string
+	BybitRESTBaseURL  string
+	BybitWSTradeURL   string
+	// BybitAPIKey and BybitAPISecret are the credentials of Account at load
+	// time. Use Credentials to get the current ones after a rotation.
+	BybitAPIKey    string
+	BybitAPISecret string
+	// Account is the name of the account to trade with, empty for the default
+	Account string
+	// Secrets provides the credentials of every account
+	Secrets           SecretsProvider
 	BybitTestnet      bool
 	LogLevel          string
-	ReconnectInterval int // in second
+	LogFormat         string // text or json
+	ReconnectInterval int    // in second
 	PingInterval      int
+	RecvWindow        int // in millisecond, for signed REST requests
+	Symbols           []SymbolConfig
 }
 
-// LoadConfig loads teh configuration from environment variables
+// SymbolConfig is a tracked symbol with its category and order book depth
+type SymbolConfig struct {
+	Symbol   string          `json:"symbol"`
+	Category market.Category `json:"category"`
+	Depth    int             `json:"depth"`
+}
+
+// Environments
+const (
+	EnvMainnet = "mainnet"
+	EnvTestnet = "testnet"
+	EnvDemo    = "demo"
+)
+
+// orderBookDepths are the depths of the v5 orderbook topic per category
+var orderBookDepths = map[market.Category][]int{
+	market.CategorySpot:    {1, 50, 200},
+	market.CategoryLinear:  {1, 50, 200, 500},
+	market.CategoryInverse: {1, 50, 200, 500},
+	market.CategoryOption:  {25, 100},
+}
+
+// settings is the schema of a configuration file and of each of its
+// profiles. Fields absent from the file keep their previous value.
+type settings struct {
+	Environment       string         `json:"environment"`
+	Region            string         `json:"region"`
+	WSBaseURL         string         `json:"ws_base_url"`
+	WSPrivateURL      string         `json:"ws_private_url"`
+	RESTBaseURL       string         `json:"rest_base_url"`
+	WSTradeURL        string         `json:"ws_trade_url"`
+	APIKey            string         `json:"api_key"`
+	APISecret         string         `json:"api_secret"`
+	Account           string         `json:"account"`
+	Secrets           string         `json:"secrets"` // env, file:<path> or keystore:<path>
+	LogLevel          string         `json:"log_level"`
+	LogFormat         string         `json:"log_format"`
+	ReconnectInterval int            `json:"reconnect_interval"`
+	PingInterval      int            `json:"ping_interval"`
+	RecvWindow        int            `json:"recv_window"`
+	Category          string         `json:"category"` // default category of symbols
+	Depth             int            `json:"depth"`    // default order book depth of symbols
+	Symbols           []SymbolConfig `json:"symbols"`
+}
+
+// LoadConfig loads the configuration file named by BYBIT_CONFIG, if any,
+// with the profile named by BYBIT_PROFILE, then applies the environment
 func LoadConfig() (*Config, error) {
 	// load .env file if it exist
 	err := gotenv.Load()
@@ -27,23 +103,313 @@ func LoadConfig() (*Config, error) {
 		log.Println("Warning .env file not found")
 	}
 
+	return Load(os.Getenv("BYBIT_CONFIG"), os.Getenv("BYBIT_PROFILE"))
+}
+
+// Load builds the configuration from the built-in defaults, the TOML, YAML
+// or JSON file at path (optional), the named profile (the file's "profile"
+// key, then mainnet, when empty) and the environment variables, in that
+// order. The result is validated.
+func Load(path, profile string) (*Config, error) {
+	s := settings{
+		LogLevel:          "info",
+		LogFormat:         "text",
+		ReconnectInterval: 5,
+		PingInterval:      20,
+		RecvWindow:        5000,
+		Category:          string(market.CategorySpot),
+		Depth:             50,
+	}
+
+	var profiles map[string]json.RawMessage
+	if path != "" {
+		doc, err := readFile(path)
+		if err != nil {
+			return nil, err
+		}
+		top := struct {
+			Profile  string                     `json:"profile"`
+			Profiles map[string]json.RawMessage `json:"profiles"`
+			*settings
+		}{settings: &s}
+		if err := decodeStrict(doc, &top); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if profile == "" {
+			profile = top.Profile
+		}
+		profiles = top.Profiles
+	}
+	if profile == "" {
+		profile = EnvMainnet
+	}
+
+	switch profile {
+	case EnvMainnet, EnvTestnet, EnvDemo:
+		if s.Environment == "" {
+			s.Environment = profile
+		}
+	default:
+		if _, ok := profiles[profile]; !ok {
+			return nil, fmt.Errorf("unknown profile %q", profile)
+		}
+	}
+	if raw, ok := profiles[profile]; ok {
+		if err := decodeStrict(raw, &s); err != nil {
+			return nil, fmt.Errorf("%s: profile %s: %w", path, profile, err)
+		}
+	}
+
+	e := &envReader{}
+	e.apply(&s)
+	if err := errors.Join(e.errs...); err != nil {
+		return nil, fmt.Errorf("invalid environment: %w", err)
+	}
+
+	secrets, err := newSecretsProvider(s.Secrets)
+	if err != nil {
+		return nil, err
+	}
+	if s.Secrets == "" || s.Secrets == "env" {
+		// api_key and api_secret, from the file or the environment, stay
+		// the default account
+		secrets = settingsSecrets{def: Credentials{APIKey: s.APIKey, APISecret: s.APISecret}}
+	} else if s.APIKey != "" || s.APISecret != "" {
+		return nil, fmt.Errorf("api_key and api_secret cannot be combined with secrets %q", s.Secrets)
+	}
+	creds, err := secrets.Credentials(s.Account)
+	if err != nil {
+		return nil, err
+	}
+
 	conf := &Config{
-		BybitWSBaseURL:    getEnv("BYBIT_WS_BASE_URL", "ws://stream.bybit.com/v5/public/spot"),
-		BybitAPIKey:       getEnv("BYBIT_API_KEY", ""),
-		BybitAPISecret:    getEnv("BYBIT_API_SECRET", ""),
-		BybitTestnet:      getEnv("BYBIT_TESTNET", "false") == "true",
-		LogLevel:          getEnv("LOG_LEVEL", "info"),
-		ReconnectInterval: getEnvAsInt("RECONNECT_INTERVAL", 5),
-		PingInterval:      getEnvAsInt("PIN_INTERVAL", 20),
+		Profile:           profile,
+		Environment:       s.Environment,
+		Region:            s.Region,
+		Category:          market.Category(s.Category),
+		BybitWSBaseURL:    s.WSBaseURL,
+		BybitWSPrivateURL: s.WSPrivateURL,
+		BybitRESTBaseURL:  s.RESTBaseURL,
+		BybitWSTradeURL:   s.WSTradeURL,
+		BybitAPIKey:       creds.APIKey,
+		BybitAPISecret:    creds.APISecret,
+		Account:           s.Account,
+		Secrets:           secrets,
+		BybitTestnet:      s.Environment == EnvTestnet,
+		LogLevel:          s.LogLevel,
+		LogFormat:         s.LogFormat,
+		ReconnectInterval: s.ReconnectInterval,
+		PingInterval:      s.PingInterval,
+		RecvWindow:        s.RecvWindow,
+	}
+	for _, sym := range s.Symbols {
+		if sym.Category == "" {
+			sym.Category = market.Category(s.Category)
+		}
+		if sym.Depth == 0 {
+			sym.Depth = s.Depth
+		}
+		conf.Symbols = append(conf.Symbols, sym)
 	}
 
-	//adjust URL if using testnet
-	if conf.BybitTestnet {
-		conf.BybitWSBaseURL = "ws://stream.bybit.com/v5/public/spot"
+	if err := conf.Validate(); err != nil {
+		return nil, err
 	}
+	conf.resolveEndpoints()
 	return conf, nil
 }
 
+// resolveEndpoints fills in the endpoints that were not configured
+func (c *Config) resolveEndpoints() {
+	e := c.Endpoints()
+	c.BybitRESTBaseURL = e.REST()
+	c.BybitWSBaseURL = e.PublicWS(c.Category)
+	c.BybitWSPrivateURL = e.PrivateWS()
+	// Left empty where the trade WebSocket is not available
+	c.BybitWSTradeURL, _ = e.TradeWS()
+}
+
+// Validate checks the configuration and reports every problem at once
+func (c *Config) Validate() error {
+	errs := []error{c.Endpoints().Validate()}
+	if _, ok := orderBookDepths[c.Category]; !ok {
+		errs = append(errs, fmt.Errorf("category must be spot, linear, inverse or option, got %q", c.Category))
+	}
+	switch c.LogLevel {
+	case "debug", "info", "warn", "error":
+	default:
+		errs = append(errs, fmt.Errorf("log_level must be debug, info, warn or error, got %q", c.LogLevel))
+	}
+	if c.LogFormat != "text" && c.LogFormat != "json" {
+		errs = append(errs, fmt.Errorf("log_format must be text or json, got %q", c.LogFormat))
+	}
+	if c.ReconnectInterval <= 0 {
+		errs = append(errs, fmt.Errorf("reconnect_interval must be positive, got %d", c.ReconnectInterval))
+	}
+	if c.PingInterval <= 0 {
+		errs = append(errs, fmt.Errorf("ping_interval must be positive, got %d", c.PingInterval))
+	}
+	if c.RecvWindow <= 0 || c.RecvWindow > 60000 {
+		errs = append(errs, fmt.Errorf("recv_window must be between 1 and 60000 ms, got %d", c.RecvWindow))
+	}
+	if (c.BybitAPIKey == "") != (c.BybitAPISecret == "") {
+		errs = append(errs, fmt.Errorf("api_key and api_secret must be set together"))
+	}
+	errs = append(errs, checkURL("ws_base_url", c.BybitWSBaseURL, "ws", "wss"))
+	errs = append(errs, checkURL("ws_private_url", c.BybitWSPrivateURL, "ws", "wss"))
+	errs = append(errs, checkURL("rest_base_url", c.BybitRESTBaseURL, "http", "https"))
+	errs = append(errs, checkURL("ws_trade_url", c.BybitWSTradeURL, "ws", "wss"))
+
+	seen := make(map[string]market.Category)
+	for i, s := range c.Symbols {
+		if s.Symbol == "" || strings.ToUpper(s.Symbol) != s.Symbol || strings.ContainsAny(s.Symbol, " .") {
+			errs = append(errs, fmt.Errorf("symbols[%d]: invalid symbol %q", i, s.Symbol))
+		}
+		depths, ok := orderBookDepths[s.Category]
+		if !ok {
+			errs = append(errs, fmt.Errorf("symbols[%d]: %s: invalid category %q", i, s.Symbol, s.Category))
+		} else if !containsInt(depths, s.Depth) {
+			errs = append(errs, fmt.Errorf("symbols[%d]: %s: depth %d is not available for %s, use one of %v", i, s.Symbol, s.Depth, s.Category, depths))
+		}
+		// Books, trades and candles are kept per symbol, so a symbol can
+		// only be streamed from one category
+		if category, ok := seen[s.Symbol]; ok {
+			errs = append(errs, fmt.Errorf("symbols[%d]: %s is already listed as %s", i, s.Symbol, category))
+		} else {
+			seen[s.Symbol] = s.Category
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	return nil
+}
+
+func checkURL(name, value string, schemes ...string) error {
+	if value == "" {
+		return nil
+	}
+	for _, scheme := range schemes {
+		if strings.HasPrefix(value, scheme+"://") {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s must be a %s URL, got %q", name, strings.Join(schemes, " or "), value)
+}
+
+func containsInt(values []int, v int) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// readFile reads a configuration file as JSON, converting TOML and YAML files
+func readFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return data, nil
+	case ".toml":
+		var doc map[string]interface{}
+		if err := toml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return json.Marshal(doc)
+	case ".yaml", ".yml":
+		var doc map[string]interface{}
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return json.Marshal(doc)
+	default:
+		return nil, fmt.Errorf("%s: unknown config file format, use .toml, .yaml or .json", path)
+	}
+}
+
+// decodeStrict decodes JSON and rejects unknown keys, so typos fail on startup
+func decodeStrict(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// envReader applies the environment variables on top of the file settings.
+// Legacy names from older .env files are still accepted.
+type envReader struct {
+	errs []error
+}
+
+func (e *envReader) apply(s *settings) {
+	if v := getEnv("BYBIT_TESTNET", getEnv("TESTNET_MODE", "")); v != "" {
+		testnet, err := strconv.ParseBool(v)
+		if err != nil {
+			e.errs = append(e.errs, fmt.Errorf("BYBIT_TESTNET: %w", err))
+		} else if testnet {
+			s.Environment = EnvTestnet
+		}
+	}
+	e.str(&s.Environment, "BYBIT_ENVIRONMENT")
+	e.str(&s.Region, "BYBIT_REGION")
+	e.str(&s.WSBaseURL, "BYBIT_WS_BASE_URL")
+	e.str(&s.WSPrivateURL, "BYBIT_WS_PRIVATE_URL")
+	e.str(&s.RESTBaseURL, "BYBIT_REST_BASE_URL")
+	e.str(&s.WSTradeURL, "BYBIT_WS_TRADE_URL")
+	e.str(&s.APIKey, "BYBIT_API_KEY", "API_KEY")
+	e.str(&s.APISecret, "BYBIT_API_SECRET", "API_SECRET")
+	e.str(&s.Account, "BYBIT_ACCOUNT")
+	e.str(&s.Secrets, "BYBIT_SECRETS")
+	e.str(&s.LogLevel, "LOG_LEVEL")
+	e.str(&s.LogFormat, "LOG_FORMAT")
+	e.int(&s.ReconnectInterval, "RECONNECT_INTERVAL")
+	e.int(&s.PingInterval, "PING_INTERVAL", "HEARTBEAT_INTERVAL")
+	e.int(&s.RecvWindow, "RECV_WINDOW")
+	e.str(&s.Category, "BYBIT_CATEGORY")
+	e.int(&s.Depth, "BYBIT_ORDERBOOK_DEPTH", "ORDERBOOK_DEPTH")
+
+	if v := getEnv("BYBIT_SYMBOLS", getEnv("SYMBOL", "")); v != "" {
+		s.Symbols = nil
+		for _, sym := range strings.Split(v, ",") {
+			if sym = strings.TrimSpace(sym); sym != "" {
+				s.Symbols = append(s.Symbols, SymbolConfig{Symbol: sym})
+			}
+		}
+	}
+}
+
+// str sets dst from the first of keys that is set
+func (e *envReader) str(dst *string, keys ...string) {
+	for _, key := range keys {
+		if v := os.Getenv(key); v != "" {
+			*dst = v
+			return
+		}
+	}
+}
+
+// int sets dst from the first of keys that is set
+func (e *envReader) int(dst *int, keys ...string) {
+	for _, key := range keys {
+		if os.Getenv(key) == "" {
+			continue
+		}
+		v, err := getEnvAsInt(key)
+		if err != nil {
+			e.errs = append(e.errs, err)
+		} else {
+			*dst = v
+		}
+		return
+	}
+}
+
 // getEnv gets an environmebt variable or returns a default value
 func getEnv(key, defaultValue string) string {
 	value := os.Getenv(key)
@@ -54,18 +420,11 @@ func getEnv(key, defaultValue string) string {
 	return value
 }
 
-// getEnvAsInt gets an environment variable as an integer or returns a default value
-func getEnvAsInt(key string, defaulValue int) int {
-	valueStr := getEnv(key, "")
-	if valueStr == "" {
-		return defaulValue
-	}
-
-	value := 0
-	_, err := fmt.Scanf(valueStr, "%d", &value)
+// getEnvAsInt gets an environment variable as an integer
+func getEnvAsInt(key string) (int, error) {
+	value, err := strconv.Atoi(strings.TrimSpace(os.Getenv(key)))
 	if err != nil {
-		log.Printf("warning: invalid value for %s, using default %d", key, defaulValue)
-		return defaulValue
+		return 0, fmt.Errorf("%s: invalid integer %q", key, os.Getenv(key))
 	}
-	return value
+	return value, nil
 }
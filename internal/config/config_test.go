@@ -0,0 +1,243 @@
+package config
+
+import (
+	"bybit_connector/pkg/market"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// clearEnv unsets every variable Load reads for the duration of a test
+func clearEnv(t *testing.T) {
+	for _, key := range []string{
+		"BYBIT_TESTNET", "TESTNET_MODE", "BYBIT_ENVIRONMENT", "BYBIT_REGION",
+		"BYBIT_WS_BASE_URL", "BYBIT_WS_PRIVATE_URL",
+		"BYBIT_REST_BASE_URL", "BYBIT_WS_TRADE_URL", "BYBIT_API_KEY", "API_KEY",
+		"BYBIT_API_SECRET", "API_SECRET", "LOG_LEVEL", "LOG_FORMAT", "RECONNECT_INTERVAL",
+		"PING_INTERVAL", "HEARTBEAT_INTERVAL", "RECV_WINDOW", "BYBIT_CATEGORY",
+		"BYBIT_ORDERBOOK_DEPTH", "ORDERBOOK_DEPTH", "BYBIT_SYMBOLS", "SYMBOL",
+		"BYBIT_CONFIG", "BYBIT_PROFILE", "BYBIT_ACCOUNT", "BYBIT_SECRETS",
+	} {
+		if v, ok := os.LookupEnv(key); ok {
+			os.Unsetenv(key)
+			t.Cleanup(func() { os.Setenv(key, v) })
+		}
+	}
+}
+
+func writeConfig(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadTOMLWithProfile(t *testing.T) {
+	clearEnv(t)
+	path := writeConfig(t, "config.toml", `
+profile = "testnet"
+category = "linear"
+depth = 50 # default depth
+
+symbols = [
+  { symbol = "BTCUSDT", depth = 200 },
+  { symbol = "ETHUSDT" },
+]
+
+[profiles.testnet]
+environment = "testnet"
+log_level = "debug"
+
+[profiles.sub1]
+environment = "mainnet"
+recv_window = 10_000
+`)
+
+	conf, err := Load(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Profile != "testnet" || !conf.BybitTestnet || conf.LogLevel != "debug" {
+		t.Fatalf("profile not applied: %+v", conf)
+	}
+	want := []SymbolConfig{
+		{Symbol: "BTCUSDT", Category: market.CategoryLinear, Depth: 200},
+		{Symbol: "ETHUSDT", Category: market.CategoryLinear, Depth: 50},
+	}
+	if len(conf.Symbols) != 2 || conf.Symbols[0] != want[0] || conf.Symbols[1] != want[1] {
+		t.Fatalf("unexpected symbols: %+v", conf.Symbols)
+	}
+
+	conf, err = Load(path, "sub1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Environment != EnvMainnet || conf.RecvWindow != 10000 {
+		t.Fatalf("sub1 profile not applied: %+v", conf)
+	}
+}
+
+func TestEnvOverridesFile(t *testing.T) {
+	clearEnv(t)
+	path := writeConfig(t, "config.toml", `
+[[symbols]]
+symbol = "BTCUSDT"
+`)
+	t.Setenv("BYBIT_SYMBOLS", "ETHUSDT, SOLUSDT")
+	t.Setenv("BYBIT_CATEGORY", "linear")
+	t.Setenv("BYBIT_ORDERBOOK_DEPTH", "200")
+	t.Setenv("PING_INTERVAL", "15")
+
+	conf, err := Load(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.PingInterval != 15 || len(conf.Symbols) != 2 || conf.Symbols[1].Symbol != "SOLUSDT" || conf.Symbols[1].Depth != 200 {
+		t.Fatalf("environment not applied: %+v", conf)
+	}
+}
+
+func TestLegacyEnvNames(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("SYMBOL", "BTCUSDT")
+	t.Setenv("ORDERBOOK_DEPTH", "1")
+	t.Setenv("TESTNET_MODE", "true")
+
+	conf, err := Load("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !conf.BybitTestnet || len(conf.Symbols) != 1 || conf.Symbols[0].Depth != 1 {
+		t.Fatalf("legacy variables not applied: %+v", conf)
+	}
+}
+
+func TestInvalidIntegerFails(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("RECONNECT_INTERVAL", "five")
+	if _, err := Load("", ""); err == nil || !strings.Contains(err.Error(), "RECONNECT_INTERVAL") {
+		t.Fatalf("expected an error naming RECONNECT_INTERVAL, got %v", err)
+	}
+}
+
+func TestValidationReportsEveryProblem(t *testing.T) {
+	clearEnv(t)
+	path := writeConfig(t, "config.json", `{
+		"log_level": "verbose",
+		"log_format": "xml",
+		"symbols": [
+			{"symbol": "BTCUSDT", "category": "linear", "depth": 25},
+			{"symbol": "btcusdt", "category": "spot", "depth": 50},
+			{"symbol": "ETHUSDT", "category": "futures", "depth": 50},
+			{"symbol": "BTCUSDT", "category": "spot", "depth": 50}
+		]
+	}`)
+
+	_, err := Load(path, "")
+	if err == nil {
+		t.Fatal("expected a validation error")
+	}
+	for _, want := range []string{"log_level", "log_format", "depth 25", `invalid symbol "btcusdt"`, `invalid category "futures"`, "BTCUSDT is already listed as linear"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %q: %v", want, err)
+		}
+	}
+}
+
+func TestUnknownKeysAndProfilesFail(t *testing.T) {
+	clearEnv(t)
+	path := writeConfig(t, "config.toml", "ping_intervall = 10\n")
+	if _, err := Load(path, ""); err == nil || !strings.Contains(err.Error(), "ping_intervall") {
+		t.Fatalf("expected an unknown key error, got %v", err)
+	}
+
+	path = writeConfig(t, "config.toml", "")
+	if _, err := Load(path, "staging"); err == nil {
+		t.Fatal("expected an unknown profile error")
+	}
+}
+
+func TestLoadYAML(t *testing.T) {
+	clearEnv(t)
+	path := writeConfig(t, "config.yaml", `
+profile: testnet
+category: linear
+symbols:
+  - symbol: BTCUSDT
+    depth: 200
+  - symbol: ETHUSDT
+profiles:
+  testnet:
+    environment: testnet
+    ping_interval: 10
+`)
+
+	conf, err := Load(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !conf.BybitTestnet || conf.PingInterval != 10 || len(conf.Symbols) != 2 ||
+		conf.Symbols[0].Depth != 200 || conf.Symbols[1].Category != market.CategoryLinear {
+		t.Fatalf("unexpected configuration: %+v", conf)
+	}
+
+	path = writeConfig(t, "config.yml", "ping_intervall: 10\n")
+	if _, err := Load(path, ""); err == nil || !strings.Contains(err.Error(), "ping_intervall") {
+		t.Fatalf("expected an unknown key error, got %v", err)
+	}
+	path = writeConfig(t, "config.toml", "a = 1\na = 2\n")
+	if _, err := Load(path, ""); err == nil {
+		t.Fatal("expected a duplicate key error")
+	}
+}
+
+func TestEndpoints(t *testing.T) {
+	cases := []struct {
+		e       Endpoints
+		rest    string
+		public  string
+		private string
+		trade   string
+	}{
+		{Endpoints{Environment: EnvMainnet}, "https://api.bybit.com", "wss://stream.bybit.com/v5/public/linear", "wss://stream.bybit.com/v5/private", "wss://stream.bybit.com/v5/trade"},
+		{Endpoints{Environment: EnvTestnet}, "https://api-testnet.bybit.com", "wss://stream-testnet.bybit.com/v5/public/linear", "wss://stream-testnet.bybit.com/v5/private", "wss://stream-testnet.bybit.com/v5/trade"},
+		{Endpoints{Environment: EnvDemo}, "https://api-demo.bybit.com", "wss://stream.bybit.com/v5/public/linear", "wss://stream-demo.bybit.com/v5/private", ""},
+		{Endpoints{Environment: EnvMainnet, Region: "nl"}, "https://api.bybit.nl", "wss://stream.bybit.nl/v5/public/linear", "wss://stream.bybit.nl/v5/private", "wss://stream.bybit.nl/v5/trade"},
+		{Endpoints{Environment: EnvTestnet, RESTBaseURL: "http://127.0.0.1:9000/", PublicWSURL: "ws://127.0.0.1:9001/v5/public/spot"}, "http://127.0.0.1:9000", "ws://127.0.0.1:9001/v5/public/linear", "wss://stream-testnet.bybit.com/v5/private", "wss://stream-testnet.bybit.com/v5/trade"},
+	}
+	for _, c := range cases {
+		trade, _ := c.e.TradeWS()
+		if got := c.e.REST(); got != c.rest {
+			t.Errorf("%+v: REST() = %s, want %s", c.e, got, c.rest)
+		}
+		if got := c.e.PublicWS(market.CategoryLinear); got != c.public {
+			t.Errorf("%+v: PublicWS() = %s, want %s", c.e, got, c.public)
+		}
+		if got := c.e.PrivateWS(); got != c.private {
+			t.Errorf("%+v: PrivateWS() = %s, want %s", c.e, got, c.private)
+		}
+		if trade != c.trade {
+			t.Errorf("%+v: TradeWS() = %s, want %s", c.e, trade, c.trade)
+		}
+	}
+
+	if err := (Endpoints{Environment: EnvTestnet, Region: "nl"}).Validate(); err == nil {
+		t.Error("expected regions to be rejected outside mainnet")
+	}
+}
+
+func TestLoadResolvesTestnetEndpoints(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("BYBIT_ENVIRONMENT", "testnet")
+	t.Setenv("BYBIT_CATEGORY", "linear")
+
+	conf, err := Load("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.BybitWSBaseURL != "wss://stream-testnet.bybit.com/v5/public/linear" || conf.BybitRESTBaseURL != "https://api-testnet.bybit.com" {
+		t.Fatalf("unexpected endpoints: %s %s", conf.BybitWSBaseURL, conf.BybitRESTBaseURL)
+	}
+}
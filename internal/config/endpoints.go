@@ -0,0 +1,130 @@
+package config
+
+import (
+	"bybit_connector/pkg/market"
+	"fmt"
+	"strings"
+)
+
+// regionDomains are the mainnet domains Bybit serves to regional entities
+var regionDomains = map[string]string{
+	"":       "bybit.com",
+	"bytick": "bytick.com", // alternative global domain
+	"nl":     "bybit.nl",
+	"eu":     "bybit.eu",
+	"tr":     "bybit-tr.com",
+	"kz":     "bybit.kz",
+	"ge":     "bybitgeorgia.ge",
+	"ae":     "bybit.ae",
+	"hk":     "byhkbit.com",
+}
+
+// Endpoints resolves the REST and WebSocket URLs of an environment. Any
+// non-empty override wins over the resolved URL, which lets tests point
+// the clients at local stand-ins.
+type Endpoints struct {
+	Environment string // mainnet, testnet or demo
+	Region      string // regional mainnet domain, see regionDomains
+
+	RESTBaseURL string
+	// PublicWSURL is the public stream base, e.g. ws://127.0.0.1:8080/v5/public.
+	// A trailing category segment is replaced by the requested category.
+	PublicWSURL  string
+	PrivateWSURL string
+	TradeWSURL   string
+}
+
+// Endpoints returns the endpoint resolver of the configuration
+func (c *Config) Endpoints() Endpoints {
+	return Endpoints{
+		Environment:  c.Environment,
+		Region:       c.Region,
+		RESTBaseURL:  c.BybitRESTBaseURL,
+		PublicWSURL:  c.BybitWSBaseURL,
+		PrivateWSURL: c.BybitWSPrivateURL,
+		TradeWSURL:   c.BybitWSTradeURL,
+	}
+}
+
+// Validate checks that the environment and region are known
+func (e Endpoints) Validate() error {
+	switch e.Environment {
+	case EnvMainnet, EnvTestnet, EnvDemo:
+	default:
+		return fmt.Errorf("environment must be mainnet, testnet or demo, got %q", e.Environment)
+	}
+	if _, ok := regionDomains[e.Region]; !ok {
+		return fmt.Errorf("unknown region %q", e.Region)
+	}
+	if e.Region != "" && e.Environment != EnvMainnet {
+		return fmt.Errorf("region %q is only available on mainnet", e.Region)
+	}
+	return nil
+}
+
+// REST returns the REST base URL
+func (e Endpoints) REST() string {
+	if e.RESTBaseURL != "" {
+		return strings.TrimSuffix(e.RESTBaseURL, "/")
+	}
+	switch e.Environment {
+	case EnvTestnet:
+		return "https://api-testnet.bybit.com"
+	case EnvDemo:
+		return "https://api-demo.bybit.com"
+	}
+	return "https://api." + e.domain()
+}
+
+// PublicWS returns the public stream URL of a category. Demo trading has
+// no public streams of its own and uses mainnet market data.
+func (e Endpoints) PublicWS(category market.Category) string {
+	if e.PublicWSURL != "" {
+		base := strings.TrimSuffix(e.PublicWSURL, "/")
+		if i := strings.LastIndex(base, "/"); i >= 0 {
+			if _, err := market.ParseCategory(base[i+1:]); err == nil {
+				base = base[:i]
+			}
+		}
+		return base + "/" + string(category)
+	}
+	return e.streamHost(false) + "/v5/public/" + string(category)
+}
+
+// PrivateWS returns the private stream URL
+func (e Endpoints) PrivateWS() string {
+	if e.PrivateWSURL != "" {
+		return e.PrivateWSURL
+	}
+	return e.streamHost(true) + "/v5/private"
+}
+
+// TradeWS returns the order entry WebSocket URL. Demo trading does not
+// support it.
+func (e Endpoints) TradeWS() (string, error) {
+	if e.TradeWSURL != "" {
+		return e.TradeWSURL, nil
+	}
+	if e.Environment == EnvDemo {
+		return "", fmt.Errorf("the trade websocket is not available on demo trading")
+	}
+	return e.streamHost(false) + "/v5/trade", nil
+}
+
+// streamHost returns the WebSocket host. Only private streams have a demo host.
+func (e Endpoints) streamHost(private bool) string {
+	switch {
+	case e.Environment == EnvTestnet:
+		return "wss://stream-testnet.bybit.com"
+	case e.Environment == EnvDemo && private:
+		return "wss://stream-demo.bybit.com"
+	}
+	return "wss://stream." + e.domain()
+}
+
+func (e Endpoints) domain() string {
+	if d, ok := regionDomains[e.Region]; ok && e.Environment == EnvMainnet {
+		return d
+	}
+	return regionDomains[""]
+}
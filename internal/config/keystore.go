@@ -0,0 +1,145 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// keystoreIterations is the PBKDF2-SHA256 work factor of new keystores
+const keystoreIterations = 600000
+
+// keystoreFile is the on-disk format of an encrypted keystore. The
+// plaintext is the JSON account map of FileSecrets, sealed with AES-256-GCM
+// under a key derived from the passphrase.
+type keystoreFile struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// KeystoreSecrets reads credentials from a keystore written by
+// WriteKeystore, unlocked with a passphrase. Like FileSecrets it is read
+// again whenever the file changes.
+type KeystoreSecrets struct {
+	Path       string
+	Passphrase string
+
+	mu       sync.Mutex
+	modTime  time.Time
+	accounts map[string]Credentials
+}
+
+// Credentials implements SecretsProvider
+func (k *KeystoreSecrets) Credentials(account string) (Credentials, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	info, err := os.Stat(k.Path)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("failed to read keystore: %w", err)
+	}
+	if err := checkPrivate(k.Path, info); err != nil {
+		return Credentials{}, err
+	}
+	if k.accounts == nil || !info.ModTime().Equal(k.modTime) {
+		accounts, err := ReadKeystore(k.Path, k.Passphrase)
+		if err != nil {
+			return Credentials{}, err
+		}
+		k.accounts = accounts
+		k.modTime = info.ModTime()
+	}
+	return lookupAccount(k.accounts, account)
+}
+
+// ReadKeystore decrypts a keystore
+func ReadKeystore(path, passphrase string) (map[string]Credentials, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keystore: %w", err)
+	}
+	var ks keystoreFile
+	if err := json.Unmarshal(data, &ks); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if ks.Version != 1 || ks.KDF != "pbkdf2-sha256" || ks.Iterations <= 0 {
+		return nil, fmt.Errorf("%s: unsupported keystore version %d (%s)", path, ks.Version, ks.KDF)
+	}
+
+	gcm, err := newKeystoreCipher(passphrase, ks.Salt, ks.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, ks.Nonce, ks.Ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: wrong passphrase or corrupt keystore", path)
+	}
+
+	var accounts map[string]Credentials
+	if err := json.Unmarshal(plaintext, &accounts); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return accounts, nil
+}
+
+// WriteKeystore encrypts accounts into a keystore readable only by the owner
+func WriteKeystore(path, passphrase string, accounts map[string]Credentials) error {
+	return writeKeystore(path, passphrase, accounts, keystoreIterations)
+}
+
+func writeKeystore(path, passphrase string, accounts map[string]Credentials, iterations int) error {
+	if passphrase == "" {
+		return fmt.Errorf("keystore passphrase must not be empty")
+	}
+	plaintext, err := json.Marshal(accounts)
+	if err != nil {
+		return fmt.Errorf("failed to encode keystore: %w", err)
+	}
+
+	ks := keystoreFile{Version: 1, KDF: "pbkdf2-sha256", Iterations: iterations, Salt: make([]byte, 16)}
+	if _, err := rand.Read(ks.Salt); err != nil {
+		return fmt.Errorf("failed to generate salt: %w", err)
+	}
+	gcm, err := newKeystoreCipher(passphrase, ks.Salt, iterations)
+	if err != nil {
+		return err
+	}
+	ks.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(ks.Nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	ks.Ciphertext = gcm.Seal(nil, ks.Nonce, plaintext, nil)
+
+	data, err := json.MarshalIndent(ks, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode keystore: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write keystore: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write keystore: %w", err)
+	}
+	return nil
+}
+
+func newKeystoreCipher(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(pbkdf2.Key([]byte(passphrase), salt, iterations, 32, sha256.New))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create keystore cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,208 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Credentials is an API key pair
+type Credentials struct {
+	APIKey    string `json:"api_key"`
+	APISecret string `json:"api_secret"`
+}
+
+// IsZero reports whether no key is set
+func (c Credentials) IsZero() bool {
+	return c.APIKey == "" && c.APISecret == ""
+}
+
+// SecretsProvider returns the credentials of a named account. The empty
+// name is the default account. Providers are queried again on rotation,
+// so they must return the current credentials on every call.
+type SecretsProvider interface {
+	Credentials(account string) (Credentials, error)
+}
+
+// EnvSecrets reads credentials from the environment: BYBIT_API_KEY and
+// BYBIT_API_SECRET for the default account, BYBIT_<ACCOUNT>_API_KEY and
+// BYBIT_<ACCOUNT>_API_SECRET for a named one.
+type EnvSecrets struct{}
+
+// Credentials implements SecretsProvider
+func (EnvSecrets) Credentials(account string) (Credentials, error) {
+	if account == "" {
+		return Credentials{
+			APIKey:    getEnv("BYBIT_API_KEY", os.Getenv("API_KEY")),
+			APISecret: getEnv("BYBIT_API_SECRET", os.Getenv("API_SECRET")),
+		}, nil
+	}
+	prefix := "BYBIT_" + strings.ToUpper(strings.ReplaceAll(account, "-", "_")) + "_"
+	c := Credentials{APIKey: os.Getenv(prefix + "API_KEY"), APISecret: os.Getenv(prefix + "API_SECRET")}
+	if c.IsZero() {
+		return Credentials{}, fmt.Errorf("no credentials for account %q in %sAPI_KEY", account, prefix)
+	}
+	return c, nil
+}
+
+// settingsSecrets serves the api_key and api_secret settings as the
+// default account and named accounts from the environment
+type settingsSecrets struct {
+	def Credentials
+}
+
+// Credentials implements SecretsProvider
+func (s settingsSecrets) Credentials(account string) (Credentials, error) {
+	if account == "" {
+		return s.def, nil
+	}
+	return EnvSecrets{}.Credentials(account)
+}
+
+// FileSecrets reads credentials from a JSON file mapping account names to
+// key pairs ("default" is the default account):
+//
+//	{"default": {"api_key": "...", "api_secret": "..."}, "sub1": {...}}
+//
+// The file must not be readable by group or others. It is read again
+// whenever it changes, so keys can be rotated by replacing it.
+type FileSecrets struct {
+	Path string
+
+	mu       sync.Mutex
+	modTime  time.Time
+	accounts map[string]Credentials
+}
+
+// Credentials implements SecretsProvider
+func (f *FileSecrets) Credentials(account string) (Credentials, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info, err := os.Stat(f.Path)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("failed to read secrets file: %w", err)
+	}
+	if err := checkPrivate(f.Path, info); err != nil {
+		return Credentials{}, err
+	}
+	if f.accounts == nil || !info.ModTime().Equal(f.modTime) {
+		data, err := os.ReadFile(f.Path)
+		if err != nil {
+			return Credentials{}, fmt.Errorf("failed to read secrets file: %w", err)
+		}
+		var accounts map[string]Credentials
+		if err := json.Unmarshal(data, &accounts); err != nil {
+			return Credentials{}, fmt.Errorf("%s: %w", f.Path, err)
+		}
+		f.accounts = accounts
+		f.modTime = info.ModTime()
+	}
+	return lookupAccount(f.accounts, account)
+}
+
+// checkPrivate refuses secret files that group or others can access
+func checkPrivate(path string, info os.FileInfo) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	if perm := info.Mode().Perm(); perm&0o077 != 0 {
+		return fmt.Errorf("%s: permissions %04o are too open, run chmod 600 %s", path, perm, path)
+	}
+	return nil
+}
+
+func lookupAccount(accounts map[string]Credentials, account string) (Credentials, error) {
+	name := account
+	if name == "" {
+		name = "default"
+	}
+	c, ok := accounts[name]
+	if !ok {
+		return Credentials{}, fmt.Errorf("no credentials for account %q", name)
+	}
+	return c, nil
+}
+
+// newSecretsProvider creates the provider named by a secrets setting:
+// "env", "file:<path>" or "keystore:<path>". The keystore passphrase is
+// read from BYBIT_KEYSTORE_PASSPHRASE or the file named by
+// BYBIT_KEYSTORE_PASSPHRASE_FILE.
+func newSecretsProvider(spec string) (SecretsProvider, error) {
+	kind, path, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "", "env":
+		return EnvSecrets{}, nil
+	case "file":
+		if path == "" {
+			return nil, fmt.Errorf("secrets: missing path in %q", spec)
+		}
+		return &FileSecrets{Path: path}, nil
+	case "keystore":
+		if path == "" {
+			return nil, fmt.Errorf("secrets: missing path in %q", spec)
+		}
+		passphrase := os.Getenv("BYBIT_KEYSTORE_PASSPHRASE")
+		if file := os.Getenv("BYBIT_KEYSTORE_PASSPHRASE_FILE"); file != "" {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("secrets: failed to read passphrase file: %w", err)
+			}
+			passphrase = strings.TrimRight(string(data), "\r\n")
+		}
+		if passphrase == "" {
+			return nil, fmt.Errorf("secrets: keystore %s needs BYBIT_KEYSTORE_PASSPHRASE or BYBIT_KEYSTORE_PASSPHRASE_FILE", path)
+		}
+		return &KeystoreSecrets{Path: path, Passphrase: passphrase}, nil
+	default:
+		return nil, fmt.Errorf("secrets must be env, file:<path> or keystore:<path>, got %q", spec)
+	}
+}
+
+// Credentials returns the credentials of an account, or of the configured
+// account when empty
+func (c *Config) Credentials(account string) (Credentials, error) {
+	if account == "" {
+		account = c.Account
+	}
+	if c.Secrets == nil {
+		return Credentials{APIKey: c.BybitAPIKey, APISecret: c.BybitAPISecret}, nil
+	}
+	return c.Secrets.Credentials(account)
+}
+
+// WatchCredentials polls a provider every interval and calls onChange when
+// the credentials of the account change, until the context is done.
+// Errors are passed to onError, when set, and the old credentials are kept.
+func WatchCredentials(ctx context.Context, p SecretsProvider, account string, interval time.Duration, onChange func(Credentials), onError func(error)) {
+	current, err := p.Credentials(account)
+	if err != nil && onError != nil {
+		onError(err)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			next, err := p.Credentials(account)
+			if err != nil {
+				if onError != nil {
+					onError(err)
+				}
+				continue
+			}
+			if next != current {
+				current = next
+				onChange(next)
+			}
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileSecretsChecksPermissionsAndReloads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.json")
+	os.WriteFile(path, []byte(`{"default":{"api_key":"k1","api_secret":"s1"},"sub1":{"api_key":"k2","api_secret":"s2"}}`), 0o644)
+
+	f := &FileSecrets{Path: path}
+	if _, err := f.Credentials(""); err == nil || !strings.Contains(err.Error(), "too open") {
+		t.Fatalf("expected a permission error, got %v", err)
+	}
+
+	os.Chmod(path, 0o600)
+	c, err := f.Credentials("sub1")
+	if err != nil || c.APIKey != "k2" {
+		t.Fatalf("unexpected credentials %+v: %v", c, err)
+	}
+	if _, err := f.Credentials("sub2"); err == nil {
+		t.Fatal("expected an error for an unknown account")
+	}
+
+	os.WriteFile(path, []byte(`{"default":{"api_key":"k3","api_secret":"s3"}}`), 0o600)
+	later := time.Now().Add(time.Second)
+	os.Chtimes(path, later, later)
+	if c, _ := f.Credentials(""); c.APIKey != "k3" {
+		t.Fatalf("rotated key not picked up: %+v", c)
+	}
+}
+
+func TestKeystoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	accounts := map[string]Credentials{"default": {APIKey: "k", APISecret: "s"}}
+	if err := writeKeystore(path, "hunter2", accounts, 1000); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, _ := os.ReadFile(path)
+	if strings.Contains(string(raw), `"s"`) || strings.Contains(string(raw), "api_secret") {
+		t.Fatal("keystore contains plaintext secrets")
+	}
+
+	k := &KeystoreSecrets{Path: path, Passphrase: "hunter2"}
+	if c, err := k.Credentials(""); err != nil || c.APISecret != "s" {
+		t.Fatalf("unexpected credentials %+v: %v", c, err)
+	}
+
+	wrong := &KeystoreSecrets{Path: path, Passphrase: "hunter3"}
+	if _, err := wrong.Credentials(""); err == nil || !strings.Contains(err.Error(), "wrong passphrase") {
+		t.Fatalf("expected a passphrase error, got %v", err)
+	}
+}
+
+func TestEnvSecretsNamedAccount(t *testing.T) {
+	t.Setenv("BYBIT_SUB_1_API_KEY", "k")
+	t.Setenv("BYBIT_SUB_1_API_SECRET", "s")
+	if c, err := (EnvSecrets{}).Credentials("sub-1"); err != nil || c.APIKey != "k" {
+		t.Fatalf("unexpected credentials %+v: %v", c, err)
+	}
+}
+
+func TestLoadWithSecretsFile(t *testing.T) {
+	clearEnv(t)
+	secrets := filepath.Join(t.TempDir(), "secrets.json")
+	os.WriteFile(secrets, []byte(`{"sub1":{"api_key":"k","api_secret":"s"}}`), 0o600)
+	t.Setenv("BYBIT_SECRETS", "file:"+secrets)
+	t.Setenv("BYBIT_ACCOUNT", "sub1")
+
+	conf, err := Load("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.BybitAPIKey != "k" || conf.Account != "sub1" {
+		t.Fatalf("credentials not loaded: %+v", conf)
+	}
+
+	t.Setenv("BYBIT_API_KEY", "plain")
+	t.Setenv("BYBIT_API_SECRET", "plain")
+	if _, err := Load("", ""); err == nil {
+		t.Fatal("expected plain keys to be rejected together with a secrets file")
+	}
+}
+
+type sequenceSecrets struct {
+	keys chan string
+}
+
+func (s sequenceSecrets) Credentials(string) (Credentials, error) {
+	return Credentials{APIKey: <-s.keys, APISecret: "s"}, nil
+}
+
+func TestWatchCredentials(t *testing.T) {
+	p := sequenceSecrets{keys: make(chan string, 3)}
+	p.keys <- "k1"
+	p.keys <- "k1"
+	p.keys <- "k2"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changed := make(chan Credentials, 1)
+	go WatchCredentials(ctx, p, "", time.Millisecond, func(c Credentials) { changed <- c }, nil)
+
+	select {
+	case c := <-changed:
+		if c.APIKey != "k2" {
+			t.Fatalf("unexpected rotation to %+v", c)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("rotation not reported")
+	}
+}
@@ -0,0 +1,203 @@
+package config
+
+import (
+	"bybit_connector/pkg/logging"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Watcher reloads the configuration when its file changes or the process
+// receives SIGHUP. Only the symbol list and the log level take effect
+// without a restart; other changes are reported by RestartRequired.
+type Watcher struct {
+	Path    string
+	Profile string
+	// Interval is how often the file's modification time is checked
+	Interval time.Duration
+	// OnReload is called with the previous and the new configuration
+	OnReload func(old, new *Config)
+	OnError  func(error)
+	// Logger receives the reload records. The default logger is used when
+	// it is nil.
+	Logger *slog.Logger
+
+	mu      sync.Mutex
+	current *Config
+	modTime time.Time
+}
+
+// NewWatcher creates a watcher of the file at path, starting from current
+func NewWatcher(path, profile string, current *Config) *Watcher {
+	w := &Watcher{Path: path, Profile: profile, Interval: 2 * time.Second, current: current}
+	if info, err := os.Stat(path); err == nil {
+		w.modTime = info.ModTime()
+	}
+	return w
+}
+
+// Current returns the configuration in effect
+func (w *Watcher) Current() *Config {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.current
+}
+
+// Run watches the file and SIGHUP until the context is done
+func (w *Watcher) Run(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			w.reload()
+		case <-ticker.C:
+			info, err := os.Stat(w.Path)
+			if err != nil {
+				continue
+			}
+			w.mu.Lock()
+			changed := !info.ModTime().Equal(w.modTime)
+			w.modTime = info.ModTime()
+			w.mu.Unlock()
+			if changed {
+				w.reload()
+			}
+		}
+	}
+}
+
+func (w *Watcher) reload() {
+	if err := w.Reload(); err != nil && w.OnError != nil {
+		w.OnError(err)
+	}
+}
+
+// Reload loads the file again. An invalid file leaves the running
+// configuration in place and returns the error. Settings listed by
+// RestartRequired keep their running value until the process restarts.
+func (w *Watcher) Reload() error {
+	loaded, err := Load(w.Path, w.Profile)
+	if err != nil {
+		return fmt.Errorf("config reload: %w", err)
+	}
+
+	w.mu.Lock()
+	old := w.current
+	fields := RestartRequired(old, loaded)
+	next := keepRestartRequired(old, loaded)
+	w.current = next
+	w.mu.Unlock()
+
+	logger := logging.Or(w.Logger)
+	logger.Info("Config reloaded", "config", next.String())
+	if len(fields) > 0 {
+		logger.Warn("Config changes take effect after a restart", "fields", strings.Join(fields, ","))
+	}
+	if w.OnReload != nil {
+		w.OnReload(old, next)
+	}
+	return nil
+}
+
+// RestartRequired lists the settings that differ between two
+// configurations and cannot be applied to running connections
+func RestartRequired(old, new *Config) []string {
+	var fields []string
+	check := func(name string, changed bool) {
+		if changed {
+			fields = append(fields, name)
+		}
+	}
+	check("environment", old.Environment != new.Environment)
+	check("region", old.Region != new.Region)
+	check("ws_base_url", old.BybitWSBaseURL != new.BybitWSBaseURL)
+	check("ws_private_url", old.BybitWSPrivateURL != new.BybitWSPrivateURL)
+	check("rest_base_url", old.BybitRESTBaseURL != new.BybitRESTBaseURL)
+	check("ws_trade_url", old.BybitWSTradeURL != new.BybitWSTradeURL)
+	check("account", old.Account != new.Account)
+	check("ping_interval", old.PingInterval != new.PingInterval)
+	check("reconnect_interval", old.ReconnectInterval != new.ReconnectInterval)
+	check("recv_window", old.RecvWindow != new.RecvWindow)
+	check("log_format", old.LogFormat != new.LogFormat)
+	return fields
+}
+
+// keepRestartRequired returns a copy of next with the settings listed by
+// RestartRequired, and those derived from them, taken from old
+func keepRestartRequired(old, next *Config) *Config {
+	kept := *next
+	kept.Environment, kept.Region, kept.BybitTestnet = old.Environment, old.Region, old.BybitTestnet
+	// The public stream URL points at the default category
+	kept.Category = old.Category
+	kept.BybitWSBaseURL = old.BybitWSBaseURL
+	kept.BybitWSPrivateURL = old.BybitWSPrivateURL
+	kept.BybitRESTBaseURL = old.BybitRESTBaseURL
+	kept.BybitWSTradeURL = old.BybitWSTradeURL
+	if old.Account != next.Account {
+		kept.Account, kept.BybitAPIKey, kept.BybitAPISecret = old.Account, old.BybitAPIKey, old.BybitAPISecret
+	}
+	kept.PingInterval = old.PingInterval
+	kept.ReconnectInterval = old.ReconnectInterval
+	kept.RecvWindow = old.RecvWindow
+	kept.LogFormat = old.LogFormat
+	return &kept
+}
+
+// DiffSymbols returns the symbols to subscribe and to unsubscribe to go
+// from old to new. A symbol whose depth changed appears in both.
+func DiffSymbols(old, new []SymbolConfig) (added, removed []SymbolConfig) {
+	key := func(s SymbolConfig) string { return string(s.Category) + ":" + s.Symbol }
+	before := make(map[string]SymbolConfig, len(old))
+	for _, s := range old {
+		before[key(s)] = s
+	}
+	after := make(map[string]SymbolConfig, len(new))
+	for _, s := range new {
+		after[key(s)] = s
+		if prev, ok := before[key(s)]; !ok || prev != s {
+			added = append(added, s)
+		}
+	}
+	for _, s := range old {
+		if next, ok := after[key(s)]; !ok || next != s {
+			removed = append(removed, s)
+		}
+	}
+	return added, removed
+}
+
+// String describes the effective configuration with credentials redacted
+func (c *Config) String() string {
+	symbols := make([]string, 0, len(c.Symbols))
+	for _, s := range c.Symbols {
+		symbols = append(symbols, fmt.Sprintf("%s:%s@%d", s.Category, s.Symbol, s.Depth))
+	}
+	key := "unset"
+	if c.BybitAPIKey != "" {
+		key = redact(c.BybitAPIKey)
+	}
+	return fmt.Sprintf("profile=%s environment=%s rest=%s ws=%s account=%q api_key=%s log_level=%s log_format=%s symbols=[%s]",
+		c.Profile, c.Environment, c.BybitRESTBaseURL, c.BybitWSBaseURL, c.Account, key, c.LogLevel, c.LogFormat, strings.Join(symbols, " "))
+}
+
+// redact keeps the last 4 characters of a key
+func redact(s string) string {
+	if len(s) <= 4 {
+		return "****"
+	}
+	return "****" + s[len(s)-4:]
+}
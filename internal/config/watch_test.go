@@ -0,0 +1,72 @@
+package config
+
+import (
+	"bybit_connector/pkg/market"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiffSymbols(t *testing.T) {
+	old := []SymbolConfig{
+		{Symbol: "BTCUSDT", Category: market.CategoryLinear, Depth: 50},
+		{Symbol: "ETHUSDT", Category: market.CategoryLinear, Depth: 50},
+	}
+	new := []SymbolConfig{
+		{Symbol: "BTCUSDT", Category: market.CategoryLinear, Depth: 50},
+		{Symbol: "ETHUSDT", Category: market.CategoryLinear, Depth: 200},
+		{Symbol: "SOLUSDT", Category: market.CategoryLinear, Depth: 50},
+	}
+
+	added, removed := DiffSymbols(old, new)
+	if len(added) != 2 || added[0].Symbol != "ETHUSDT" || added[1].Symbol != "SOLUSDT" {
+		t.Fatalf("unexpected added: %+v", added)
+	}
+	if len(removed) != 1 || removed[0].Depth != 50 {
+		t.Fatalf("unexpected removed: %+v", removed)
+	}
+}
+
+func TestWatcherReload(t *testing.T) {
+	clearEnv(t)
+	path := filepath.Join(t.TempDir(), "config.toml")
+	os.WriteFile(path, []byte("symbols = [{ symbol = \"BTCUSDT\" }]\n"), 0o600)
+	conf, err := Load(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := NewWatcher(path, "", conf)
+	var reloaded *Config
+	w.OnReload = func(old, new *Config) { reloaded = new }
+
+	os.WriteFile(path, []byte("symbols = [{ symbol = \"BTCUSDT\" }, { symbol = \"ETHUSDT\" }]\n"), 0o600)
+	if err := w.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded == nil || len(reloaded.Symbols) != 2 || w.Current() != reloaded {
+		t.Fatalf("reload not applied: %+v", reloaded)
+	}
+
+	// Endpoints and intervals keep their running values until a restart
+	os.WriteFile(path, []byte("environment = \"testnet\"\nping_interval = 5\nsymbols = [{ symbol = \"BTCUSDT\" }]\n"), 0o600)
+	if err := w.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if len(reloaded.Symbols) != 1 || reloaded.Environment != conf.Environment || reloaded.PingInterval != conf.PingInterval ||
+		reloaded.Endpoints() != conf.Endpoints() {
+		t.Fatalf("restart-only settings applied on reload: %s", reloaded)
+	}
+	if fields := RestartRequired(conf, reloaded); len(fields) != 0 {
+		t.Fatalf("expected every restart-only setting to be kept, got %v", fields)
+	}
+	reloaded = w.Current()
+
+	os.WriteFile(path, []byte("depth = 7\nsymbols = [{ symbol = \"BTCUSDT\" }]\n"), 0o600)
+	if err := w.Reload(); err == nil {
+		t.Fatal("expected an invalid file to be rejected")
+	}
+	if w.Current() != reloaded {
+		t.Fatal("an invalid file replaced the running configuration")
+	}
+}
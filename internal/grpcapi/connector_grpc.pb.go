@@ -0,0 +1,498 @@
+// Market data and order entry API of the connector.
+//
+// Clients generate their stubs from this file, as does the Go server
+// (connector.pb.go and connector_grpc.pb.go, see go generate in
+// internal/grpcapi). Field numbers and types are the wire contract.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: connector.proto
+
+package grpcapi
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	MarketData_StreamOrderBooks_FullMethodName = "/bybit.connector.v1.MarketData/StreamOrderBooks"
+	MarketData_StreamTickers_FullMethodName    = "/bybit.connector.v1.MarketData/StreamTickers"
+	MarketData_StreamTrades_FullMethodName     = "/bybit.connector.v1.MarketData/StreamTrades"
+)
+
+// MarketDataClient is the client API for MarketData service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// MarketData streams the state of the connector's local books and the
+// public trades it receives. Book and ticker streams are conflated: a slow
+// reader gets the latest state of each symbol, not every intermediate one.
+// Trade streams are not conflated and are ended with RESOURCE_EXHAUSTED
+// when the reader falls too far behind.
+type MarketDataClient interface {
+	// StreamOrderBooks sends the current book of each symbol, then the book
+	// again after every update
+	StreamOrderBooks(ctx context.Context, in *StreamRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[OrderBook], error)
+	// StreamTickers sends the best bid and offer of each symbol's local
+	// book and the exchange tickers as they change
+	StreamTickers(ctx context.Context, in *StreamRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Ticker], error)
+	// StreamTrades sends public trades as they are received
+	StreamTrades(ctx context.Context, in *StreamRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Trade], error)
+}
+
+type marketDataClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewMarketDataClient(cc grpc.ClientConnInterface) MarketDataClient {
+	return &marketDataClient{cc}
+}
+
+func (c *marketDataClient) StreamOrderBooks(ctx context.Context, in *StreamRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[OrderBook], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &MarketData_ServiceDesc.Streams[0], MarketData_StreamOrderBooks_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamRequest, OrderBook]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MarketData_StreamOrderBooksClient = grpc.ServerStreamingClient[OrderBook]
+
+func (c *marketDataClient) StreamTickers(ctx context.Context, in *StreamRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Ticker], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &MarketData_ServiceDesc.Streams[1], MarketData_StreamTickers_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamRequest, Ticker]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MarketData_StreamTickersClient = grpc.ServerStreamingClient[Ticker]
+
+func (c *marketDataClient) StreamTrades(ctx context.Context, in *StreamRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Trade], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &MarketData_ServiceDesc.Streams[2], MarketData_StreamTrades_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamRequest, Trade]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MarketData_StreamTradesClient = grpc.ServerStreamingClient[Trade]
+
+// MarketDataServer is the server API for MarketData service.
+// All implementations must embed UnimplementedMarketDataServer
+// for forward compatibility.
+//
+// MarketData streams the state of the connector's local books and the
+// public trades it receives. Book and ticker streams are conflated: a slow
+// reader gets the latest state of each symbol, not every intermediate one.
+// Trade streams are not conflated and are ended with RESOURCE_EXHAUSTED
+// when the reader falls too far behind.
+type MarketDataServer interface {
+	// StreamOrderBooks sends the current book of each symbol, then the book
+	// again after every update
+	StreamOrderBooks(*StreamRequest, grpc.ServerStreamingServer[OrderBook]) error
+	// StreamTickers sends the best bid and offer of each symbol's local
+	// book and the exchange tickers as they change
+	StreamTickers(*StreamRequest, grpc.ServerStreamingServer[Ticker]) error
+	// StreamTrades sends public trades as they are received
+	StreamTrades(*StreamRequest, grpc.ServerStreamingServer[Trade]) error
+	mustEmbedUnimplementedMarketDataServer()
+}
+
+// UnimplementedMarketDataServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedMarketDataServer struct{}
+
+func (UnimplementedMarketDataServer) StreamOrderBooks(*StreamRequest, grpc.ServerStreamingServer[OrderBook]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamOrderBooks not implemented")
+}
+func (UnimplementedMarketDataServer) StreamTickers(*StreamRequest, grpc.ServerStreamingServer[Ticker]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamTickers not implemented")
+}
+func (UnimplementedMarketDataServer) StreamTrades(*StreamRequest, grpc.ServerStreamingServer[Trade]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamTrades not implemented")
+}
+func (UnimplementedMarketDataServer) mustEmbedUnimplementedMarketDataServer() {}
+func (UnimplementedMarketDataServer) testEmbeddedByValue()                    {}
+
+// UnsafeMarketDataServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to MarketDataServer will
+// result in compilation errors.
+type UnsafeMarketDataServer interface {
+	mustEmbedUnimplementedMarketDataServer()
+}
+
+func RegisterMarketDataServer(s grpc.ServiceRegistrar, srv MarketDataServer) {
+	// If the following call pancis, it indicates UnimplementedMarketDataServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&MarketData_ServiceDesc, srv)
+}
+
+func _MarketData_StreamOrderBooks_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MarketDataServer).StreamOrderBooks(m, &grpc.GenericServerStream[StreamRequest, OrderBook]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MarketData_StreamOrderBooksServer = grpc.ServerStreamingServer[OrderBook]
+
+func _MarketData_StreamTickers_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MarketDataServer).StreamTickers(m, &grpc.GenericServerStream[StreamRequest, Ticker]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MarketData_StreamTickersServer = grpc.ServerStreamingServer[Ticker]
+
+func _MarketData_StreamTrades_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MarketDataServer).StreamTrades(m, &grpc.GenericServerStream[StreamRequest, Trade]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MarketData_StreamTradesServer = grpc.ServerStreamingServer[Trade]
+
+// MarketData_ServiceDesc is the grpc.ServiceDesc for MarketData service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var MarketData_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "bybit.connector.v1.MarketData",
+	HandlerType: (*MarketDataServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamOrderBooks",
+			Handler:       _MarketData_StreamOrderBooks_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "StreamTickers",
+			Handler:       _MarketData_StreamTickers_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "StreamTrades",
+			Handler:       _MarketData_StreamTrades_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "connector.proto",
+}
+
+const (
+	Trading_PlaceOrder_FullMethodName     = "/bybit.connector.v1.Trading/PlaceOrder"
+	Trading_CancelOrder_FullMethodName    = "/bybit.connector.v1.Trading/CancelOrder"
+	Trading_ListOpenOrders_FullMethodName = "/bybit.connector.v1.Trading/ListOpenOrders"
+	Trading_ListExecutions_FullMethodName = "/bybit.connector.v1.Trading/ListExecutions"
+	Trading_ListPositions_FullMethodName  = "/bybit.connector.v1.Trading/ListPositions"
+)
+
+// TradingClient is the client API for Trading service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Trading places and cancels orders through the connector's REST client
+// and lists the account's orders, executions and positions. It is only
+// served when enabled and its calls must carry the configured token as
+// "authorization: Bearer <token>" metadata.
+type TradingClient interface {
+	PlaceOrder(ctx context.Context, in *PlaceOrderRequest, opts ...grpc.CallOption) (*Order, error)
+	CancelOrder(ctx context.Context, in *CancelOrderRequest, opts ...grpc.CallOption) (*Order, error)
+	ListOpenOrders(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*OrderList, error)
+	ListExecutions(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ExecutionList, error)
+	ListPositions(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*PositionList, error)
+}
+
+type tradingClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewTradingClient(cc grpc.ClientConnInterface) TradingClient {
+	return &tradingClient{cc}
+}
+
+func (c *tradingClient) PlaceOrder(ctx context.Context, in *PlaceOrderRequest, opts ...grpc.CallOption) (*Order, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Order)
+	err := c.cc.Invoke(ctx, Trading_PlaceOrder_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tradingClient) CancelOrder(ctx context.Context, in *CancelOrderRequest, opts ...grpc.CallOption) (*Order, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Order)
+	err := c.cc.Invoke(ctx, Trading_CancelOrder_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tradingClient) ListOpenOrders(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*OrderList, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(OrderList)
+	err := c.cc.Invoke(ctx, Trading_ListOpenOrders_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tradingClient) ListExecutions(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ExecutionList, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ExecutionList)
+	err := c.cc.Invoke(ctx, Trading_ListExecutions_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tradingClient) ListPositions(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*PositionList, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PositionList)
+	err := c.cc.Invoke(ctx, Trading_ListPositions_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// TradingServer is the server API for Trading service.
+// All implementations must embed UnimplementedTradingServer
+// for forward compatibility.
+//
+// Trading places and cancels orders through the connector's REST client
+// and lists the account's orders, executions and positions. It is only
+// served when enabled and its calls must carry the configured token as
+// "authorization: Bearer <token>" metadata.
+type TradingServer interface {
+	PlaceOrder(context.Context, *PlaceOrderRequest) (*Order, error)
+	CancelOrder(context.Context, *CancelOrderRequest) (*Order, error)
+	ListOpenOrders(context.Context, *ListRequest) (*OrderList, error)
+	ListExecutions(context.Context, *ListRequest) (*ExecutionList, error)
+	ListPositions(context.Context, *ListRequest) (*PositionList, error)
+	mustEmbedUnimplementedTradingServer()
+}
+
+// UnimplementedTradingServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedTradingServer struct{}
+
+func (UnimplementedTradingServer) PlaceOrder(context.Context, *PlaceOrderRequest) (*Order, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PlaceOrder not implemented")
+}
+func (UnimplementedTradingServer) CancelOrder(context.Context, *CancelOrderRequest) (*Order, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CancelOrder not implemented")
+}
+func (UnimplementedTradingServer) ListOpenOrders(context.Context, *ListRequest) (*OrderList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListOpenOrders not implemented")
+}
+func (UnimplementedTradingServer) ListExecutions(context.Context, *ListRequest) (*ExecutionList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListExecutions not implemented")
+}
+func (UnimplementedTradingServer) ListPositions(context.Context, *ListRequest) (*PositionList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListPositions not implemented")
+}
+func (UnimplementedTradingServer) mustEmbedUnimplementedTradingServer() {}
+func (UnimplementedTradingServer) testEmbeddedByValue()                 {}
+
+// UnsafeTradingServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to TradingServer will
+// result in compilation errors.
+type UnsafeTradingServer interface {
+	mustEmbedUnimplementedTradingServer()
+}
+
+func RegisterTradingServer(s grpc.ServiceRegistrar, srv TradingServer) {
+	// If the following call pancis, it indicates UnimplementedTradingServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Trading_ServiceDesc, srv)
+}
+
+func _Trading_PlaceOrder_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PlaceOrderRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TradingServer).PlaceOrder(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Trading_PlaceOrder_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TradingServer).PlaceOrder(ctx, req.(*PlaceOrderRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Trading_CancelOrder_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CancelOrderRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TradingServer).CancelOrder(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Trading_CancelOrder_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TradingServer).CancelOrder(ctx, req.(*CancelOrderRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Trading_ListOpenOrders_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TradingServer).ListOpenOrders(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Trading_ListOpenOrders_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TradingServer).ListOpenOrders(ctx, req.(*ListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Trading_ListExecutions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TradingServer).ListExecutions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Trading_ListExecutions_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TradingServer).ListExecutions(ctx, req.(*ListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Trading_ListPositions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TradingServer).ListPositions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Trading_ListPositions_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TradingServer).ListPositions(ctx, req.(*ListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Trading_ServiceDesc is the grpc.ServiceDesc for Trading service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Trading_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "bybit.connector.v1.Trading",
+	HandlerType: (*TradingServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "PlaceOrder",
+			Handler:    _Trading_PlaceOrder_Handler,
+		},
+		{
+			MethodName: "CancelOrder",
+			Handler:    _Trading_CancelOrder_Handler,
+		},
+		{
+			MethodName: "ListOpenOrders",
+			Handler:    _Trading_ListOpenOrders_Handler,
+		},
+		{
+			MethodName: "ListExecutions",
+			Handler:    _Trading_ListExecutions_Handler,
+		},
+		{
+			MethodName: "ListPositions",
+			Handler:    _Trading_ListPositions_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "connector.proto",
+}
@@ -0,0 +1,108 @@
+package grpcapi
+
+import (
+	"bybit_connector/pkg/exucution"
+	"bybit_connector/pkg/market"
+	"time"
+)
+
+// Conversions from the connector's types to the messages of connector.proto
+
+func millis(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+func newLevels(items []market.Item, depth int) []*Level {
+	if depth > 0 && len(items) > depth {
+		items = items[:depth]
+	}
+	levels := make([]*Level, len(items))
+	for i, it := range items {
+		levels[i] = &Level{Price: it.Price, Size: it.Amount}
+	}
+	return levels
+}
+
+func newTicker(t market.Ticker) *Ticker {
+	return &Ticker{
+		Symbol:    t.Symbol,
+		Bid:       t.Bid,
+		BidSize:   t.BidSize,
+		Ask:       t.Ask,
+		AskSize:   t.AskSize,
+		LastPrice: t.LastPrice,
+		TimeMs:    millis(t.Time),
+		Derived:   t.Derived,
+		Seq:       t.Seq,
+	}
+}
+
+func newTrade(t market.Trade) *Trade {
+	return &Trade{
+		Symbol:     t.Symbol,
+		Side:       t.Side,
+		Price:      t.Price,
+		Size:       t.Size,
+		TradeId:    t.TradeId,
+		TimeMs:     millis(t.Time),
+		BlockTrade: t.IsBlockTrade,
+	}
+}
+
+func newOrder(o market.Order) *Order {
+	return &Order{
+		OrderId:      o.OrderID,
+		OrderLinkId:  o.OrderLinkID,
+		Symbol:       o.Symbol,
+		Side:         o.Side,
+		OrderType:    o.OrderType,
+		Price:        o.Price,
+		Qty:          o.Qty,
+		TimeInForce:  o.TimeInForce,
+		Status:       o.OrderStatus,
+		LeavesQty:    o.LeavesQty,
+		CumExecQty:   o.CumExecQty,
+		CumExecValue: o.CumExecValue,
+		CumExecFee:   o.CumExecFee,
+		TimeMs:       millis(o.Timestamp),
+		ReduceOnly:   o.ReduceOnly,
+	}
+}
+
+func newExecution(x exucution.Execution) *Execution {
+	return &Execution{
+		Symbol:      x.Symbol,
+		Side:        x.Side,
+		OrderId:     x.OrderID,
+		ExecId:      x.ExecID,
+		OrderLinkId: x.OredrLinkID,
+		Price:       x.Price,
+		OrderQty:    x.OrderQty,
+		ExecType:    x.ExecType,
+		ExecQty:     x.ExecQty,
+		ExecFee:     x.ExecFee,
+		LeavesQty:   x.LeavesQty,
+		IsMaker:     x.IsMaker,
+		TimeMs:      millis(x.TradeTime),
+	}
+}
+
+func newPosition(p exucution.Position) *Position {
+	return &Position{
+		Symbol:         p.Symbol,
+		Side:           p.Side,
+		Size:           p.Size,
+		EntryPrice:     p.EntryPrice,
+		PositionValue:  p.PositionValue,
+		Leverage:       p.Leverage,
+		LiqPrice:       p.LiqPrice,
+		TakeProfit:     p.TakeProfit,
+		StopLoss:       p.StopLoss,
+		CumRealisedPnl: p.CumRealisedPnl,
+		Status:         p.PositionStatus,
+		Seq:            p.PositionSeq,
+	}
+}
@@ -0,0 +1,549 @@
+package grpcapi
+
+import (
+	"bybit_connector/handler"
+	"bybit_connector/internal/socket"
+	"bybit_connector/pkg/market"
+	"bybit_connector/pkg/rest"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative connector.proto
+
+// Service implements the MarketData and Trading services of connector.proto
+// on top of a WebSocketHandler and a REST client
+type Service struct {
+	Handler *handler.WebSocketHandler
+	Streams *socket.Streams
+	// REST places orders and lists the account's state. It needs API
+	// credentials; Trading calls fail with FAILED_PRECONDITION while it is nil.
+	REST *rest.Client
+	// TradeBuffer is the number of trades queued per trade stream. A
+	// stream falling further behind is ended with RESOURCE_EXHAUSTED.
+	TradeBuffer int
+	// Trading registers the Trading service. It requires a Token, which
+	// its calls must carry as "authorization: Bearer <token>" metadata.
+	Trading bool
+	Token   string
+
+	UnimplementedMarketDataServer
+	UnimplementedTradingServer
+
+	mu          sync.Mutex
+	subscribers map[*subscriber]bool
+}
+
+// stream kinds of subscribers
+const (
+	streamBooks = iota
+	streamTickers
+	streamTrades
+)
+
+// subscriber is an open market data stream. Books and tickers are
+// conflated to the latest value per key; trades are queued.
+type subscriber struct {
+	kind int
+	// symbols is nil when every tracked symbol is streamed
+	symbols map[string]bool
+	wake    chan struct{}
+	trades  chan market.Trade
+
+	mu      sync.Mutex
+	pending map[string]interface{}
+	order   []string
+}
+
+// bookUpdate is a conflated book of a subscriber
+type bookUpdate struct {
+	symbol   string
+	book     *market.OrderBook
+	updateID int64
+}
+
+// NewService creates a service serving the data of h for the symbols of streams
+func NewService(h *handler.WebSocketHandler, streams *socket.Streams) *Service {
+	return &Service{
+		Handler:     h,
+		Streams:     streams,
+		TradeBuffer: 1024,
+		subscribers: make(map[*subscriber]bool),
+	}
+}
+
+// Attach chains the service to the handler's callbacks. Call it before the
+// handler receives messages; callbacks installed earlier keep being called.
+// The ticker streams only carry exchange tickers when the handler's
+// BBOIncludeTickers is set; an earlier OnBBO only receives them if it was
+// already set when Attach was called.
+func (s *Service) Attach(h *handler.WebSocketHandler) {
+	onBook, onBBO, onTrade := h.OnOrderBook, h.OnBBO, h.OnTrade
+	includeTickers := h.BBOIncludeTickers
+
+	h.OnOrderBook = func(symbol string, book *market.OrderBook) {
+		if onBook != nil {
+			onBook(symbol, book)
+		}
+		s.PublishBook(symbol, book)
+	}
+	h.OnBBO = func(t market.Ticker) {
+		if onBBO != nil && (t.Derived || includeTickers) {
+			onBBO(t)
+		}
+		s.PublishTicker(t)
+	}
+	h.OnTrade = func(t market.Trade) {
+		if onTrade != nil {
+			onTrade(t)
+		}
+		s.PublishTrade(t)
+	}
+}
+
+// PublishBook sends a new book of a symbol to the book streams. book is not
+// modified and must not be modified afterwards.
+func (s *Service) PublishBook(symbol string, book *market.OrderBook) {
+	u := bookUpdate{symbol: symbol, book: book, updateID: s.Handler.Parser.OrderBookLocal.UpdateID(symbol)}
+	for _, sub := range s.subscribersOf(streamBooks, symbol) {
+		sub.offer(symbol, u)
+	}
+}
+
+// PublishTicker sends a derived or exchange ticker to the ticker streams
+func (s *Service) PublishTicker(t market.Ticker) {
+	for _, sub := range s.subscribersOf(streamTickers, t.Symbol) {
+		sub.offer(tickerKey(t), t)
+	}
+}
+
+// PublishTrade sends a public trade to the trade streams
+func (s *Service) PublishTrade(t market.Trade) {
+	for _, sub := range s.subscribersOf(streamTrades, t.Symbol) {
+		sub.queue(t)
+	}
+}
+
+func (s *Service) subscribersOf(kind int, symbol string) []*subscriber {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var subs []*subscriber
+	for sub := range s.subscribers {
+		if sub.kind == kind && (sub.symbols == nil || sub.symbols[symbol]) {
+			subs = append(subs, sub)
+		}
+	}
+	return subs
+}
+
+// subscribe registers a stream of the requested symbols, which must be tracked
+func (s *Service) subscribe(kind int, req *StreamRequest) (*subscriber, error) {
+	sub := &subscriber{kind: kind, wake: make(chan struct{}, 1), pending: make(map[string]interface{})}
+	if kind == streamTrades {
+		sub.trades = make(chan market.Trade, s.TradeBuffer)
+	}
+	if len(req.Symbols) > 0 {
+		tracked := make(map[string]bool)
+		for _, sym := range s.Streams.Symbols() {
+			tracked[sym.Symbol] = true
+		}
+		sub.symbols = make(map[string]bool)
+		for _, sym := range req.Symbols {
+			sym = strings.ToUpper(sym)
+			if !tracked[sym] {
+				return nil, status.Errorf(codes.InvalidArgument, "symbol %s is not tracked", sym)
+			}
+			sub.symbols[sym] = true
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscribers[sub] = true
+	return sub, nil
+}
+
+func (s *Service) unsubscribe(sub *subscriber) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.subscribers, sub)
+}
+
+// symbols returns the symbols a subscriber currently streams
+func (s *Service) symbols(sub *subscriber) []string {
+	var symbols []string
+	for _, sym := range s.Streams.Symbols() {
+		if sub.symbols == nil || sub.symbols[sym.Symbol] {
+			symbols = append(symbols, sym.Symbol)
+		}
+	}
+	return symbols
+}
+
+// category returns the category a symbol is streamed from
+func (s *Service) category(symbol string) market.Category {
+	for _, sym := range s.Streams.Symbols() {
+		if sym.Symbol == symbol {
+			return sym.Category
+		}
+	}
+	return ""
+}
+
+// StreamOrderBooks implements MarketDataServer
+func (s *Service) StreamOrderBooks(req *StreamRequest, stream grpc.ServerStreamingServer[OrderBook]) error {
+	sub, err := s.subscribe(streamBooks, req)
+	if err != nil {
+		return err
+	}
+	defer s.unsubscribe(sub)
+
+	// Updates received since subscribing are newer than the current books
+	for _, sym := range s.symbols(sub) {
+		if book, updateID, _ := s.Handler.GetOrderBookState(sym); book != nil {
+			sub.seed(sym, bookUpdate{symbol: sym, book: book, updateID: updateID})
+		}
+	}
+	return s.run(stream, sub, func(v interface{}) error {
+		u := v.(bookUpdate)
+		return stream.Send(&OrderBook{
+			Symbol:      u.symbol,
+			Category:    string(s.category(u.symbol)),
+			TimestampMs: millis(u.book.Timestamp),
+			UpdateId:    u.updateID,
+			Bids:        newLevels(u.book.Bids, int(req.Depth)),
+			Asks:        newLevels(u.book.Asks, int(req.Depth)),
+		})
+	})
+}
+
+// StreamTickers implements MarketDataServer
+func (s *Service) StreamTickers(req *StreamRequest, stream grpc.ServerStreamingServer[Ticker]) error {
+	sub, err := s.subscribe(streamTickers, req)
+	if err != nil {
+		return err
+	}
+	defer s.unsubscribe(sub)
+
+	for _, sym := range s.symbols(sub) {
+		for _, t := range []*market.Ticker{s.Handler.GetBBO(sym), s.Handler.GetTicker(sym)} {
+			if t != nil {
+				sub.seed(tickerKey(*t), *t)
+			}
+		}
+	}
+	return s.run(stream, sub, func(v interface{}) error {
+		return stream.Send(newTicker(v.(market.Ticker)))
+	})
+}
+
+// StreamTrades implements MarketDataServer
+func (s *Service) StreamTrades(req *StreamRequest, stream grpc.ServerStreamingServer[Trade]) error {
+	sub, err := s.subscribe(streamTrades, req)
+	if err != nil {
+		return err
+	}
+	defer s.unsubscribe(sub)
+
+	ctx := stream.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case t := <-sub.trades:
+			if err := stream.Send(newTrade(t)); err != nil {
+				return err
+			}
+		case <-sub.wake:
+			return status.Errorf(codes.ResourceExhausted, "more than %d trades behind", s.TradeBuffer)
+		}
+	}
+}
+
+// run sends the conflated values of sub with send until the stream ends
+func (s *Service) run(stream grpc.ServerStream, sub *subscriber, send func(v interface{}) error) error {
+	ctx := stream.Context()
+	for {
+		for _, v := range sub.take() {
+			if err := send(v); err != nil {
+				return err
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-sub.wake:
+		}
+	}
+}
+
+// tickerKey conflates derived and exchange tickers of a symbol separately
+func tickerKey(t market.Ticker) string {
+	if t.Derived {
+		return t.Symbol + "/bbo"
+	}
+	return t.Symbol + "/ticker"
+}
+
+// offer replaces the pending value of key
+func (sub *subscriber) offer(key string, v interface{}) {
+	sub.mu.Lock()
+	if _, ok := sub.pending[key]; !ok {
+		sub.order = append(sub.order, key)
+	}
+	sub.pending[key] = v
+	sub.mu.Unlock()
+	sub.notify()
+}
+
+// seed sets the pending value of key unless an update is already pending
+func (sub *subscriber) seed(key string, v interface{}) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	if _, ok := sub.pending[key]; !ok {
+		sub.order = append(sub.order, key)
+		sub.pending[key] = v
+	}
+}
+
+// take returns the pending values in the order their keys were first offered
+func (sub *subscriber) take() []interface{} {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	values := make([]interface{}, len(sub.order))
+	for i, key := range sub.order {
+		values[i] = sub.pending[key]
+		delete(sub.pending, key)
+	}
+	sub.order = sub.order[:0]
+	return values
+}
+
+// queue adds a trade, waking the stream to end it when the queue is full
+func (sub *subscriber) queue(t market.Trade) {
+	select {
+	case sub.trades <- t:
+	default:
+		sub.notify()
+	}
+}
+
+func (sub *subscriber) notify() {
+	select {
+	case sub.wake <- struct{}{}:
+	default:
+	}
+}
+
+// PlaceOrder implements TradingServer. The category defaults to the one
+// the symbol is streamed from.
+func (s *Service) PlaceOrder(ctx context.Context, req *PlaceOrderRequest) (*Order, error) {
+	if err := s.tradingEnabled(); err != nil {
+		return nil, err
+	}
+	r := rest.CreateOrderRequest{
+		Category:    s.categoryOr(req.Category, req.Symbol),
+		Symbol:      strings.ToUpper(req.Symbol),
+		Side:        req.Side,
+		OrderType:   req.OrderType,
+		Qty:         rest.Decimal(req.Qty),
+		Price:       rest.Decimal(req.Price),
+		TimeInForce: req.TimeInForce,
+		OrderLinkID: req.OrderLinkId,
+		ReduceOnly:  req.ReduceOnly,
+		TakeProfit:  rest.Decimal(req.TakeProfit),
+		StopLoss:    rest.Decimal(req.StopLoss),
+	}
+	order, err := s.REST.CreateOrder(ctx, r)
+	if err != nil {
+		return nil, restStatus(err)
+	}
+	return newOrder(order), nil
+}
+
+// CancelOrder implements TradingServer
+func (s *Service) CancelOrder(ctx context.Context, req *CancelOrderRequest) (*Order, error) {
+	if err := s.tradingEnabled(); err != nil {
+		return nil, err
+	}
+	r := rest.CancelOrderRequest{
+		Category:    s.categoryOr(req.Category, req.Symbol),
+		Symbol:      strings.ToUpper(req.Symbol),
+		OrderID:     req.OrderId,
+		OrderLinkID: req.OrderLinkId,
+	}
+	order, err := s.REST.CancelOrder(ctx, r)
+	if err != nil {
+		return nil, restStatus(err)
+	}
+	return newOrder(order), nil
+}
+
+// ListOpenOrders implements TradingServer
+func (s *Service) ListOpenOrders(ctx context.Context, req *ListRequest) (*OrderList, error) {
+	category, err := s.listCategory(req)
+	if err != nil {
+		return nil, err
+	}
+	orders, err := s.REST.GetOpenOrders(ctx, category, strings.ToUpper(req.Symbol))
+	if err != nil {
+		return nil, restStatus(err)
+	}
+	list := &OrderList{Orders: make([]*Order, len(orders))}
+	for i, o := range orders {
+		list.Orders[i] = newOrder(o)
+	}
+	return list, nil
+}
+
+// ListExecutions implements TradingServer
+func (s *Service) ListExecutions(ctx context.Context, req *ListRequest) (*ExecutionList, error) {
+	category, err := s.listCategory(req)
+	if err != nil {
+		return nil, err
+	}
+	if req.Limit < 0 {
+		return nil, status.Error(codes.InvalidArgument, "limit must not be negative")
+	}
+	executions, err := s.REST.GetExecutions(ctx, category, strings.ToUpper(req.Symbol), int(req.Limit))
+	if err != nil {
+		return nil, restStatus(err)
+	}
+	list := &ExecutionList{Executions: make([]*Execution, len(executions))}
+	for i, x := range executions {
+		list.Executions[i] = newExecution(x)
+	}
+	return list, nil
+}
+
+// ListPositions implements TradingServer
+func (s *Service) ListPositions(ctx context.Context, req *ListRequest) (*PositionList, error) {
+	category, err := s.listCategory(req)
+	if err != nil {
+		return nil, err
+	}
+	positions, err := s.REST.GetPositions(ctx, category, strings.ToUpper(req.Symbol))
+	if err != nil {
+		return nil, restStatus(err)
+	}
+	list := &PositionList{Positions: make([]*Position, len(positions))}
+	for i, p := range positions {
+		list.Positions[i] = newPosition(p)
+	}
+	return list, nil
+}
+
+func (s *Service) tradingEnabled() error {
+	if s.REST == nil {
+		return status.Error(codes.FailedPrecondition, "order entry requires API credentials")
+	}
+	return nil
+}
+
+// categoryOr parses category, defaulting to the category of a tracked symbol
+func (s *Service) categoryOr(category, symbol string) market.Category {
+	if category == "" {
+		return s.category(strings.ToUpper(symbol))
+	}
+	return market.Category(category)
+}
+
+func (s *Service) listCategory(req *ListRequest) (market.Category, error) {
+	if err := s.tradingEnabled(); err != nil {
+		return "", err
+	}
+	category, err := market.ParseCategory(string(s.categoryOr(req.Category, req.Symbol)))
+	if err != nil {
+		return "", status.Error(codes.InvalidArgument, err.Error())
+	}
+	return category, nil
+}
+
+// restStatus maps an error of the REST client to a status: invalid requests
+// are INVALID_ARGUMENT, rejections by the exchange FAILED_PRECONDITION, or
+// RESOURCE_EXHAUSTED when rate limited, and transport failures UNAVAILABLE
+func restStatus(err error) error {
+	var apiErr *rest.APIError
+	switch {
+	case errors.Is(err, rest.ErrInvalidOrder):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.As(err, &apiErr) && apiErr.RateLimited():
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.As(err, &apiErr):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Err()
+	default:
+		return status.Error(codes.Unavailable, err.Error())
+	}
+}
+
+// Register registers the MarketData service on srv, and the Trading
+// service when enabled. Trading calls are only authenticated by the
+// interceptor of NewServer.
+func (s *Service) Register(srv grpc.ServiceRegistrar) {
+	RegisterMarketDataServer(srv, s)
+	if s.Trading {
+		RegisterTradingServer(srv, s)
+	}
+}
+
+// NewServer creates a gRPC server serving s, which checks the token of
+// Trading calls
+func NewServer(s *Service, opts ...grpc.ServerOption) (*grpc.Server, error) {
+	if s.Trading && s.Token == "" {
+		return nil, errors.New("the Trading service requires a token")
+	}
+	srv := grpc.NewServer(append(opts, grpc.ChainUnaryInterceptor(s.authorize))...)
+	s.Register(srv)
+	return srv, nil
+}
+
+// authorize rejects Trading calls without the service's token with
+// UNAUTHENTICATED. The Trading service only has unary methods.
+func (s *Service) authorize(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (interface{}, error) {
+	if !strings.HasPrefix(info.FullMethod, "/"+Trading_ServiceDesc.ServiceName+"/") {
+		return next(ctx, req)
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	var token string
+	bearer := false
+	if values := md.Get("authorization"); len(values) == 1 {
+		token, bearer = strings.CutPrefix(values[0], "Bearer ")
+	}
+	if !bearer || s.Token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) != 1 {
+		return nil, status.Error(codes.Unauthenticated, "missing or invalid token")
+	}
+	return next(ctx, req)
+}
+
+// ListenAndServe serves the service on addr until ctx is done, then stops,
+// ending the open streams
+func (s *Service) ListenAndServe(ctx context.Context, addr string) error {
+	srv, err := NewServer(s)
+	if err != nil {
+		return fmt.Errorf("grpc server: %w", err)
+	}
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("grpc server: %w", err)
+	}
+	go func() {
+		<-ctx.Done()
+		srv.Stop()
+	}()
+	if err := srv.Serve(lis); err != nil {
+		return fmt.Errorf("grpc server: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package grpcapi
+
+import (
+	"bybit_connector/handler"
+	"bybit_connector/internal/config"
+	"bybit_connector/internal/socket"
+	"bybit_connector/pkg/market"
+	"bybit_connector/pkg/rest"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newTestService serves a service tracking BTCUSDT over an in-memory
+// listener and returns a connection to it. Trading is enabled with a token
+// when token is set.
+func newTestService(t *testing.T, token string) (*Service, *grpc.ClientConn) {
+	t.Helper()
+	conf := &config.Config{Symbols: []config.SymbolConfig{{Symbol: "BTCUSDT", Category: market.CategoryLinear, Depth: 50}}}
+	h := handler.NewWebSocketHandler()
+	s := NewService(h, socket.NewStreams(conf, nil, nil))
+	s.Trading, s.Token = token != "", token
+	s.Attach(h)
+	h.HandleMessage([]byte(`{"topic":"orderbook.50.BTCUSDT","type":"snapshot","ts":1000,"data":{"s":"BTCUSDT",` +
+		`"b":[["100","1"],["99","2"]],"a":[["101","1"],["102","2"]],"u":7,"seq":1}}`))
+
+	lis := bufconn.Listen(1 << 20)
+	srv, err := NewServer(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return s, conn
+}
+
+func TestStreamOrderBooks(t *testing.T) {
+	s, conn := newTestService(t, "")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := NewMarketDataClient(conn)
+	stream, err := client.StreamOrderBooks(ctx, &StreamRequest{Symbols: []string{"btcusdt"}, Depth: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	book, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if book.Symbol != "BTCUSDT" || book.Category != "linear" || book.UpdateId != 7 ||
+		len(book.Bids) != 1 || book.Bids[0].Price != 100 || book.Bids[0].Size != 1 || len(book.Asks) != 1 {
+		t.Fatalf("unexpected initial book: %+v", book)
+	}
+
+	s.Handler.HandleMessage([]byte(`{"topic":"orderbook.50.BTCUSDT","type":"delta","ts":2000,"data":{"s":"BTCUSDT",` +
+		`"b":[["100.5","3"]],"a":[],"u":8,"seq":2}}`))
+	if book, err = stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	if book.UpdateId != 8 || book.TimestampMs != 2000 || book.Bids[0].Price != 100.5 || book.Bids[0].Size != 3 {
+		t.Fatalf("unexpected updated book: %+v", book)
+	}
+
+	untracked, err := client.StreamOrderBooks(ctx, &StreamRequest{Symbols: []string{"ETHUSDT"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := untracked.Recv(); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument for an untracked symbol, got %v", err)
+	}
+}
+
+func TestTradingAuth(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Not registered unless enabled
+	_, conn := newTestService(t, "")
+	if _, err := NewTradingClient(conn).ListPositions(ctx, &ListRequest{}); status.Code(err) != codes.Unimplemented {
+		t.Fatalf("expected Unimplemented without Trading, got %v", err)
+	}
+
+	_, conn = newTestService(t, "secret")
+	client := NewTradingClient(conn)
+	for _, md := range []metadata.MD{nil, metadata.Pairs("authorization", "Bearer wrong"), metadata.Pairs("authorization", "secret")} {
+		if _, err := client.ListPositions(metadata.NewOutgoingContext(ctx, md), &ListRequest{}); status.Code(err) != codes.Unauthenticated {
+			t.Fatalf("expected Unauthenticated with %v, got %v", md, err)
+		}
+	}
+	// Market data needs no token
+	stream, err := NewMarketDataClient(conn).StreamOrderBooks(ctx, &StreamRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewServer(&Service{Trading: true}); err == nil {
+		t.Fatal("expected an error for Trading without a token")
+	}
+}
+
+func TestPlaceOrder(t *testing.T) {
+	s, conn := newTestService(t, "secret")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer secret")
+
+	client := NewTradingClient(conn)
+	_, err := client.PlaceOrder(ctx, &PlaceOrderRequest{Symbol: "BTCUSDT"})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected FailedPrecondition without credentials, got %v", err)
+	}
+
+	var sent rest.CreateOrderRequest
+	bybit := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v5/order/create" {
+			http.NotFound(w, r)
+			return
+		}
+		var body struct {
+			Category, Symbol, Side, OrderType, Qty, Price string
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		sent.Category, sent.Symbol, sent.Side, sent.OrderType = market.Category(body.Category), body.Symbol, body.Side, body.OrderType
+		if body.Qty != "0.01" || body.Price != "100.5" {
+			t.Errorf("unexpected qty %q or price %q", body.Qty, body.Price)
+		}
+		w.Write([]byte(`{"retCode":0,"retMsg":"OK","result":{"orderId":"o-1","orderLinkId":"link-1"},"time":1}`))
+	}))
+	defer bybit.Close()
+	s.REST = rest.NewClient(&config.Config{BybitRESTBaseURL: bybit.URL, BybitAPIKey: "key", BybitAPISecret: "secret"})
+
+	_, err = client.PlaceOrder(ctx, &PlaceOrderRequest{Symbol: "BTCUSDT", Side: "Buy", OrderType: "Limit", Qty: 0.01})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument for a limit order without price, got %v", err)
+	}
+
+	order, err := client.PlaceOrder(ctx,
+		&PlaceOrderRequest{Symbol: "btcusdt", Side: "Buy", OrderType: "Limit", Qty: 0.01, Price: 100.5, OrderLinkId: "link-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.OrderId != "o-1" || order.OrderLinkId != "link-1" || order.Symbol != "BTCUSDT" || order.Price != 100.5 {
+		t.Fatalf("unexpected order: %+v", order)
+	}
+	// The category defaults to the one the symbol is streamed from
+	if sent.Category != market.CategoryLinear || sent.Symbol != "BTCUSDT" || sent.Side != "Buy" || sent.OrderType != "Limit" {
+		t.Fatalf("unexpected request: %+v", sent)
+	}
+}
@@ -2,15 +2,27 @@
 package parser
 
 import (
+	"bybit_connector/pkg/logging"
 	"bybit_connector/pkg/market"
+	"bybit_connector/pkg/metrics"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"time"
 )
 
 // MessageParser handles the parsing of different types of WebSocket messages
 type MessageParser struct {
 	OrderBookLocal *market.OderBookLocal
+	// Metrics, when set, counts the messages per topic, parse errors and
+	// sequence gaps, and records the latencies of parsed messages
+	Metrics *metrics.Connector
+	// Logger receives parse errors and sequence gaps with their topic and
+	// symbol. The default logger is used when it is nil.
+	Logger *slog.Logger
+	// Clock, when set, is fed the delay of every message carrying a ts
+	Clock *market.ClockSkew
 }
 
 // NewMessageParser creates a new message parser
@@ -20,21 +32,42 @@ func NewMessageParser() *MessageParser {
 	}
 }
 
-// ParseMessage parses a WebSocket message into the appropriate type
+// ParseMessage parses a WebSocket message into the appropriate type,
+// received now
 func (p *MessageParser) ParseMessage(message []byte) (interface{}, error) {
+	return p.ParseMessageAt(message, time.Now())
+}
+
+// ParseMessageAt parses a WebSocket message received at received. Parsed
+// events carry the message's ts, the matching engine time when known and
+// received in their Timestamps; pass a time.Now() reading taken on receipt
+// so that it keeps its monotonic clock.
+func (p *MessageParser) ParseMessageAt(message []byte, received time.Time) (interface{}, error) {
 	// First determine the type of message
 	var baseMsg struct {
 		Topic   string      `json:"topic,omitempty"`
 		Type    string      `json:"type,omitempty"`
 		Data    interface{} `json:"data,omitempty"`
 		Ts      int64       `json:"ts,omitempty"`
+		Cts     int64       `json:"cts,omitempty"`
 		Op      string      `json:"op,omitempty"`
 		Ret_msg string      `json:"ret_msg,omitempty"`
 		Success bool        `json:"success,omitempty"`
 	}
 
 	if err := json.Unmarshal(message, &baseMsg); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal base message: %w", err)
+		err = fmt.Errorf("failed to unmarshal base message: %w", err)
+		p.parseError("", "", err)
+		return nil, err
+	}
+	stamps := market.Timestamps{
+		MatchingTime: unixMilli(baseMsg.Cts),
+		ExchangeTime: unixMilli(baseMsg.Ts),
+		ReceivedTime: received,
+	}
+	p.Metrics.Message(baseMsg.Topic)
+	if p.Clock != nil {
+		p.Clock.ObserveMessage(stamps.ExchangeTime, received)
 	}
 
 	// If it's a response to a subscription request
@@ -45,32 +78,80 @@ func (p *MessageParser) ParseMessage(message []byte) (interface{}, error) {
 	// Process based on topic if available
 	if baseMsg.Topic != "" {
 		// Extract the topic type (e.g., "orderbook" from "orderbook.1.BTCUSDT")
-		topicParts := splitTopic(baseMsg.Topic)
-		if len(topicParts) < 3 {
-			return nil, fmt.Errorf("invalid topic format: %s", baseMsg.Topic)
+		// The symbol is always the last part ("publicTrade.BTCUSDT")
+		topicParts := SplitTopic(baseMsg.Topic)
+		if len(topicParts) < 2 {
+			err := fmt.Errorf("invalid topic format: %s", baseMsg.Topic)
+			p.parseError(baseMsg.Topic, "", err)
+			return nil, err
 		}
 
 		topicType := topicParts[0]
-		symbol := topicParts[2]
+		symbol := topicParts[len(topicParts)-1]
 
+		var parsed interface{}
+		var err error
 		switch topicType {
 		case "orderbook":
-			return p.parseOrderbook(message, baseMsg.Type, symbol)
-		case "trade":
-			return p.parseTrade(message, symbol)
-		case "ticker":
-			return p.parseTicker(message, symbol)
+			if len(topicParts) < 3 {
+				err = fmt.Errorf("invalid topic format: %s", baseMsg.Topic)
+				break
+			}
+			parsed, err = p.parseOrderbook(message, baseMsg.Type, symbol, stamps)
+		case "trade", "publicTrade":
+			var trades []*market.Trade
+			trades, err = p.parseTrade(message, symbol, stamps)
+			if err == nil {
+				// The latency of a message's first trade is that of the message
+				stamps.MatchingTime = trades[0].MatchingTime
+			}
+			parsed = trades
+		case "ticker", "tickers":
+			parsed, err = p.parseTicker(message, symbol, stamps)
+		case "allLiquidation", "liquidation":
+			var liquidations []*market.Liquidation
+			liquidations, err = p.parseLiquidation(message, symbol, stamps)
+			if err == nil {
+				stamps.MatchingTime = liquidations[0].MatchingTime
+			}
+			parsed = liquidations
+		case "kline":
+			if len(topicParts) < 3 {
+				err = fmt.Errorf("invalid topic format: %s", baseMsg.Topic)
+				break
+			}
+			parsed, err = p.parseKline(message, topicParts[1], symbol, stamps)
 		default:
 			return baseMsg, nil
 		}
+		if err != nil {
+			p.parseError(baseMsg.Topic, symbol, err)
+			return nil, err
+		}
+		p.Metrics.Latency(baseMsg.Topic, stamps)
+		return parsed, nil
 	}
 
 	// Default: return the base message
 	return baseMsg, nil
 }
 
+// parseError records a message that could not be parsed, or a sequence gap
+func (p *MessageParser) parseError(topic, symbol string, err error) {
+	p.Metrics.ParseError(topic, symbol, err)
+	l := logging.Or(p.Logger)
+	if topic != "" {
+		l = l.With("topic", topic, "symbol", symbol)
+	}
+	if errors.Is(err, market.ErrOrderBookGap) {
+		l.Warn("Orderbook sequence gap", "error", err)
+		return
+	}
+	l.Warn("Failed to parse message", "error", err)
+}
+
 // parseOrderbook parses orderbook messages
-func (p *MessageParser) parseOrderbook(message []byte, msgType, symbol string) (interface{}, error) {
+func (p *MessageParser) parseOrderbook(message []byte, msgType, symbol string, stamps market.Timestamps) (interface{}, error) {
 	var orderbookMsg struct {
 		Topic string `json:"topic"`
 		Type  string `json:"type"`
@@ -138,11 +219,12 @@ func (p *MessageParser) parseOrderbook(message []byte, msgType, symbol string) (
 			})
 		}
 
-		// Load the snapshot into the local orderbook
-		err := p.OrderBookLocal.LoadSnapshot(snapshot)
+		// Load the snapshot into the local orderbook, replacing only this symbol
+		err := p.OrderBookLocal.LoadSnapshotWithID(symbol, snapshot, orderbookMsg.Data.U)
 		if err != nil {
 			return nil, fmt.Errorf("failed to load orderbook snapshot: %w", err)
 		}
+		p.setBookTimestamps(symbol, stamps)
 
 		return snapshot, nil
 	} else if msgType == "delta" {
@@ -153,52 +235,42 @@ func (p *MessageParser) parseOrderbook(message []byte, msgType, symbol string) (
 			Insert: []*market.OrderBookL2{},
 		}
 
-		// Process bid updates (treating all as updates for simplicity)
-		for i, bid := range orderbookMsg.Data.B {
-			if len(bid) < 2 {
-				continue
-			}
-			price, err := parseFloat(bid[0])
-			if err != nil {
-				continue
-			}
-			size, err := parseFloat(bid[1])
-			if err != nil {
-				continue
+		// A size of zero removes the price level, any other size sets it
+		for _, side := range []struct {
+			name   string
+			levels [][]string
+		}{{"Buy", orderbookMsg.Data.B}, {"Sell", orderbookMsg.Data.A}} {
+			for _, level := range side.levels {
+				if len(level) < 2 {
+					continue
+				}
+				price, err := parseFloat(level[0])
+				if err != nil {
+					continue
+				}
+				size, err := parseFloat(level[1])
+				if err != nil {
+					continue
+				}
+				entry := &market.OrderBookL2{
+					Price:  price,
+					Side:   side.name,
+					Size:   size,
+					Symbol: symbol,
+				}
+				if size == 0 {
+					delta.Delete = append(delta.Delete, entry)
+				} else {
+					delta.Insert = append(delta.Insert, entry)
+				}
 			}
-			delta.Update = append(delta.Update, &market.OrderBookL2{
-				ID:     int64(i + 1),
-				Price:  price,
-				Side:   "Buy",
-				Size:   size,
-				Symbol: symbol,
-			})
 		}
 
-		// Process ask updates
-		for i, ask := range orderbookMsg.Data.A {
-			if len(ask) < 2 {
-				continue
-			}
-			price, err := parseFloat(ask[0])
-			if err != nil {
-				continue
-			}
-			size, err := parseFloat(ask[1])
-			if err != nil {
-				continue
-			}
-			delta.Update = append(delta.Update, &market.OrderBookL2{
-				ID:     int64(i + 1000),
-				Price:  price,
-				Side:   "Sell",
-				Size:   size,
-				Symbol: symbol,
-			})
+		// Update the local orderbook; a gap leaves it to the caller to resync
+		if err := p.OrderBookLocal.UpdateWithID(symbol, delta, orderbookMsg.Data.U); err != nil {
+			return nil, fmt.Errorf("failed to apply orderbook delta: %w", err)
 		}
-
-		// Update the local orderbook
-		p.OrderBookLocal.Update(delta)
+		p.setBookTimestamps(symbol, stamps)
 
 		return delta, nil
 	}
@@ -206,19 +278,19 @@ func (p *MessageParser) parseOrderbook(message []byte, msgType, symbol string) (
 	return orderbookMsg, nil
 }
 
-// parseTrade parses trade messages
-func (p *MessageParser) parseTrade(message []byte, symbol string) (*market.Trade, error) {
+// parseTrade parses trade messages. A single message may carry several trades.
+func (p *MessageParser) parseTrade(message []byte, symbol string, stamps market.Timestamps) ([]*market.Trade, error) {
 	var tradeMsg struct {
 		Topic string `json:"topic"`
 		Data  []struct {
-			Timestamp     string `json:"T"`
-			Symbol        string `json:"s"`
-			Side          string `json:"S"`
-			Size          string `json:"v"`
-			Price         string `json:"p"`
-			TickDirection string `json:"L"`
-			TradeId       string `json:"i"`
-			IsBlockTrade  bool   `json:"BT"`
+			Timestamp     json.Number `json:"T"`
+			Symbol        string      `json:"s"`
+			Side          string      `json:"S"`
+			Size          string      `json:"v"`
+			Price         string      `json:"p"`
+			TickDirection string      `json:"L"`
+			TradeId       string      `json:"i"`
+			IsBlockTrade  bool        `json:"BT"`
 		} `json:"data"`
 	}
 
@@ -230,48 +302,176 @@ func (p *MessageParser) parseTrade(message []byte, symbol string) (*market.Trade
 		return nil, fmt.Errorf("no trade data found")
 	}
 
-	// Convert the first trade
-	data := tradeMsg.Data[0]
-	t, err := parseTimestamp(data.Timestamp)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse trade timestamp: %w", err)
+	trades := make([]*market.Trade, 0, len(tradeMsg.Data))
+	for _, data := range tradeMsg.Data {
+		t, err := parseTimestamp(data.Timestamp.String())
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse trade timestamp: %w", err)
+		}
+
+		size, err := parseFloat(data.Size)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse trade size: %w", err)
+		}
+
+		price, err := parseFloat(data.Price)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse trade price: %w", err)
+		}
+
+		if data.Symbol == "" {
+			data.Symbol = symbol
+		}
+		stamps.MatchingTime = t
+
+		trades = append(trades, &market.Trade{
+			Time:          t,
+			TradeTimeMs:   data.Timestamp.String(),
+			Symbol:        data.Symbol,
+			Side:          data.Side,
+			Size:          size,
+			Price:         price,
+			TickDirection: data.TickDirection,
+			TradeId:       data.TradeId,
+			IsBlockTrade:  data.IsBlockTrade,
+			Timestamps:    stamps,
+		})
 	}
 
-	size, err := parseFloat(data.Size)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse trade size: %w", err)
+	return trades, nil
+}
+
+// parseLiquidation parses allLiquidation messages. A single message may
+// carry several liquidations.
+func (p *MessageParser) parseLiquidation(message []byte, symbol string, stamps market.Timestamps) ([]*market.Liquidation, error) {
+	var liquidationMsg struct {
+		Topic string `json:"topic"`
+		Data  []struct {
+			Timestamp int64  `json:"T"`
+			Symbol    string `json:"s"`
+			Side      string `json:"S"`
+			Size      string `json:"v"`
+			Price     string `json:"p"`
+		} `json:"data"`
+	}
+
+	if err := json.Unmarshal(message, &liquidationMsg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal liquidation message: %w", err)
+	}
+
+	if len(liquidationMsg.Data) == 0 {
+		return nil, fmt.Errorf("no liquidation data found")
 	}
 
-	price, err := parseFloat(data.Price)
+	liquidations := make([]*market.Liquidation, 0, len(liquidationMsg.Data))
+	for _, data := range liquidationMsg.Data {
+		size, err := parseFloat(data.Size)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse liquidation size: %w", err)
+		}
+
+		price, err := parseFloat(data.Price)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse liquidation price: %w", err)
+		}
+
+		if data.Symbol == "" {
+			data.Symbol = symbol
+		}
+		t := time.UnixMilli(data.Timestamp)
+		stamps.MatchingTime = t
+
+		liquidations = append(liquidations, &market.Liquidation{
+			Symbol:     data.Symbol,
+			Side:       data.Side,
+			Size:       size,
+			Price:      price,
+			Time:       t,
+			Timestamps: stamps,
+		})
+	}
+
+	return liquidations, nil
+}
+
+// parseKline parses kline messages
+func (p *MessageParser) parseKline(message []byte, interval, symbol string, stamps market.Timestamps) ([]*market.Candle, error) {
+	var klineMsg struct {
+		Topic string `json:"topic"`
+		Data  []struct {
+			Start    int64  `json:"start"`
+			End      int64  `json:"end"`
+			Interval string `json:"interval"`
+			Open     string `json:"open"`
+			Close    string `json:"close"`
+			High     string `json:"high"`
+			Low      string `json:"low"`
+			Volume   string `json:"volume"`
+			Turnover string `json:"turnover"`
+			Confirm  bool   `json:"confirm"`
+			// Timestamp is the time of the last match in the candle
+			Timestamp int64 `json:"timestamp"`
+		} `json:"data"`
+	}
+
+	if err := json.Unmarshal(message, &klineMsg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal kline message: %w", err)
+	}
+
+	d, err := market.KlineInterval(interval)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse trade price: %w", err)
-	}
-
-	return &market.Trade{
-		Time:          t,
-		TradeTimeMs:   data.Timestamp,
-		Symbol:        data.Symbol,
-		Side:          data.Side,
-		Size:          size,
-		Price:         price,
-		TickDirection: data.TickDirection,
-		TradeId:       data.TradeId,
-		IsBlockTrade:  data.IsBlockTrade,
-	}, nil
+		return nil, err
+	}
+
+	candles := make([]*market.Candle, 0, len(klineMsg.Data))
+	for _, data := range klineMsg.Data {
+		values := make([]float64, 6)
+		for i, s := range []string{data.Open, data.High, data.Low, data.Close, data.Volume, data.Turnover} {
+			if values[i], err = parseFloat(s); err != nil {
+				return nil, fmt.Errorf("failed to parse kline value %q: %w", s, err)
+			}
+		}
+		stamps.MatchingTime = unixMilli(data.Timestamp)
+
+		candles = append(candles, &market.Candle{
+			Symbol:     symbol,
+			Interval:   d,
+			Start:      time.UnixMilli(data.Start),
+			Open:       values[0],
+			High:       values[1],
+			Low:        values[2],
+			Close:      values[3],
+			Volume:     values[4],
+			Turnover:   values[5],
+			Closed:     data.Confirm,
+			Exchange:   true,
+			Timestamps: stamps,
+		})
+	}
+
+	return candles, nil
+}
+
+// setBookTimestamps records the timestamps of an orderbook message
+func (p *MessageParser) setBookTimestamps(symbol string, stamps market.Timestamps) {
+	if !stamps.ExchangeTime.IsZero() {
+		p.OrderBookLocal.SetTimestamps(symbol, stamps)
+	}
 }
 
-// parseTicker parses ticker messages
-func (p *MessageParser) parseTicker(message []byte, symbol string) (*market.Ticker, error) {
+// parseTicker parses ticker messages. Delta messages only carry the fields
+// that changed, so missing fields are left at zero.
+func (p *MessageParser) parseTicker(message []byte, symbol string, stamps market.Timestamps) (*market.Ticker, error) {
 	var tickerMsg struct {
 		Topic string `json:"topic"`
+		Ts    int64  `json:"ts"`
 		Data  struct {
 			Symbol    string `json:"symbol"`
 			LastPrice string `json:"lastPrice"`
-			BidPrice  string `json:"bidPrice"`
-			BidSize   string `json:"bidSize"`
-			AskPrice  string `json:"askPrice"`
-			AskSize   string `json:"askSize"`
-			Timestamp string `json:"timestamp"`
+			BidPrice  string `json:"bid1Price"`
+			BidSize   string `json:"bid1Size"`
+			AskPrice  string `json:"ask1Price"`
+			AskSize   string `json:"ask1Size"`
 		} `json:"data"`
 	}
 
@@ -279,42 +479,39 @@ func (p *MessageParser) parseTicker(message []byte, symbol string) (*market.Tick
 		return nil, fmt.Errorf("failed to unmarshal ticker message: %w", err)
 	}
 
-	bidPrice, err := parseFloat(tickerMsg.Data.BidPrice)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse bid price: %w", err)
+	ticker := &market.Ticker{
+		Symbol:     symbol,
+		Time:       time.UnixMilli(tickerMsg.Ts),
+		Timestamps: stamps,
 	}
 
-	bidSize, err := parseFloat(tickerMsg.Data.BidSize)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse bid size: %w", err)
+	fields := []struct {
+		name  string
+		value string
+		dst   *float64
+	}{
+		{"last price", tickerMsg.Data.LastPrice, &ticker.LastPrice},
+		{"bid price", tickerMsg.Data.BidPrice, &ticker.Bid},
+		{"bid size", tickerMsg.Data.BidSize, &ticker.BidSize},
+		{"ask price", tickerMsg.Data.AskPrice, &ticker.Ask},
+		{"ask size", tickerMsg.Data.AskSize, &ticker.AskSize},
 	}
-
-	askPrice, err := parseFloat(tickerMsg.Data.AskPrice)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse ask price: %w", err)
-	}
-
-	askSize, err := parseFloat(tickerMsg.Data.AskSize)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse ask size: %w", err)
-	}
-
-	timestamp, err := parseTimestamp(tickerMsg.Data.Timestamp)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse ticker timestamp: %w", err)
+	for _, f := range fields {
+		if f.value == "" {
+			continue
+		}
+		v, err := parseFloat(f.value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", f.name, err)
+		}
+		*f.dst = v
 	}
 
-	return &market.Ticker{
-		Bid:     bidPrice,
-		BidSize: bidSize,
-		Ask:     askPrice,
-		AskSize: askSize,
-		Time:    timestamp,
-	}, nil
+	return ticker, nil
 }
 
-// Helper function to split a topic string
-func splitTopic(topic string) []string {
+// SplitTopic splits a topic string such as "orderbook.1.BTCUSDT" into its parts
+func SplitTopic(topic string) []string {
 	var result []string
 	var currentPart string
 	inDots := false
@@ -350,6 +547,14 @@ func parseFloat(s string) (float64, error) {
 	return result, err
 }
 
+// unixMilli converts Unix milliseconds to a time, zero when ms is not set
+func unixMilli(ms int64) time.Time {
+	if ms <= 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
+
 // Helper function to parse a timestamp
 func parseTimestamp(s string) (time.Time, error) {
 	// Try parsing as Unix milliseconds
@@ -0,0 +1,472 @@
+package server
+
+import (
+	"bybit_connector/handler"
+	"bybit_connector/internal/socket"
+	"bybit_connector/pkg/logging"
+	"bybit_connector/pkg/market"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Gateway re-broadcasts the normalized market data of a WebSocketHandler
+// to local WebSocket clients, so that one upstream connection serves any
+// number of consumers. Clients send
+//
+//	{"op":"subscribe","args":["book.BTCUSDT","bbo.BTCUSDT","trades.BTCUSDT","candles.1m.BTCUSDT"]}
+//	{"op":"unsubscribe","args":[...]}
+//	{"op":"ping"}
+//
+// and receive a snapshot of each topic followed by its updates:
+//
+//	{"topic":"book.BTCUSDT","type":"snapshot","seq":41,"ts":"...","data":{"bids":[...],"asks":[...]}}
+//	{"topic":"book.BTCUSDT","type":"delta","seq":42,"ts":"...","data":{"bids":[{"amount":0,"price":100}],"asks":[]}}
+//
+// Sequence numbers are the gateway's own and count the messages of a
+// topic: each update carries the seq of the previous one plus one, the
+// first update after a snapshot its seq plus one. A book delta gives the
+// new size of each changed level, zero removing it. Trades, BBO and
+// candles are sent as "update" messages.
+type Gateway struct {
+	Streams *socket.Streams
+	// CandleIntervals are the intervals candle topics may be subscribed to,
+	// those the handler builds
+	CandleIntervals []time.Duration
+	// SendBuffer is the number of messages queued per client. A client
+	// falling further behind is disconnected.
+	SendBuffer int
+	// TradeHistory is the number of trades in a trades snapshot
+	TradeHistory int
+	// Logger receives the gateway's records. The default logger is used
+	// when it is nil.
+	Logger *slog.Logger
+
+	upgrader websocket.Upgrader
+
+	mu      sync.Mutex
+	seq     map[string]uint64
+	books   map[string]*market.OrderBook
+	bbo     map[string]market.Ticker
+	trades  map[string][]market.Trade
+	candles map[string]market.Candle
+	subs    map[string]map[*gatewayClient]bool
+}
+
+// GatewayMessage is a message sent to gateway clients
+type GatewayMessage struct {
+	Topic string      `json:"topic"`
+	Type  string      `json:"type"`
+	Seq   uint64      `json:"seq"`
+	Time  time.Time   `json:"ts"`
+	Data  interface{} `json:"data"`
+}
+
+// BookData is the data of book snapshots and deltas
+type BookData struct {
+	Bids []market.Item `json:"bids"`
+	Asks []market.Item `json:"asks"`
+}
+
+// gatewayRequest is an op sent by a client
+type gatewayRequest struct {
+	Op   string   `json:"op"`
+	Args []string `json:"args"`
+}
+
+// gatewayResponse acknowledges an op
+type gatewayResponse struct {
+	Op      string   `json:"op"`
+	Success bool     `json:"success"`
+	Args    []string `json:"args,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+type gatewayClient struct {
+	conn *websocket.Conn
+	send chan []byte
+	// topics is only used under the gateway's lock
+	topics map[string]bool
+	done   chan struct{}
+	once   sync.Once
+}
+
+// NewGateway creates a gateway validating symbols against streams
+func NewGateway(streams *socket.Streams) *Gateway {
+	return &Gateway{
+		Streams:      streams,
+		SendBuffer:   1024,
+		TradeHistory: 50,
+		upgrader: websocket.Upgrader{
+			// Consumers are local services, not browsers of other origins
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+		seq:     make(map[string]uint64),
+		books:   make(map[string]*market.OrderBook),
+		bbo:     make(map[string]market.Ticker),
+		trades:  make(map[string][]market.Trade),
+		candles: make(map[string]market.Candle),
+		subs:    make(map[string]map[*gatewayClient]bool),
+	}
+}
+
+// Attach chains the gateway to the handler's callbacks. Call it before the
+// handler receives messages; callbacks installed earlier keep being called.
+func (g *Gateway) Attach(h *handler.WebSocketHandler) {
+	g.CandleIntervals = h.CandleIntervals
+
+	onBook, onBBO, onTrade, onCandle := h.OnOrderBook, h.OnBBO, h.OnTrade, h.OnCandle
+	h.OnOrderBook = func(symbol string, book *market.OrderBook) {
+		if onBook != nil {
+			onBook(symbol, book)
+		}
+		g.PublishBook(symbol, book)
+	}
+	h.OnBBO = func(t market.Ticker) {
+		if onBBO != nil {
+			onBBO(t)
+		}
+		if t.Derived {
+			g.PublishBBO(t)
+		}
+	}
+	h.OnTrade = func(t market.Trade) {
+		if onTrade != nil {
+			onTrade(t)
+		}
+		g.PublishTrade(t)
+	}
+	h.OnCandle = func(c market.Candle) {
+		if onCandle != nil {
+			onCandle(c)
+		}
+		g.PublishCandle(c)
+	}
+}
+
+// PublishBook sends the levels that changed since the previous book of a
+// symbol. book is not modified.
+func (g *Gateway) PublishBook(symbol string, book *market.OrderBook) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	prev := g.books[symbol]
+	if prev == nil {
+		prev = &market.OrderBook{}
+	}
+	delta := BookData{Bids: diffLevels(prev.Bids, book.Bids), Asks: diffLevels(prev.Asks, book.Asks)}
+	g.books[symbol] = book
+	if len(delta.Bids) == 0 && len(delta.Asks) == 0 {
+		return
+	}
+	g.publish("book."+symbol, "delta", book.Timestamp, delta)
+}
+
+// PublishBBO sends a best bid and offer derived from the local book
+func (g *Gateway) PublishBBO(t market.Ticker) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.bbo[t.Symbol] = t
+	g.publish("bbo."+t.Symbol, "update", t.Time, t)
+}
+
+// PublishTrade sends a public trade
+func (g *Gateway) PublishTrade(t market.Trade) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	trades := append(g.trades[t.Symbol], t)
+	if len(trades) > g.TradeHistory {
+		trades = trades[len(trades)-g.TradeHistory:]
+	}
+	g.trades[t.Symbol] = trades
+	g.publish("trades."+t.Symbol, "update", t.Time, t)
+}
+
+// PublishCandle sends an in-progress, closed or reconciled candle
+func (g *Gateway) PublishCandle(c market.Candle) {
+	topic := "candles." + intervalName(c.Interval) + "." + c.Symbol
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.candles[topic] = c
+	g.publish(topic, "update", c.Start, c)
+}
+
+// Forget drops the state kept for a symbol that is no longer tracked.
+// Book subscribers receive a delta emptying the book; subscriptions are
+// kept and resume if the symbol is tracked again.
+func (g *Gateway) Forget(symbol string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if book := g.books[symbol]; book != nil {
+		empty := BookData{Bids: diffLevels(book.Bids, nil), Asks: diffLevels(book.Asks, nil)}
+		g.publish("book."+symbol, "delta", time.Now(), empty)
+		delete(g.books, symbol)
+	}
+	delete(g.bbo, symbol)
+	delete(g.trades, symbol)
+	for topic := range g.candles {
+		if strings.HasSuffix(topic, "."+symbol) {
+			delete(g.candles, topic)
+		}
+	}
+}
+
+// publish sends a message to the subscribers of a topic.
+// The caller must hold the lock.
+func (g *Gateway) publish(topic, typ string, ts time.Time, data interface{}) {
+	g.seq[topic]++
+	subs := g.subs[topic]
+	if len(subs) == 0 {
+		return
+	}
+	msg, err := json.Marshal(GatewayMessage{Topic: topic, Type: typ, Seq: g.seq[topic], Time: ts, Data: data})
+	if err != nil {
+		logging.Or(g.Logger).Error("Gateway failed to marshal a message", "topic", topic, "error", err)
+		return
+	}
+	for c := range subs {
+		g.deliver(c, msg)
+	}
+}
+
+// deliver queues a message for a client, disconnecting it when its queue
+// is full. The caller must hold the lock.
+func (g *Gateway) deliver(c *gatewayClient, msg []byte) {
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+	select {
+	case c.send <- msg:
+	default:
+		logging.Or(g.Logger).Warn("Gateway disconnecting a slow client", "remote", c.conn.RemoteAddr().String())
+		g.drop(c)
+	}
+}
+
+// drop unsubscribes a client from every topic and closes it.
+// The caller must hold the lock.
+func (g *Gateway) drop(c *gatewayClient) {
+	for topic := range c.topics {
+		delete(g.subs[topic], c)
+	}
+	c.topics = map[string]bool{}
+	c.close()
+}
+
+// subscribe registers a client for a topic and queues its snapshot.
+// The caller must hold the lock.
+func (g *Gateway) subscribe(c *gatewayClient, topic string) error {
+	kind, symbol, interval, err := g.parseTopic(topic)
+	if err != nil {
+		return err
+	}
+
+	var data interface{}
+	ts := time.Now()
+	switch kind {
+	case "book":
+		data = BookData{Bids: []market.Item{}, Asks: []market.Item{}}
+		if book := g.books[symbol]; book != nil {
+			data, ts = BookData{Bids: book.Bids, Asks: book.Asks}, book.Timestamp
+		}
+	case "bbo":
+		if t, ok := g.bbo[symbol]; ok {
+			data, ts = t, t.Time
+		}
+	case "trades":
+		data = append([]market.Trade{}, g.trades[symbol]...)
+	case "candles":
+		if c, ok := g.candles["candles."+intervalName(interval)+"."+symbol]; ok {
+			data = c
+		}
+	}
+
+	msg, err := json.Marshal(GatewayMessage{Topic: topic, Type: "snapshot", Seq: g.seq[topic], Time: ts, Data: data})
+	if err != nil {
+		return err
+	}
+	if g.subs[topic] == nil {
+		g.subs[topic] = make(map[*gatewayClient]bool)
+	}
+	g.subs[topic][c] = true
+	c.topics[topic] = true
+	g.deliver(c, msg)
+	return nil
+}
+
+// parseTopic validates a topic of a tracked symbol
+func (g *Gateway) parseTopic(topic string) (kind, symbol string, interval time.Duration, err error) {
+	parts := strings.Split(topic, ".")
+	switch {
+	case len(parts) == 2 && (parts[0] == "book" || parts[0] == "bbo" || parts[0] == "trades"):
+		kind, symbol = parts[0], parts[1]
+	case len(parts) == 3 && parts[0] == "candles":
+		kind, symbol = parts[0], parts[2]
+		for _, d := range g.CandleIntervals {
+			if intervalName(d) == parts[1] {
+				interval = d
+			}
+		}
+		if interval == 0 {
+			return "", "", 0, fmt.Errorf("%s: candles are not built for interval %s", topic, parts[1])
+		}
+	default:
+		return "", "", 0, fmt.Errorf("unknown topic %s", topic)
+	}
+
+	for _, sym := range g.Streams.Symbols() {
+		if sym.Symbol == symbol {
+			return kind, symbol, interval, nil
+		}
+	}
+	return "", "", 0, fmt.Errorf("%s: symbol %s is not tracked", topic, symbol)
+}
+
+// ServeHTTP upgrades the request and serves the client until it disconnects
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := g.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	c := &gatewayClient{
+		conn:   conn,
+		send:   make(chan []byte, g.SendBuffer),
+		topics: make(map[string]bool),
+		done:   make(chan struct{}),
+	}
+	go c.writeLoop()
+	g.readLoop(c)
+
+	g.mu.Lock()
+	g.drop(c)
+	g.mu.Unlock()
+}
+
+// readLoop handles the ops of a client
+func (g *Gateway) readLoop(c *gatewayClient) {
+	c.conn.SetReadLimit(64 * 1024)
+	c.conn.SetReadDeadline(time.Now().Add(gatewayPongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(gatewayPongWait))
+	})
+
+	for {
+		var req gatewayRequest
+		if err := c.conn.ReadJSON(&req); err != nil {
+			return
+		}
+		c.conn.SetReadDeadline(time.Now().Add(gatewayPongWait))
+
+		resp := gatewayResponse{Op: req.Op, Success: true, Args: req.Args}
+		g.mu.Lock()
+		switch req.Op {
+		case "ping":
+			resp.Op = "pong"
+		case "subscribe":
+			var errs []string
+			for _, topic := range req.Args {
+				if c.topics[topic] {
+					continue
+				}
+				if err := g.subscribe(c, topic); err != nil {
+					errs = append(errs, err.Error())
+				}
+			}
+			if len(errs) > 0 {
+				resp.Success, resp.Error = false, strings.Join(errs, "; ")
+			}
+		case "unsubscribe":
+			for _, topic := range req.Args {
+				delete(g.subs[topic], c)
+				delete(c.topics, topic)
+			}
+		default:
+			resp.Success, resp.Error = false, fmt.Sprintf("unknown op %q", req.Op)
+		}
+		// Acknowledgements are queued like data, so a subscribe's ack
+		// follows its snapshots
+		if msg, err := json.Marshal(resp); err == nil {
+			g.deliver(c, msg)
+		}
+		g.mu.Unlock()
+	}
+}
+
+// Timeouts of gateway connections
+const (
+	gatewayPongWait   = 60 * time.Second
+	gatewayPingPeriod = 20 * time.Second
+	gatewayWriteWait  = 10 * time.Second
+)
+
+// writeLoop sends the queued messages and pings of a client
+func (c *gatewayClient) writeLoop() {
+	ping := time.NewTicker(gatewayPingPeriod)
+	defer ping.Stop()
+	defer c.conn.Close()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case msg := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(gatewayWriteWait))
+			if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				c.close()
+				return
+			}
+		case <-ping.C:
+			c.conn.SetWriteDeadline(time.Now().Add(gatewayWriteWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				c.close()
+				return
+			}
+		}
+	}
+}
+
+func (c *gatewayClient) close() {
+	c.once.Do(func() { close(c.done) })
+}
+
+// diffLevels returns the levels of next whose size differs from prev, and
+// the levels of prev missing from next with a size of zero
+func diffLevels(prev, next []market.Item) []market.Item {
+	sizes := make(map[float64]float64, len(prev))
+	for _, it := range prev {
+		sizes[it.Price] = it.Amount
+	}
+	changed := []market.Item{}
+	for _, it := range next {
+		if size, ok := sizes[it.Price]; !ok || size != it.Amount {
+			changed = append(changed, it)
+		}
+		delete(sizes, it.Price)
+	}
+	for price := range sizes {
+		changed = append(changed, market.Item{Price: price})
+	}
+	return changed
+}
+
+// intervalName formats a candle interval as 1s, 1m, 5m, 1h or 1d
+func intervalName(d time.Duration) string {
+	switch {
+	case d >= 24*time.Hour && d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	case d >= time.Hour && d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d >= time.Minute && d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	default:
+		return d.String()
+	}
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// readMessage reads the next gateway message, skipping acknowledgements
+func readMessage(t *testing.T, conn *websocket.Conn) GatewayMessage {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		_, raw, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(raw), `"op"`) {
+			continue
+		}
+		var msg struct {
+			GatewayMessage
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			t.Fatal(err)
+		}
+		msg.GatewayMessage.Data = msg.Data
+		return msg.GatewayMessage
+	}
+}
+
+func TestGatewaySnapshotThenDeltas(t *testing.T) {
+	s := newTestServer(t)
+	h := s.Handler
+	g := NewGateway(s.Streams)
+	g.Attach(h)
+	// The book received before attaching is published by the next update
+	h.HandleMessage([]byte(`{"topic":"orderbook.50.BTCUSDT","type":"delta","ts":2000,"data":{"s":"BTCUSDT","b":[["100","5"]],"a":[],"u":8,"seq":2}}`))
+
+	server := httptest.NewServer(g)
+	defer server.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err := conn.WriteJSON(gatewayRequest{Op: "subscribe", Args: []string{"book.BTCUSDT", "trades.BTCUSDT"}}); err != nil {
+		t.Fatal(err)
+	}
+	snap := readMessage(t, conn)
+	var book BookData
+	json.Unmarshal(snap.Data.(json.RawMessage), &book)
+	if snap.Topic != "book.BTCUSDT" || snap.Type != "snapshot" || snap.Seq != 1 || len(book.Bids) != 3 || book.Bids[0].Amount != 5 {
+		t.Fatalf("unexpected book snapshot: %+v %+v", snap, book)
+	}
+	if trades := readMessage(t, conn); trades.Topic != "trades.BTCUSDT" || trades.Type != "snapshot" {
+		t.Fatalf("unexpected trades snapshot: %+v", trades)
+	}
+
+	h.HandleMessage([]byte(`{"topic":"orderbook.50.BTCUSDT","type":"delta","ts":3000,"data":{"s":"BTCUSDT","b":[["99","0"]],"a":[["101","4"]],"u":9,"seq":3}}`))
+	delta := readMessage(t, conn)
+	json.Unmarshal(delta.Data.(json.RawMessage), &book)
+	if delta.Type != "delta" || delta.Seq != 2 {
+		t.Fatalf("expected the delta following the snapshot: %+v", delta)
+	}
+	if len(book.Bids) != 1 || book.Bids[0].Price != 99 || book.Bids[0].Amount != 0 ||
+		len(book.Asks) != 1 || book.Asks[0].Amount != 4 {
+		t.Fatalf("unexpected delta levels: %+v", book)
+	}
+
+	if err := conn.WriteJSON(gatewayRequest{Op: "subscribe", Args: []string{"book.ETHUSDT"}}); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	var resp gatewayResponse
+	if err := conn.ReadJSON(&resp); err != nil || resp.Success || resp.Error == "" {
+		t.Fatalf("expected an untracked symbol to be rejected: %+v %v", resp, err)
+	}
+}
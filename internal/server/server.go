@@ -0,0 +1,279 @@
+// Package server exposes the state of a running connector to other
+// processes over HTTP.
+package server
+
+import (
+	"bybit_connector/handler"
+	"bybit_connector/internal/config"
+	"bybit_connector/internal/socket"
+	"bybit_connector/pkg/market"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Server serves the books, tickers and trades of a WebSocketHandler:
+//
+//	GET /books/{symbol}?depth=N   top N levels per side of the local book
+//	GET /tickers                  tickers of every tracked symbol
+//	GET /tickers/{symbol}         exchange ticker, or the book's BBO
+//	GET /trades/{symbol}?since=   buffered trades after a trade ID, the
+//	                              last duration, an RFC 3339 time or Unix ms
+//	GET /subscriptions            subscribed topics per category
+//	GET /health                   connection state, 503 when degraded
+//
+// More handlers, such as the Gateway, are added with Handle.
+type Server struct {
+	Handler *handler.WebSocketHandler
+	Streams *socket.Streams
+	// LastMessage, when set, returns the time of the latest stream message
+	// reported by /health
+	LastMessage func() time.Time
+	// StaleAfter is how long without messages /health reports as degraded
+	StaleAfter time.Duration
+
+	mux *http.ServeMux
+}
+
+// New creates the server of a handler fed by streams
+func New(h *handler.WebSocketHandler, streams *socket.Streams) *Server {
+	s := &Server{Handler: h, Streams: streams, StaleAfter: 30 * time.Second, mux: http.NewServeMux()}
+	s.mux.HandleFunc("GET /books/{symbol}", s.book)
+	s.mux.HandleFunc("GET /tickers", s.tickers)
+	s.mux.HandleFunc("GET /tickers/{symbol}", s.ticker)
+	s.mux.HandleFunc("GET /trades/{symbol}", s.trades)
+	s.mux.HandleFunc("GET /subscriptions", s.subscriptions)
+	s.mux.HandleFunc("GET /health", s.health)
+	return s
+}
+
+// Handle registers an additional handler, such as the gateway or metrics
+func (s *Server) Handle(pattern string, h http.Handler) {
+	s.mux.Handle(pattern, h)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// ListenAndServe serves on addr until ctx is done
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	srv := &http.Server{Addr: addr, Handler: s, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdown)
+	}()
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("http server: %w", err)
+	}
+	return nil
+}
+
+// Book is the response of /books/{symbol}
+type Book struct {
+	Symbol    string        `json:"symbol"`
+	Category  string        `json:"category"`
+	Timestamp time.Time     `json:"timestamp"`
+	UpdateID  int64         `json:"update_id"`
+	Synced    bool          `json:"synced"`
+	Bids      []market.Item `json:"bids"`
+	Asks      []market.Item `json:"asks"`
+}
+
+// Trades is the response of /trades/{symbol}. Complete is false when the
+// trade ID given as since is no longer buffered, so trades may be missing.
+type Trades struct {
+	Symbol   string         `json:"symbol"`
+	Complete bool           `json:"complete"`
+	Trades   []market.Trade `json:"trades"`
+}
+
+// Health is the response of /health
+type Health struct {
+	Status      string          `json:"status"`
+	Connections map[string]bool `json:"connections"`
+	Symbols     int             `json:"symbols"`
+	LastMessage *time.Time      `json:"last_message,omitempty"`
+}
+
+func (s *Server) book(w http.ResponseWriter, r *http.Request) {
+	sym, ok := s.symbol(w, r)
+	if !ok {
+		return
+	}
+	depth := 0
+	if v := r.URL.Query().Get("depth"); v != "" {
+		var err error
+		if depth, err = strconv.Atoi(v); err != nil || depth < 1 {
+			writeError(w, http.StatusBadRequest, "depth must be a positive integer")
+			return
+		}
+	}
+
+	book, updateID, synced := s.Handler.GetOrderBookState(sym.Symbol)
+	if book == nil {
+		writeError(w, http.StatusServiceUnavailable, "no book received yet for "+sym.Symbol)
+		return
+	}
+	resp := Book{
+		Symbol:    sym.Symbol,
+		Category:  string(sym.Category),
+		Timestamp: book.Timestamp,
+		UpdateID:  updateID,
+		Synced:    synced,
+		Bids:      top(book.Bids, depth),
+		Asks:      top(book.Asks, depth),
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) tickers(w http.ResponseWriter, r *http.Request) {
+	tickers := []market.Ticker{}
+	for _, sym := range s.Streams.Symbols() {
+		if t := s.tickerOf(sym.Symbol); t != nil {
+			tickers = append(tickers, *t)
+		}
+	}
+	writeJSON(w, http.StatusOK, tickers)
+}
+
+func (s *Server) ticker(w http.ResponseWriter, r *http.Request) {
+	sym, ok := s.symbol(w, r)
+	if !ok {
+		return
+	}
+	t := s.tickerOf(sym.Symbol)
+	if t == nil {
+		writeError(w, http.StatusServiceUnavailable, "no ticker received yet for "+sym.Symbol)
+		return
+	}
+	writeJSON(w, http.StatusOK, t)
+}
+
+// tickerOf returns the exchange ticker of a symbol, falling back to the
+// best bid and offer of its local book
+func (s *Server) tickerOf(symbol string) *market.Ticker {
+	if t := s.Handler.GetTicker(symbol); t != nil {
+		return t
+	}
+	return s.Handler.GetBBO(symbol)
+}
+
+func (s *Server) trades(w http.ResponseWriter, r *http.Request) {
+	sym, ok := s.symbol(w, r)
+	if !ok {
+		return
+	}
+	resp := Trades{Symbol: sym.Symbol, Complete: true}
+	since := r.URL.Query().Get("since")
+	switch {
+	case since == "":
+		resp.Trades = s.Handler.GetTrades(sym.Symbol)
+	default:
+		if d, err := time.ParseDuration(since); err == nil {
+			resp.Trades = s.Handler.GetTradesSince(sym.Symbol, d)
+		} else if t, ok := parseTime(since); ok {
+			for _, trade := range s.Handler.GetTrades(sym.Symbol) {
+				if trade.Time.After(t) {
+					resp.Trades = append(resp.Trades, trade)
+				}
+			}
+		} else {
+			resp.Trades, resp.Complete = s.Handler.GetTradesSinceID(sym.Symbol, since)
+		}
+	}
+	if resp.Trades == nil {
+		resp.Trades = []market.Trade{}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) subscriptions(w http.ResponseWriter, r *http.Request) {
+	subs := make(map[string][]string)
+	for category, topics := range s.Streams.Subscriptions() {
+		sort.Strings(topics)
+		subs[string(category)] = topics
+	}
+	writeJSON(w, http.StatusOK, subs)
+}
+
+func (s *Server) health(w http.ResponseWriter, r *http.Request) {
+	symbols := s.Streams.Symbols()
+	resp := Health{Status: "ok", Connections: make(map[string]bool), Symbols: len(symbols)}
+	for _, sym := range symbols {
+		connected := s.Streams.Connected(sym.Category)
+		resp.Connections[string(sym.Category)] = connected
+		if !connected {
+			resp.Status = "degraded"
+		}
+	}
+	if s.LastMessage != nil {
+		if last := s.LastMessage(); !last.IsZero() {
+			resp.LastMessage = &last
+			if s.StaleAfter > 0 && time.Since(last) > s.StaleAfter {
+				resp.Status = "degraded"
+			}
+		}
+	}
+
+	status := http.StatusOK
+	if resp.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, resp)
+}
+
+// symbol looks up the tracked symbol of the request path
+func (s *Server) symbol(w http.ResponseWriter, r *http.Request) (config.SymbolConfig, bool) {
+	name := strings.ToUpper(r.PathValue("symbol"))
+	for _, sym := range s.Streams.Symbols() {
+		if sym.Symbol == name {
+			return sym, true
+		}
+	}
+	writeError(w, http.StatusNotFound, "symbol "+name+" is not tracked")
+	return config.SymbolConfig{}, false
+}
+
+// parseTime accepts an RFC 3339 time or Unix milliseconds. Numeric spot
+// trade IDs are longer than millisecond timestamps.
+func parseTime(s string) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, true
+	}
+	if ms, err := strconv.ParseInt(s, 10, 64); err == nil && ms > 1e12 && ms < 1e14 {
+		return time.UnixMilli(ms), true
+	}
+	return time.Time{}, false
+}
+
+func top(items []market.Item, n int) []market.Item {
+	if n > 0 && len(items) > n {
+		items = items[:n]
+	}
+	if items == nil {
+		return []market.Item{}
+	}
+	return items
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Warn("Failed to write response", "error", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
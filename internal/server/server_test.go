@@ -0,0 +1,91 @@
+package server
+
+import (
+	"bybit_connector/handler"
+	"bybit_connector/internal/config"
+	"bybit_connector/internal/socket"
+	"bybit_connector/pkg/market"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTestServer tracks BTCUSDT without connecting and feeds the handler a
+// book snapshot and two trades
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	conf := &config.Config{Symbols: []config.SymbolConfig{{Symbol: "BTCUSDT", Category: market.CategoryLinear, Depth: 50}}}
+	h := handler.NewWebSocketHandler()
+	h.HandleMessage([]byte(`{"topic":"orderbook.50.BTCUSDT","type":"snapshot","ts":1000,"data":{"s":"BTCUSDT",` +
+		`"b":[["100","1"],["99","2"],["98","3"]],"a":[["101","1"],["102","2"],["103","3"]],"u":7,"seq":1}}`))
+	h.HandleMessage([]byte(`{"topic":"publicTrade.BTCUSDT","type":"snapshot","ts":1000,"data":[` +
+		`{"T":1000,"s":"BTCUSDT","S":"Buy","v":"1","p":"100","L":"PlusTick","i":"a","BT":false},` +
+		`{"T":1500,"s":"BTCUSDT","S":"Sell","v":"2","p":"99","L":"MinusTick","i":"b","BT":false}]}`))
+	return New(h, socket.NewStreams(conf, nil, nil))
+}
+
+func get(t *testing.T, s *Server, path string, out interface{}) int {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s: %v: %s", path, err, rec.Body)
+		}
+	}
+	return rec.Code
+}
+
+func TestBookDepth(t *testing.T) {
+	s := newTestServer(t)
+
+	var book Book
+	if code := get(t, s, "/books/btcusdt?depth=2", &book); code != http.StatusOK {
+		t.Fatalf("unexpected status %d", code)
+	}
+	if len(book.Bids) != 2 || len(book.Asks) != 2 || book.Bids[0].Price != 100 || book.Asks[0].Price != 101 {
+		t.Fatalf("unexpected book: %+v", book)
+	}
+	if book.UpdateID != 7 || !book.Synced {
+		t.Fatalf("expected a synced book at update 7: %+v", book)
+	}
+
+	if code := get(t, s, "/books/BTCUSDT?depth=x", nil); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an invalid depth, got %d", code)
+	}
+	if code := get(t, s, "/books/ETHUSDT", nil); code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an untracked symbol, got %d", code)
+	}
+}
+
+func TestTradesSince(t *testing.T) {
+	s := newTestServer(t)
+
+	var trades Trades
+	get(t, s, "/trades/BTCUSDT?since=a", &trades)
+	if !trades.Complete || len(trades.Trades) != 1 || trades.Trades[0].TradeId != "b" {
+		t.Fatalf("expected the trade after a: %+v", trades)
+	}
+
+	trades = Trades{}
+	get(t, s, "/trades/BTCUSDT?since=1200", &trades)
+	if len(trades.Trades) != 2 {
+		t.Fatalf("expected every trade after an unknown ID: %+v", trades)
+	}
+	if trades.Complete {
+		t.Fatal("expected an unknown trade ID to be reported incomplete")
+	}
+}
+
+func TestHealthReportsDisconnectedStreams(t *testing.T) {
+	s := newTestServer(t)
+
+	var health Health
+	if code := get(t, s, "/health", &health); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", code)
+	}
+	if health.Status != "degraded" || health.Connections["linear"] || health.Symbols != 1 {
+		t.Fatalf("unexpected health: %+v", health)
+	}
+}
@@ -2,11 +2,19 @@ package socket
 
 import (
 	"bybit_connector/internal/config"
+	"bybit_connector/pkg/logging"
+	"bybit_connector/pkg/metrics"
+	"bybit_connector/pkg/ratelimit"
+	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
-	"log"
+	"log/slog"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -14,16 +22,41 @@ import (
 
 // WebSocket connection implementation
 type WebSocketClient struct {
-	Conn            *websocket.Conn
-	URL             string
-	APIKey          string
-	APISecret       string
+	// Conn is the current connection, replaced on reconnect. It is guarded
+	// by the client's lock and written through sendJSON.
+	Conn      *websocket.Conn
+	URL       string
+	APIKey    string
+	APISecret string
+	// Subscription holds the subscribed topics. It is guarded by the
+	// client's lock; read it through Subscriptions.
 	Subscription    map[string]bool
 	MessageHandler  func([]byte)
 	ErrorHandler    func(error)
 	Done            chan struct{}
 	Config          *config.Config
 	IsAuthenticated bool
+	// Limiter paces connects and subscribes so that reconnect storms stay
+	// within the per-IP limits. Share it between clients of the same host.
+	Limiter *ratelimit.Limiter
+	// Metrics, when set, records reconnects, the connection state and the
+	// ping round trip time, labelled with Name
+	Metrics *metrics.Connector
+	Name    string
+	// Logger receives the client's records with the conn_id of the current
+	// connection. The default logger is used when it is nil.
+	Logger *slog.Logger
+
+	mu sync.Mutex
+	// writeMu serializes the writes of subscribes and pings, which the
+	// connection does not allow concurrently
+	writeMu sync.Mutex
+
+	connected atomic.Bool
+	// connID identifies the current connection in logs
+	connID atomic.Int64
+	// pingSent is the UnixNano time of the unanswered ping, zero when none
+	pingSent atomic.Int64
 }
 
 // Message represents the basic structure of Bybit WebSocket messages
@@ -34,8 +67,13 @@ type Message struct {
 	Ts    int64       `json:"ts,omitempty"`
 	Op    string      `json:"op,omitempty"`
 	Args  []string    `json:"args,omitempty"`
+	// ReqID is echoed by Bybit in the response to an op
+	ReqID string `json:"req_id,omitempty"`
 }
 
+// connIDs and reqIDs number the connections and op requests of the process
+var connIDs, reqIDs atomic.Int64
+
 // AuthMessage reprsents an authentication message for private channels
 type AuthMessage struct {
 	Op   string   `json:"op"`
@@ -54,6 +92,7 @@ func NewWebSocketClient(config *config.Config, messageHandler func([]byte), erro
 		Done:            make(chan struct{}),
 		Config:          config,
 		IsAuthenticated: false,
+		Limiter:         ratelimit.NewLimiter(),
 	}
 }
 
@@ -71,15 +110,25 @@ SendJson()
 
 // connect esatablihses a webSocket connection to Bybit
 func (c *WebSocketClient) Connect() error {
-	var err error
-	c.Conn, _, err = websocket.DefaultDialer.Dial(c.URL, nil)
+	if err := c.wait(ratelimit.GroupWSConnect); err != nil {
+		return err
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(c.URL, nil)
 	if err != nil {
 		return fmt.Errorf("websocket dial error: %w", err)
 	}
+	c.mu.Lock()
+	c.Conn = conn
+	c.mu.Unlock()
+	c.connected.Store(true)
+	c.connID.Store(connIDs.Add(1))
+	c.Metrics.Connected(c.Name, true)
+	c.logger().Info("Connected", "url", c.URL)
 
 	//Start listeners
-	go c.listen() // we wil define it later
-	go c.keepAlive()
+	go c.listen(conn)
+	go c.keepAlive(conn)
 
 	//Athenticate if credential are provided
 	if c.APIKey != "" && c.APISecret != "" {
@@ -96,21 +145,8 @@ func (c *WebSocketClient) authenticate() error {
 	//generate timestamp (expiry)
 	expires := time.Now().Unix()*1000 + 10000 // 10 seconds from now
 
-	// create signature
-	signaturePayload := fmt.Sprintf("GET/realtime%d", expires)
-	h := hmac.New(sha256.New, []byte(c.APISecret))
-	h.Write([]byte(signaturePayload))
-	signature := hex.EncodeToString(h.Sum(nil))
-
 	//create autyh message
-	auth := AuthMessage{
-		Op: "auth",
-		Args: []string{
-			c.APIKey,
-			fmt.Sprintf("%d", expires),
-			signature,
-		},
-	}
+	auth := newAuthMessage(c.APIKey, c.APISecret, expires)
 
 	//send auth message
 	err := c.sendJSON(auth)
@@ -122,65 +158,166 @@ func (c *WebSocketClient) authenticate() error {
 	return nil
 }
 
-// Subscibe subscribes to one or more topicvs
-func (c *WebSocketClient) Subscibe(topics []string) error {
-	request := Message{
-		Op:   "subscribe",
-		Args: topics,
+// newAuthMessage signs "GET/realtime" + expires with the API secret
+func newAuthMessage(apiKey, apiSecret string, expires int64) AuthMessage {
+	h := hmac.New(sha256.New, []byte(apiSecret))
+	h.Write([]byte(fmt.Sprintf("GET/realtime%d", expires)))
+
+	return AuthMessage{
+		Op: "auth",
+		Args: []string{
+			apiKey,
+			fmt.Sprintf("%d", expires),
+			hex.EncodeToString(h.Sum(nil)),
+		},
 	}
+}
 
+// Subscibe subscribes to one or more topicvs, in requests of at most
+// maxTopicsPerRequest topics
+func (c *WebSocketClient) Subscibe(topics []string) error {
+	c.mu.Lock()
 	for _, topic := range topics {
 		c.Subscription[topic] = true
 	}
+	c.mu.Unlock()
 
-	return c.sendJSON(request)
+	for _, batch := range batches(topics) {
+		if err := c.wait(ratelimit.GroupWSSubscribe); err != nil {
+			return err
+		}
+		request := Message{
+			Op:    "subscribe",
+			Args:  batch,
+			ReqID: strconv.FormatInt(reqIDs.Add(1), 10),
+		}
+		c.logger().Debug("Subscribing", "topics", batch, "req_id", request.ReqID)
+		if err := c.sendJSON(request); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// Unsubscribe uns from onr or morw topics
+// Unsubscribe uns from onr or morw topics, in requests of at most
+// maxTopicsPerRequest topics
 func (c *WebSocketClient) Unsubscribe(topics []string) error {
-	request := Message{
-		Op:   "unsubscribe",
-		Args: topics,
-	}
-
+	c.mu.Lock()
 	for _, topic := range topics {
 		delete(c.Subscription, topic)
 	}
+	c.mu.Unlock()
+
+	for _, batch := range batches(topics) {
+		request := Message{
+			Op:    "unsubscribe",
+			Args:  batch,
+			ReqID: strconv.FormatInt(reqIDs.Add(1), 10),
+		}
+		c.logger().Debug("Unsubscribing", "topics", batch, "req_id", request.ReqID)
+		if err := c.sendJSON(request); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// maxTopicsPerRequest is the most args Bybit accepts in one spot
+// subscribe request; other categories allow more
+const maxTopicsPerRequest = 10
 
-	return c.sendJSON(request)
+// batches splits topics into requests of at most maxTopicsPerRequest
+func batches(topics []string) [][]string {
+	var out [][]string
+	for len(topics) > maxTopicsPerRequest {
+		out = append(out, topics[:maxTopicsPerRequest])
+		topics = topics[maxTopicsPerRequest:]
+	}
+	if len(topics) > 0 {
+		out = append(out, topics)
+	}
+	return out
+}
+
+// Subscriptions returns a copy of the subscribed topics
+func (c *WebSocketClient) Subscriptions() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	topics := make([]string, 0, len(c.Subscription))
+	for topic := range c.Subscription {
+		topics = append(topics, topic)
+	}
+	return topics
+}
+
+// conn returns the current connection
+func (c *WebSocketClient) conn() *websocket.Conn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Conn
+}
+
+// Connected reports whether the connection is up. It is false from a read
+// error until the reconnect succeeds.
+func (c *WebSocketClient) Connected() bool {
+	return c.connected.Load()
+}
+
+// logger returns the client's logger with the current connection ID
+func (c *WebSocketClient) logger() *slog.Logger {
+	return logging.Or(c.Logger).With("conn_id", c.connID.Load())
 }
 
 // Close closes the webSocket connection
 func (c *WebSocketClient) close() {
+	c.connected.Store(false)
+	c.Metrics.Connected(c.Name, false)
 	close(c.Done)
-	if c.Conn != nil {
-		c.Conn.Close()
+	if conn := c.conn(); conn != nil {
+		conn.Close()
+	}
+}
+
+// closed reports whether close was called
+func (c *WebSocketClient) closed() bool {
+	select {
+	case <-c.Done:
+		return true
+	default:
+		return false
 	}
 }
 
 // listen continuously reads message fron the websocket
-func (c *WebSocketClient) listen() {
-	defer func() {
-		if c.Conn != nil {
-			c.Conn.Close()
-		}
-	}()
+func (c *WebSocketClient) listen(conn *websocket.Conn) {
+	defer conn.Close()
 
 	for {
 		select {
 		case <-c.Done:
 			return
 		default:
-			_, message, err := c.Conn.ReadMessage()
+			_, message, err := conn.ReadMessage()
+			if err != nil && (c.closed() || conn != c.conn()) {
+				// Closed, or replaced by a reconnect
+				return
+			}
 			if err != nil {
+				c.connected.Store(false)
+				c.Metrics.Connected(c.Name, false)
 				if c.ErrorHandler != nil {
 					c.ErrorHandler(fmt.Errorf("read error: %w", err))
 				}
 				//try to reconnect
-				c.tyrReconnect()
+				c.tyrReconnect("read_error")
 				return
 			}
 
+			if isPong(message) {
+				if sent := c.pingSent.Swap(0); sent != 0 {
+					c.Metrics.PingRTT(c.Name, time.Since(time.Unix(0, sent)))
+				}
+			}
 			//handle pong message
 			if string(message) == "pong" {
 				continue
@@ -193,22 +330,32 @@ func (c *WebSocketClient) listen() {
 	}
 }
 
-// tryreconnect attme
-func (c *WebSocketClient) tyrReconnect() {
-	log.Printf("COnnection lost, Attempting to reconnect...")
+// isPong reports whether a message answers a ping, either the plain text
+// reply or the JSON one of the v5 API
+func isPong(message []byte) bool {
+	return string(message) == "pong" ||
+		len(message) < 256 && bytes.Contains(message, []byte(`"ret_msg":"pong"`))
+}
 
-	//Wait before reconnecting
-	time.Sleep(time.Duration(c.Config.PingInterval) * time.Second)
+// tryreconnect attme. reason is recorded in the reconnect metrics.
+func (c *WebSocketClient) tyrReconnect(reason string) {
+	c.logger().Warn("Connection lost, reconnecting", "reason", reason)
+	c.Metrics.Reconnect(c.Name, reason)
+	c.pingSent.Store(0)
 
-	//save current subscribtions
-	subscriptions := []string{}
-	for topic := range c.Subscription {
-		subscriptions = append(subscriptions, topic)
+	//Wait before reconnecting, unless closed meanwhile
+	select {
+	case <-time.After(time.Duration(c.Config.PingInterval) * time.Second):
+	case <-c.Done:
+		return
 	}
 
+	//save current subscribtions
+	subscriptions := c.Subscriptions()
+
 	//Close current connection if it exists
-	if c.Conn != nil {
-		c.Conn.Close()
+	if conn := c.conn(); conn != nil {
+		conn.Close()
 	}
 
 	//Connect again
@@ -230,23 +377,34 @@ func (c *WebSocketClient) tyrReconnect() {
 }
 
 // KeepAlive sends periodic pings to keep the connection alive
-func (c *WebSocketClient) keepAlive() {
+func (c *WebSocketClient) keepAlive(conn *websocket.Conn) {
 	ticker := time.NewTicker(time.Duration(c.Config.PingInterval) * time.Second)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			if c.Conn != nil {
-				if err := c.Conn.WriteMessage(websocket.TextMessage, []byte("ping")); err != nil {
-					if c.ErrorHandler != nil {
-						c.ErrorHandler(fmt.Errorf("ping error: %w", err))
-					}
-
-					//try to reconnect
-					c.tyrReconnect()
+			if conn != c.conn() {
+				// Replaced by a reconnect, which started a new keepAlive
+				return
+			}
+			// An unanswered ping keeps its send time, so a late pong
+			// still counts from the first ping
+			c.pingSent.CompareAndSwap(0, time.Now().UnixNano())
+			c.writeMu.Lock()
+			err := conn.WriteMessage(websocket.TextMessage, []byte("ping"))
+			c.writeMu.Unlock()
+			if err != nil {
+				if c.closed() {
 					return
 				}
+				if c.ErrorHandler != nil {
+					c.ErrorHandler(fmt.Errorf("ping error: %w", err))
+				}
+
+				//try to reconnect
+				c.tyrReconnect("ping_error")
+				return
 			}
 		case <-c.Done:
 			return
@@ -254,10 +412,24 @@ func (c *WebSocketClient) keepAlive() {
 	}
 }
 
+// wait takes a token from a limit group, if a limiter is set
+func (c *WebSocketClient) wait(group string) error {
+	if c.Limiter == nil {
+		return nil
+	}
+	if err := c.Limiter.Wait(context.Background(), group); err != nil {
+		return fmt.Errorf("%s: %w", group, err)
+	}
+	return nil
+}
+
 // sendJSON sends a JSON message trough teh websocket
 func (c *WebSocketClient) sendJSON(v interface{}) error {
-	if c.Conn == nil {
+	conn := c.conn()
+	if conn == nil {
 		return fmt.Errorf("connecting is nil")
 	}
-	return c.Conn.WriteJSON(v)
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return conn.WriteJSON(v)
 }
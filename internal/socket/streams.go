@@ -0,0 +1,221 @@
+package socket
+
+import (
+	"bybit_connector/internal/config"
+	"bybit_connector/pkg/logging"
+	"bybit_connector/pkg/market"
+	"bybit_connector/pkg/metrics"
+	"bybit_connector/pkg/ratelimit"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+// Topics returns the public topics tracked for a symbol. Liquidations are
+// only published for linear and inverse contracts.
+func Topics(s config.SymbolConfig) []string {
+	topics := []string{
+		bookTopic(s),
+		"publicTrade." + s.Symbol,
+		"tickers." + s.Symbol,
+	}
+	if s.Category == market.CategoryLinear || s.Category == market.CategoryInverse {
+		topics = append(topics, "allLiquidation."+s.Symbol)
+	}
+	return topics
+}
+
+// bookTopic returns the orderbook topic of a symbol
+func bookTopic(s config.SymbolConfig) string {
+	return fmt.Sprintf("orderbook.%d.%s", s.Depth, s.Symbol)
+}
+
+// Streams keeps one public WebSocketClient per category and subscribes
+// them to the topics of the configured symbols
+type Streams struct {
+	Config         *config.Config
+	MessageHandler func([]byte)
+	ErrorHandler   func(error)
+	// Limiter is shared by every client, so that their connects and
+	// subscribes count against the same per-IP budget
+	Limiter *ratelimit.Limiter
+	// Metrics is set on every client, which are named after their category
+	Metrics *metrics.Connector
+	// Logger is passed to every client with the connection's category
+	Logger *slog.Logger
+
+	mu      sync.Mutex
+	clients map[market.Category]*WebSocketClient
+}
+
+// NewStreams creates the streams of a configuration without connecting
+func NewStreams(conf *config.Config, messageHandler func([]byte), errorHandler func(error)) *Streams {
+	return &Streams{
+		Config:         conf,
+		MessageHandler: messageHandler,
+		ErrorHandler:   errorHandler,
+		Limiter:        ratelimit.NewLimiter(),
+		clients:        make(map[market.Category]*WebSocketClient),
+	}
+}
+
+// Apply unsubscribes the topics of removed symbols and subscribes those
+// of added ones. Clients are connected for new categories; streams of
+// unchanged symbols are left alone.
+func (s *Streams) Apply(added, removed []config.SymbolConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var errs []error
+	for category, topics := range topicsByCategory(removed) {
+		c, ok := s.clients[category]
+		if !ok {
+			continue
+		}
+		if err := c.Unsubscribe(topics); err != nil {
+			errs = append(errs, fmt.Errorf("%s: unsubscribe: %w", category, err))
+		}
+	}
+	for category, topics := range topicsByCategory(added) {
+		c, err := s.client(category)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := c.Subscibe(topics); err != nil {
+			errs = append(errs, fmt.Errorf("%s: subscribe: %w", category, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Reconcile applies the symbol changes between two configurations and
+// returns the symbols that are no longer tracked in any category, whose
+// state the caller should drop. Symbols whose depth or category changed
+// keep their state: the next snapshot replaces their book.
+func (s *Streams) Reconcile(old, new *config.Config) ([]config.SymbolConfig, error) {
+	added, removed := config.DiffSymbols(old.Symbols, new.Symbols)
+	s.mu.Lock()
+	s.Config = new
+	s.mu.Unlock()
+
+	// State is kept per symbol, whatever its category
+	tracked := make(map[string]bool, len(new.Symbols))
+	for _, sym := range new.Symbols {
+		tracked[sym.Symbol] = true
+	}
+	var dropped []config.SymbolConfig
+	for _, r := range removed {
+		if !tracked[r.Symbol] {
+			dropped = append(dropped, r)
+		}
+	}
+	return dropped, s.Apply(added, removed)
+}
+
+// ResubscribeBook unsubscribes and resubscribes the orderbook topic of a
+// symbol, so that the exchange sends a new snapshot. The lock is not held while waiting for the limiter.
+func (s *Streams) ResubscribeBook(symbol string) error {
+	type target struct {
+		category market.Category
+		client   *WebSocketClient
+		topic    []string
+	}
+	var targets []target
+	var errs []error
+	tracked := false
+	s.mu.Lock()
+	for _, sym := range s.Config.Symbols {
+		if sym.Symbol != symbol {
+			continue
+		}
+		tracked = true
+		c, ok := s.clients[sym.Category]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %s is not streamed", sym.Category, symbol))
+			continue
+		}
+		targets = append(targets, target{sym.Category, c, []string{bookTopic(sym)}})
+	}
+	s.mu.Unlock()
+	if !tracked {
+		return fmt.Errorf("%s is not tracked", symbol)
+	}
+
+	for _, t := range targets {
+		if err := t.client.Unsubscribe(t.topic); err != nil {
+			errs = append(errs, fmt.Errorf("%s: unsubscribe: %w", t.category, err))
+			continue
+		}
+		if err := t.client.Subscibe(t.topic); err != nil {
+			errs = append(errs, fmt.Errorf("%s: subscribe: %w", t.category, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Symbols returns the symbols of the current configuration
+func (s *Streams) Symbols() []config.SymbolConfig {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]config.SymbolConfig(nil), s.Config.Symbols...)
+}
+
+// Subscriptions returns the subscribed topics per category
+func (s *Streams) Subscriptions() map[market.Category][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subs := make(map[market.Category][]string, len(s.clients))
+	for category, c := range s.clients {
+		subs[category] = c.Subscriptions()
+	}
+	return subs
+}
+
+// Connected reports whether the client of a category is connected
+func (s *Streams) Connected(category market.Category) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.clients[category]
+	return ok && c.Connected()
+}
+
+// Close closes every client
+func (s *Streams) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for category, c := range s.clients {
+		c.close()
+		delete(s.clients, category)
+	}
+}
+
+// client returns the connected client of a category.
+// The caller must hold the lock.
+func (s *Streams) client(category market.Category) (*WebSocketClient, error) {
+	if c, ok := s.clients[category]; ok {
+		return c, nil
+	}
+	c := NewWebSocketClient(s.Config, s.MessageHandler, s.ErrorHandler)
+	c.URL = s.Config.Endpoints().PublicWS(category)
+	// Public streams need no authentication
+	c.APIKey, c.APISecret = "", ""
+	c.Limiter = s.Limiter
+	c.Metrics, c.Name = s.Metrics, string(category)
+	c.Logger = logging.Or(s.Logger).With("connection", string(category))
+	if err := c.Connect(); err != nil {
+		return nil, fmt.Errorf("%s: %w", category, err)
+	}
+	s.clients[category] = c
+	return c, nil
+}
+
+func topicsByCategory(symbols []config.SymbolConfig) map[market.Category][]string {
+	topics := make(map[market.Category][]string)
+	for _, s := range symbols {
+		topics[s.Category] = append(topics[s.Category], Topics(s)...)
+	}
+	return topics
+}
@@ -0,0 +1,284 @@
+package socket
+
+import (
+	"bybit_connector/internal/config"
+	"bybit_connector/pkg/market"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// opLog records the ops received by a public stream stand-in per path
+type opLog struct {
+	mu  sync.Mutex
+	ops []string
+}
+
+func (l *opLog) add(op string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ops = append(l.ops, op)
+}
+
+func (l *opLog) wait(t *testing.T, n int) []string {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		l.mu.Lock()
+		if len(l.ops) >= n {
+			ops := append([]string(nil), l.ops...)
+			l.mu.Unlock()
+			return ops
+		}
+		l.mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("expected %d ops, got %v", n, l.ops)
+	return nil
+}
+
+// expectOps checks that ops holds exactly the wanted ops, in any order, as
+// the connections of several categories write concurrently
+func expectOps(t *testing.T, ops []string, want ...string) {
+	t.Helper()
+	got := make(map[string]int)
+	for _, op := range ops {
+		got[op]++
+	}
+	for _, op := range want {
+		if got[op] == 0 {
+			t.Errorf("missing op %q in %v", op, ops)
+		}
+		got[op]--
+	}
+	for op, n := range got {
+		if n > 0 {
+			t.Errorf("unexpected op %q", op)
+		}
+	}
+}
+
+func TestStreamsReconcile(t *testing.T) {
+	log := &opLog{}
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			var msg Message
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			log.add(r.URL.Path + " " + msg.Op + " " + strings.Join(msg.Args, ","))
+		}
+	}))
+	defer server.Close()
+
+	old := &config.Config{
+		Environment:    config.EnvTestnet,
+		BybitWSBaseURL: "ws" + strings.TrimPrefix(server.URL, "http") + "/v5/public/spot",
+		PingInterval:   20,
+		Symbols: []config.SymbolConfig{
+			{Symbol: "BTCUSDT", Category: market.CategoryLinear, Depth: 50},
+			{Symbol: "ETHUSDT", Category: market.CategoryLinear, Depth: 50},
+		},
+	}
+	s := NewStreams(old, nil, nil)
+	defer s.Close()
+	if err := s.Apply(old.Symbols, nil); err != nil {
+		t.Fatal(err)
+	}
+	log.wait(t, 1)
+	if !s.Connected(market.CategoryLinear) || s.Connected(market.CategorySpot) {
+		t.Fatal("expected only the linear client to be connected")
+	}
+
+	next := *old
+	next.Symbols = []config.SymbolConfig{
+		{Symbol: "BTCUSDT", Category: market.CategoryLinear, Depth: 200},
+		{Symbol: "ETHUSDT", Category: market.CategorySpot, Depth: 50},
+	}
+	dropped, err := s.Reconcile(old, &next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ETHUSDT moved to spot and keeps its state
+	if len(dropped) != 0 {
+		t.Fatalf("expected no symbol to be dropped, got %+v", dropped)
+	}
+
+	// The initial subscribe plus the three of Reconcile
+	expectOps(t, log.wait(t, 4)[1:],
+		"/v5/public/linear unsubscribe orderbook.50.BTCUSDT,publicTrade.BTCUSDT,tickers.BTCUSDT,allLiquidation.BTCUSDT,orderbook.50.ETHUSDT,publicTrade.ETHUSDT,tickers.ETHUSDT,allLiquidation.ETHUSDT",
+		"/v5/public/linear subscribe orderbook.200.BTCUSDT,publicTrade.BTCUSDT,tickers.BTCUSDT,allLiquidation.BTCUSDT",
+		"/v5/public/spot subscribe orderbook.50.ETHUSDT,publicTrade.ETHUSDT,tickers.ETHUSDT")
+
+	subs := s.Subscriptions()
+	if len(subs[market.CategoryLinear]) != 4 || len(subs[market.CategorySpot]) != 3 {
+		t.Fatalf("unexpected subscriptions: %v", subs)
+	}
+
+	// A gap resubscribes the book in the symbol's category
+	if err := s.ResubscribeBook("BTCUSDT"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ResubscribeBook("ETHUSDT"); err != nil {
+		t.Fatal(err)
+	}
+	expectOps(t, log.wait(t, 8)[4:],
+		"/v5/public/linear unsubscribe orderbook.200.BTCUSDT",
+		"/v5/public/linear subscribe orderbook.200.BTCUSDT",
+		"/v5/public/spot unsubscribe orderbook.50.ETHUSDT",
+		"/v5/public/spot subscribe orderbook.50.ETHUSDT")
+	if err := s.ResubscribeBook("SOLUSDT"); err == nil {
+		t.Fatal("expected an error for an untracked symbol")
+	}
+}
+
+func TestWebSocketClientConcurrentWrites(t *testing.T) {
+	var writers sync.WaitGroup
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			// Interleaved frames would fail to read
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	c := NewWebSocketClient(&config.Config{BybitWSBaseURL: "ws" + strings.TrimPrefix(server.URL, "http"), PingInterval: 1}, nil, nil)
+	c.Limiter = nil
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.close()
+
+	// Subscribes race the pings of keepAlive and each other
+	deadline := time.Now().Add(1200 * time.Millisecond)
+	for i := 0; i < 4; i++ {
+		writers.Add(1)
+		go func(i int) {
+			defer writers.Done()
+			topic := fmt.Sprintf("publicTrade.SYM%d", i)
+			for time.Now().Before(deadline) {
+				if err := c.Subscibe([]string{topic}); err != nil {
+					t.Error(err)
+					return
+				}
+				c.Subscriptions()
+				if err := c.Unsubscribe([]string{topic}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(i)
+	}
+	writers.Wait()
+	if !c.Connected() {
+		t.Fatal("expected the connection to stay up")
+	}
+	if topics := c.Subscriptions(); len(topics) != 0 {
+		t.Fatalf("expected no subscriptions, got %v", topics)
+	}
+}
+
+func TestWebSocketClientResubscribesInBatches(t *testing.T) {
+	log := &opLog{}
+	var conns atomic.Int32
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		first := conns.Add(1) == 1
+		for received := 0; ; received++ {
+			// Drop the first connection once it subscribed
+			if first && received == 2 {
+				return
+			}
+			var msg Message
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			log.add(fmt.Sprintf("%s %d", msg.Op, len(msg.Args)))
+		}
+	}))
+	defer server.Close()
+
+	c := NewWebSocketClient(&config.Config{BybitWSBaseURL: "ws" + strings.TrimPrefix(server.URL, "http"), PingInterval: 1}, nil, nil)
+	c.Limiter = nil
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.close()
+
+	var topics []string
+	for i := 0; i < 11; i++ {
+		topics = append(topics, fmt.Sprintf("publicTrade.SYM%d", i))
+	}
+	if err := c.Subscibe(topics); err != nil {
+		t.Fatal(err)
+	}
+	log.wait(t, 2)
+
+	// The reconnect resubscribes every topic within the per-request limit
+	deadline := time.Now().Add(3 * time.Second)
+	for conns.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	expectOps(t, log.wait(t, 4), "subscribe 10", "subscribe 1", "subscribe 10", "subscribe 1")
+}
+
+func TestWebSocketClientCloseDoesNotReconnect(t *testing.T) {
+	var conns atomic.Int32
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conns.Add(1)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	var errs atomic.Int32
+	c := NewWebSocketClient(&config.Config{BybitWSBaseURL: "ws" + strings.TrimPrefix(server.URL, "http"), PingInterval: 1}, nil,
+		func(error) { errs.Add(1) })
+	c.Limiter = nil
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	// Close while listen is blocked reading
+	time.Sleep(100 * time.Millisecond)
+	c.close()
+
+	time.Sleep(1500 * time.Millisecond)
+	if n := conns.Load(); n != 1 || errs.Load() != 0 || c.Connected() {
+		t.Fatalf("expected no reconnect after close, got %d connections and %d errors", n, errs.Load())
+	}
+}
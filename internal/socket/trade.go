@@ -0,0 +1,441 @@
+package socket
+
+import (
+	"bybit_connector/internal/config"
+	"bybit_connector/pkg/market"
+	"bybit_connector/pkg/ratelimit"
+	"bybit_connector/pkg/rest"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// TradeClient places, amends and cancels orders over the v5 trade
+// WebSocket. Requests are correlated with their responses by reqId and
+// paced by a per-connection rate limit. Unlike WebSocketClient it does not
+// reconnect on its own: in-flight requests fail and the caller decides
+// whether to Connect again.
+type TradeClient struct {
+	URL        string
+	APIKey     string
+	APISecret  string
+	RecvWindow time.Duration
+	// Timeout bounds the wait for a response when the context has no deadline
+	Timeout time.Duration
+	// Instruments, when set, validates orders before they are sent
+	Instruments  rest.InstrumentSource
+	ErrorHandler func(error)
+	Config       *config.Config
+	// Limiter, when set, draws ops from the per-UID budget shared with the
+	// REST client on top of the per-connection limit
+	Limiter *ratelimit.Limiter
+
+	mu      sync.Mutex
+	limiter *ratelimit.Bucket
+	conn    *websocket.Conn
+	// open is set while the connection is up, connected once it is also
+	// authenticated
+	open      bool
+	connected bool
+	done      chan struct{}
+	pending   map[string]chan tradeResponse
+	nextReqID uint64
+
+	writeMu sync.Mutex
+}
+
+// tradeRequest is an op sent over the trade WebSocket
+type tradeRequest struct {
+	ReqID  string            `json:"reqId,omitempty"`
+	Header map[string]string `json:"header,omitempty"`
+	Op     string            `json:"op"`
+	Args   []interface{}     `json:"args,omitempty"`
+}
+
+// tradeResponse is the answer to an op
+type tradeResponse struct {
+	ReqID   string            `json:"reqId"`
+	RetCode int               `json:"retCode"`
+	RetMsg  string            `json:"retMsg"`
+	Op      string            `json:"op"`
+	Data    json.RawMessage   `json:"data"`
+	Header  map[string]string `json:"header"`
+	ConnID  string            `json:"connId"`
+
+	err error
+}
+
+// authReqID is the key under which the auth response is awaited
+const authReqID = "auth"
+
+// NewTradeClient creates a trade WebSocket client
+func NewTradeClient(config *config.Config, errorHandler func(error)) *TradeClient {
+	recvWindow := time.Duration(config.RecvWindow) * time.Millisecond
+	if recvWindow <= 0 {
+		recvWindow = 5 * time.Second
+	}
+	return &TradeClient{
+		URL:          config.BybitWSTradeURL,
+		APIKey:       config.BybitAPIKey,
+		APISecret:    config.BybitAPISecret,
+		RecvWindow:   recvWindow,
+		Timeout:      5 * time.Second,
+		ErrorHandler: errorHandler,
+		Config:       config,
+		limiter:      ratelimit.NewBucket(10, 10), // Bybit allows 10 ops per second per connection
+	}
+}
+
+// SetRateLimit changes the number of ops per second allowed on the connection
+func (c *TradeClient) SetRateLimit(perSecond int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.limiter = ratelimit.NewBucket(float64(perSecond), perSecond)
+}
+
+// SetCredentials replaces the API key pair used by the next Connect
+func (c *TradeClient) SetCredentials(apiKey, apiSecret string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.APIKey = apiKey
+	c.APISecret = apiSecret
+}
+
+// Rotate switches to a new API key pair. An open connection is
+// re-established with it; in-flight requests on the old one fail.
+func (c *TradeClient) Rotate(ctx context.Context, apiKey, apiSecret string) error {
+	c.SetCredentials(apiKey, apiSecret)
+	if !c.IsConnected() {
+		return nil
+	}
+	return c.Connect(ctx)
+}
+
+// Connect dials the trade WebSocket and authenticates
+func (c *TradeClient) Connect(ctx context.Context) error {
+	c.mu.Lock()
+	apiKey, apiSecret := c.APIKey, c.APISecret
+	c.mu.Unlock()
+	if apiKey == "" || apiSecret == "" {
+		return fmt.Errorf("trade websocket requires api credentials")
+	}
+	if c.URL == "" {
+		return fmt.Errorf("trade websocket is not available in this environment")
+	}
+	c.Close()
+
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, c.URL, nil)
+	if err != nil {
+		return fmt.Errorf("websocket dial error: %w", err)
+	}
+
+	c.mu.Lock()
+	c.conn = conn
+	c.open = true
+	c.done = make(chan struct{})
+	c.pending = make(map[string]chan tradeResponse)
+	done := c.done
+	c.mu.Unlock()
+
+	go c.listen(conn, done)
+	go c.keepAlive(done)
+
+	expires := time.Now().Add(10 * time.Second).UnixMilli()
+	auth := newAuthMessage(apiKey, apiSecret, expires)
+	resp, err := c.roundTrip(ctx, authReqID, auth)
+	if err != nil {
+		c.Close()
+		return fmt.Errorf("authentication error: %w", err)
+	}
+	if resp.RetCode != 0 {
+		c.Close()
+		return fmt.Errorf("authentication error: retCode %d: %s", resp.RetCode, resp.RetMsg)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.open || c.conn != conn {
+		return fmt.Errorf("authentication error: trade websocket closed")
+	}
+	c.connected = true
+	return nil
+}
+
+// IsConnected reports whether the connection is up and authenticated
+func (c *TradeClient) IsConnected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connected
+}
+
+// Close closes the connection and fails every in-flight request
+func (c *TradeClient) Close() {
+	c.disconnect(fmt.Errorf("trade websocket closed"))
+}
+
+// CreateOrder places an order and returns it with the IDs assigned by the exchange
+func (c *TradeClient) CreateOrder(ctx context.Context, req rest.CreateOrderRequest) (market.Order, error) {
+	if err := req.Validate(); err != nil {
+		return market.Order{}, err
+	}
+	if err := c.validateInstrument(req.Category, req.Symbol, req.ValidateInstrument); err != nil {
+		return market.Order{}, err
+	}
+
+	ref, err := c.send(ctx, "order.create", req)
+	if err != nil {
+		return market.Order{}, err
+	}
+	return req.Order(ref.OrderID, ref.OrderLinkID), nil
+}
+
+// AmendOrder amends an open order
+func (c *TradeClient) AmendOrder(ctx context.Context, req rest.AmendOrderRequest) (market.Order, error) {
+	if err := req.Validate(); err != nil {
+		return market.Order{}, err
+	}
+	if err := c.validateInstrument(req.Category, req.Symbol, req.ValidateInstrument); err != nil {
+		return market.Order{}, err
+	}
+
+	ref, err := c.send(ctx, "order.amend", req)
+	if err != nil {
+		return market.Order{}, err
+	}
+	return req.Order(ref.OrderID, ref.OrderLinkID), nil
+}
+
+// CancelOrder cancels an open order
+func (c *TradeClient) CancelOrder(ctx context.Context, req rest.CancelOrderRequest) (market.Order, error) {
+	if err := req.Validate(); err != nil {
+		return market.Order{}, err
+	}
+
+	ref, err := c.send(ctx, "order.cancel", req)
+	if err != nil {
+		return market.Order{}, err
+	}
+	return market.Order{OrderID: ref.OrderID, OrderLinkID: ref.OrderLinkID, Symbol: req.Symbol}, nil
+}
+
+// send paces, sends and awaits an order op
+func (c *TradeClient) send(ctx context.Context, op string, arg interface{}) (orderRef, error) {
+	if c.Timeout > 0 {
+		if _, ok := ctx.Deadline(); !ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+			defer cancel()
+		}
+	}
+
+	c.mu.Lock()
+	connected, limiter := c.connected, c.limiter
+	c.mu.Unlock()
+	if !connected {
+		return orderRef{}, fmt.Errorf("%s: trade websocket is not connected", op)
+	}
+
+	if err := limiter.Wait(ctx, ratelimit.PriorityFrom(ctx)); err != nil {
+		return orderRef{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if c.Limiter != nil {
+		if err := c.Limiter.Wait(ctx, ratelimit.Group(op)); err != nil {
+			return orderRef{}, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	c.mu.Lock()
+	c.nextReqID++
+	reqID := strconv.FormatUint(c.nextReqID, 10)
+	c.mu.Unlock()
+
+	req := tradeRequest{
+		ReqID: reqID,
+		Header: map[string]string{
+			"X-BAPI-TIMESTAMP":   strconv.FormatInt(time.Now().UnixMilli(), 10),
+			"X-BAPI-RECV-WINDOW": strconv.FormatInt(c.RecvWindow.Milliseconds(), 10),
+		},
+		Op:   op,
+		Args: []interface{}{arg},
+	}
+
+	resp, err := c.roundTrip(ctx, reqID, req)
+	if err != nil {
+		return orderRef{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if c.Limiter != nil {
+		c.Limiter.Observe(ratelimit.Group(op), http.Header{
+			"X-Bapi-Limit":                 {resp.Header["X-Bapi-Limit"]},
+			"X-Bapi-Limit-Status":          {resp.Header["X-Bapi-Limit-Status"]},
+			"X-Bapi-Limit-Reset-Timestamp": {resp.Header["X-Bapi-Limit-Reset-Timestamp"]},
+		})
+	}
+	if resp.RetCode != 0 {
+		apiErr := &rest.APIError{Code: resp.RetCode, Message: resp.RetMsg, Method: "WS", Path: op}
+		if apiErr.RateLimited() && c.Limiter != nil {
+			c.Limiter.Penalize(ratelimit.Group(op), time.Time{})
+		}
+		return orderRef{}, apiErr
+	}
+
+	var ref orderRef
+	if len(resp.Data) > 0 {
+		if err := json.Unmarshal(resp.Data, &ref); err != nil {
+			return orderRef{}, fmt.Errorf("%s: failed to decode response data: %w", op, err)
+		}
+	}
+	return ref, nil
+}
+
+// orderRef is the data of an order op response
+type orderRef struct {
+	OrderID     string `json:"orderId"`
+	OrderLinkID string `json:"orderLinkId"`
+}
+
+// roundTrip writes a message and waits for the response with the given reqId
+func (c *TradeClient) roundTrip(ctx context.Context, reqID string, v interface{}) (tradeResponse, error) {
+	ch := make(chan tradeResponse, 1)
+
+	c.mu.Lock()
+	if !c.open {
+		c.mu.Unlock()
+		return tradeResponse{}, fmt.Errorf("trade websocket is not connected")
+	}
+	c.pending[reqID] = ch
+	conn := c.conn
+	c.mu.Unlock()
+
+	c.writeMu.Lock()
+	err := conn.WriteJSON(v)
+	c.writeMu.Unlock()
+	if err != nil {
+		c.forget(reqID)
+		return tradeResponse{}, fmt.Errorf("write error: %w", err)
+	}
+
+	select {
+	case resp := <-ch:
+		return resp, resp.err
+	case <-ctx.Done():
+		c.forget(reqID)
+		return tradeResponse{}, ctx.Err()
+	}
+}
+
+func (c *TradeClient) forget(reqID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pending, reqID)
+}
+
+// listen reads responses and hands them to the waiting requests
+func (c *TradeClient) listen(conn *websocket.Conn, done chan struct{}) {
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			select {
+			case <-done:
+			default:
+				err = fmt.Errorf("read error: %w", err)
+				if c.ErrorHandler != nil {
+					c.ErrorHandler(err)
+				}
+				c.disconnect(err)
+			}
+			return
+		}
+
+		var resp tradeResponse
+		if err := json.Unmarshal(message, &resp); err != nil {
+			if c.ErrorHandler != nil {
+				c.ErrorHandler(fmt.Errorf("failed to unmarshal trade response: %w", err))
+			}
+			continue
+		}
+
+		reqID := resp.ReqID
+		switch resp.Op {
+		case "auth":
+			reqID = authReqID
+		case "pong", "ping":
+			continue
+		}
+
+		c.mu.Lock()
+		ch, ok := c.pending[reqID]
+		delete(c.pending, reqID)
+		c.mu.Unlock()
+		if ok {
+			ch <- resp
+		}
+	}
+}
+
+// keepAlive sends periodic pings to keep the connection alive
+func (c *TradeClient) keepAlive(done chan struct{}) {
+	interval := 20 * time.Second
+	if c.Config != nil && c.Config.PingInterval > 0 {
+		interval = time.Duration(c.Config.PingInterval) * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.mu.Lock()
+			conn := c.conn
+			c.mu.Unlock()
+
+			c.writeMu.Lock()
+			err := conn.WriteJSON(tradeRequest{Op: "ping"})
+			c.writeMu.Unlock()
+			if err != nil {
+				if c.ErrorHandler != nil {
+					c.ErrorHandler(fmt.Errorf("ping error: %w", err))
+				}
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// disconnect tears the connection down and fails the in-flight requests
+func (c *TradeClient) disconnect(reason error) {
+	c.mu.Lock()
+	if !c.open {
+		c.mu.Unlock()
+		return
+	}
+	c.open, c.connected = false, false
+	close(c.done)
+	conn := c.conn
+	pending := c.pending
+	c.pending = make(map[string]chan tradeResponse)
+	c.mu.Unlock()
+
+	conn.Close()
+	for _, ch := range pending {
+		ch <- tradeResponse{err: reason}
+	}
+}
+
+func (c *TradeClient) validateInstrument(category market.Category, symbol string, validate func(market.Instrument) error) error {
+	if c.Instruments == nil {
+		return nil
+	}
+	inst, ok := c.Instruments.Instrument(category, symbol)
+	if !ok {
+		return fmt.Errorf("%s: unknown %s instrument", symbol, category)
+	}
+	return validate(inst)
+}
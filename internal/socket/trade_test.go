@@ -0,0 +1,200 @@
+package socket
+
+import (
+	"bybit_connector/internal/config"
+	"bybit_connector/pkg/market"
+	"bybit_connector/pkg/rest"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newTradeStandIn starts a local trade WebSocket that accepts any auth
+// and answers order ops with respond
+func newTradeStandIn(t *testing.T, respond func(req map[string]interface{}) map[string]interface{}) *TradeClient {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			var req map[string]interface{}
+			if err := conn.ReadJSON(&req); err != nil {
+				return
+			}
+			if req["op"] == "auth" {
+				conn.WriteJSON(map[string]interface{}{"op": "auth", "retCode": 0, "retMsg": "OK"})
+				continue
+			}
+			if resp := respond(req); resp != nil {
+				resp["reqId"] = req["reqId"]
+				resp["op"] = req["op"]
+				conn.WriteJSON(resp)
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	c := NewTradeClient(&config.Config{
+		BybitWSTradeURL: "ws" + strings.TrimPrefix(server.URL, "http"),
+		BybitAPIKey:     "key",
+		BybitAPISecret:  "secret",
+		PingInterval:    20,
+	}, nil)
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	return c
+}
+
+func TestTradeClientCreateOrder(t *testing.T) {
+	c := newTradeStandIn(t, func(req map[string]interface{}) map[string]interface{} {
+		header := req["header"].(map[string]interface{})
+		if header["X-BAPI-TIMESTAMP"] == "" || header["X-BAPI-RECV-WINDOW"] != "5000" {
+			t.Errorf("unexpected header: %v", header)
+		}
+		arg := req["args"].([]interface{})[0].(map[string]interface{})
+		return map[string]interface{}{
+			"retCode": 0, "retMsg": "OK",
+			"data": map[string]string{"orderId": "id-" + arg["orderLinkId"].(string), "orderLinkId": arg["orderLinkId"].(string)},
+		}
+	})
+
+	order, err := c.CreateOrder(context.Background(), rest.CreateOrderRequest{
+		Category: market.CategoryLinear, Symbol: "BTCUSDT", Side: rest.SideBuy,
+		OrderType: rest.OrderTypeLimit, Qty: 0.01, Price: 30000, OrderLinkID: "a",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.OrderID != "id-a" || order.OrderStatus != "Created" {
+		t.Fatalf("unexpected order: %+v", order)
+	}
+}
+
+func TestTradeClientConnectedOnlyAfterAuth(t *testing.T) {
+	authReceived, release := make(chan struct{}), make(chan struct{})
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var req map[string]interface{}
+		if err := conn.ReadJSON(&req); err != nil {
+			return
+		}
+		close(authReceived)
+		<-release
+		conn.WriteJSON(map[string]interface{}{"op": "auth", "retCode": 10003, "retMsg": "Invalid apikey"})
+		conn.ReadJSON(&req)
+	}))
+	defer server.Close()
+
+	c := NewTradeClient(&config.Config{
+		BybitWSTradeURL: "ws" + strings.TrimPrefix(server.URL, "http"),
+		BybitAPIKey:     "key",
+		BybitAPISecret:  "secret",
+	}, nil)
+	result := make(chan error, 1)
+	go func() { result <- c.Connect(context.Background()) }()
+
+	<-authReceived
+	if c.IsConnected() {
+		t.Fatal("expected the client to report connected only once authenticated")
+	}
+	_, err := c.CancelOrder(context.Background(), rest.CancelOrderRequest{Category: market.CategoryLinear, Symbol: "BTCUSDT", OrderID: "a"})
+	if err == nil {
+		t.Fatal("expected order ops to fail before authentication")
+	}
+	close(release)
+	if err := <-result; err == nil {
+		t.Fatal("expected the rejected auth to fail Connect")
+	}
+	if c.IsConnected() {
+		t.Fatal("expected a rejected auth to leave the client disconnected")
+	}
+}
+
+func TestTradeClientSetRateLimitWhileSending(t *testing.T) {
+	c := newTradeStandIn(t, func(req map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{"retCode": 0, "retMsg": "OK", "data": map[string]string{"orderId": "a"}}
+	})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			c.SetRateLimit(100 + i)
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		if _, err := c.CancelOrder(context.Background(), rest.CancelOrderRequest{Category: market.CategoryLinear, Symbol: "BTCUSDT", OrderID: "a"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+}
+
+func TestTradeClientCorrelatesOutOfOrderResponses(t *testing.T) {
+	held := make(chan map[string]interface{}, 1)
+	var c *TradeClient
+	c = newTradeStandIn(t, func(req map[string]interface{}) map[string]interface{} {
+		// Hold the first cancel and answer it after the second
+		if req["reqId"] == "1" {
+			held <- req
+			return nil
+		}
+		return map[string]interface{}{"retCode": 110001, "retMsg": "order does not exist"}
+	})
+
+	first := make(chan error, 1)
+	go func() {
+		_, err := c.CancelOrder(context.Background(), rest.CancelOrderRequest{Category: market.CategoryLinear, Symbol: "BTCUSDT", OrderID: "1"})
+		first <- err
+	}()
+	<-held
+
+	_, err := c.CancelOrder(context.Background(), rest.CancelOrderRequest{Category: market.CategoryLinear, Symbol: "BTCUSDT", OrderID: "2"})
+	var apiErr *rest.APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != 110001 || apiErr.Path != "order.cancel" {
+		t.Fatalf("expected an APIError for the second cancel, got %v", err)
+	}
+
+	c.Close()
+	if err := <-first; err == nil {
+		t.Fatal("expected the held request to fail when the connection closes")
+	}
+}
+
+func TestTradeClientRateLimit(t *testing.T) {
+	c := newTradeStandIn(t, func(req map[string]interface{}) map[string]interface{} {
+		data, _ := json.Marshal(map[string]string{"orderId": "x"})
+		return map[string]interface{}{"retCode": 0, "retMsg": "OK", "data": json.RawMessage(data)}
+	})
+	c.SetRateLimit(2)
+
+	req := rest.CancelOrderRequest{Category: market.CategorySpot, Symbol: "BTCUSDT", OrderID: "x"}
+	for i := 0; i < 2; i++ {
+		if _, err := c.CancelOrder(context.Background(), req); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := c.CancelOrder(ctx, req); err == nil {
+		t.Fatal("expected the third op within the second to be rate limited")
+	}
+}
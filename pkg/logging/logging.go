@@ -0,0 +1,159 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultRepeatInterval is the window in which a repeated warning or error
+// is logged once
+const DefaultRepeatInterval = 10 * time.Second
+
+// ParseLevel parses debug, info, warn or error
+func ParseLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info", "":
+		return slog.LevelInfo, nil
+	case "warn":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("invalid log level %q", s)
+}
+
+// New creates a logger writing text or JSON records of at least level to
+// w. Repeated warnings and errors are rate limited with
+// DefaultRepeatInterval. Pass a *slog.LevelVar to change the level later.
+func New(w io.Writer, format string, level slog.Leveler) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: level}
+	var h slog.Handler
+	switch format {
+	case "text", "":
+		h = slog.NewTextHandler(w, opts)
+	case "json":
+		h = slog.NewJSONHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("invalid log format %q", format)
+	}
+	return slog.New(RateLimit(h, DefaultRepeatInterval)), nil
+}
+
+// Or returns l, or the default logger when l is nil
+func Or(l *slog.Logger) *slog.Logger {
+	if l == nil {
+		return slog.Default()
+	}
+	return l
+}
+
+// rateLimiter drops warnings and errors repeating one logged less than
+// interval ago. Records repeat when they have the same level, message,
+// logger attributes and string attributes, like the symbol; their other
+// attributes, like the error or a count, may differ. The next record
+// logged after the interval carries the number of dropped ones in a
+// "suppressed" attribute.
+type rateLimiter struct {
+	next     slog.Handler
+	interval time.Duration
+	// prefix identifies the attributes and groups added with WithAttrs and WithGroup
+	prefix string
+	state  *repeats
+	now    func() time.Time
+}
+
+type repeats struct {
+	mu   sync.Mutex
+	seen map[string]*repeat
+}
+
+type repeat struct {
+	logged     time.Time
+	suppressed int
+}
+
+// maxRepeats bounds the records remembered before old ones are pruned
+const maxRepeats = 1024
+
+// RateLimit wraps h so that a warning or error repeated within interval is
+// logged once. Records below warning level are passed through.
+func RateLimit(h slog.Handler, interval time.Duration) slog.Handler {
+	return &rateLimiter{next: h, interval: interval, state: &repeats{seen: make(map[string]*repeat)}, now: time.Now}
+}
+
+func (r *rateLimiter) Enabled(ctx context.Context, level slog.Level) bool {
+	return r.next.Enabled(ctx, level)
+}
+
+func (r *rateLimiter) Handle(ctx context.Context, rec slog.Record) error {
+	if rec.Level < slog.LevelWarn {
+		return r.next.Handle(ctx, rec)
+	}
+
+	key := rec.Level.String() + "\xff" + r.prefix + "\xff" + rec.Message
+	rec.Attrs(func(a slog.Attr) bool {
+		if a.Value.Kind() == slog.KindString {
+			key += "\xff" + a.String()
+		}
+		return true
+	})
+	now := r.now()
+	r.state.mu.Lock()
+	rep, ok := r.state.seen[key]
+	if ok && now.Sub(rep.logged) < r.interval {
+		rep.suppressed++
+		r.state.mu.Unlock()
+		return nil
+	}
+	suppressed := 0
+	if ok {
+		suppressed = rep.suppressed
+		rep.logged, rep.suppressed = now, 0
+	} else {
+		r.state.prune(now, r.interval)
+		r.state.seen[key] = &repeat{logged: now}
+	}
+	r.state.mu.Unlock()
+
+	if suppressed > 0 {
+		rec = rec.Clone()
+		rec.AddAttrs(slog.Int("suppressed", suppressed))
+	}
+	return r.next.Handle(ctx, rec)
+}
+
+// prune forgets records logged more than interval ago once too many are
+// remembered. Their suppressed counts are lost. The caller holds the lock.
+func (s *repeats) prune(now time.Time, interval time.Duration) {
+	if len(s.seen) < maxRepeats {
+		return
+	}
+	for key, rep := range s.seen {
+		if now.Sub(rep.logged) >= interval {
+			delete(s.seen, key)
+		}
+	}
+}
+
+func (r *rateLimiter) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *r
+	c.next = r.next.WithAttrs(attrs)
+	for _, a := range attrs {
+		c.prefix += a.String() + " "
+	}
+	return &c
+}
+
+func (r *rateLimiter) WithGroup(name string) slog.Handler {
+	c := *r
+	c.next = r.next.WithGroup(name)
+	c.prefix += name + "."
+	return &c
+}
@@ -0,0 +1,88 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewWritesJSONAtLevel(t *testing.T) {
+	var buf bytes.Buffer
+	var level slog.LevelVar
+	level.Set(slog.LevelWarn)
+	l, err := New(&buf, "json", &level)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l.Info("hidden")
+	l.With("conn_id", 3).Warn("Connection lost", "reason", "read_error")
+	level.Set(slog.LevelDebug)
+	l.Debug("shown")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 records, got %q", buf.String())
+	}
+	var rec map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec["msg"] != "Connection lost" || rec["conn_id"] != 3.0 || rec["reason"] != "read_error" || rec["level"] != "WARN" {
+		t.Fatalf("unexpected record: %v", rec)
+	}
+
+	if _, err := New(&buf, "xml", nil); err == nil {
+		t.Fatal("expected an error for an unknown format")
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Fatal("expected an error for an unknown level")
+	}
+}
+
+func TestRateLimitDropsRepeatedErrors(t *testing.T) {
+	var buf bytes.Buffer
+	now := time.Unix(0, 0)
+	h := RateLimit(slog.NewTextHandler(&buf, &slog.HandlerOptions{ReplaceAttr: dropTime}), time.Second)
+	h.(*rateLimiter).now = func() time.Time { return now }
+	l := slog.New(h)
+
+	for i := 0; i < 3; i++ {
+		l.Error("Read failed", "attempt", i)
+	}
+	// Other loggers, messages and string attributes are not repeats
+	l.With("connection", "spot").Error("Read failed", "attempt", 0)
+	l.Error("Write failed")
+	l.Warn("Orderbook out of sync", "symbol", "BTCUSDT")
+	l.Warn("Orderbook out of sync", "symbol", "ETHUSDT")
+	l.Warn("Orderbook out of sync", "symbol", "BTCUSDT")
+	// Info records are never dropped
+	l.Info("Connected")
+	l.Info("Connected")
+
+	now = now.Add(time.Second)
+	l.Error("Read failed", "attempt", 3)
+
+	want := `level=ERROR msg="Read failed" attempt=0
+level=ERROR msg="Read failed" connection=spot attempt=0
+level=ERROR msg="Write failed"
+level=WARN msg="Orderbook out of sync" symbol=BTCUSDT
+level=WARN msg="Orderbook out of sync" symbol=ETHUSDT
+level=INFO msg=Connected
+level=INFO msg=Connected
+level=ERROR msg="Read failed" attempt=3 suppressed=2
+`
+	if buf.String() != want {
+		t.Fatalf("unexpected output:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func dropTime(groups []string, a slog.Attr) slog.Attr {
+	if a.Key == slog.TimeKey && len(groups) == 0 {
+		return slog.Attr{}
+	}
+	return a
+}
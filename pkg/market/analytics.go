@@ -0,0 +1,194 @@
+package market
+
+import "math"
+
+// Order book analytics. Bids are expected to be sorted best (highest)
+// first and asks best (lowest) first, as built by OderBookLocal.
+// The methods accept a nil book, which is treated as empty. Those that need
+// both sides of the book return 0 when either is empty.
+
+// FillEstimate is the result of walking the book to fill a notional
+type FillEstimate struct {
+	Side       string  `json:"side"`
+	Qty        float64 `json:"qty"`
+	Notional   float64 `json:"notional"`
+	VWAP       float64 `json:"vwap"`
+	WorstPrice float64 `json:"worst_price"`
+	Levels     int     `json:"levels"`
+	// SlippageBps is the distance of the VWAP from the mid, in basis points
+	SlippageBps float64 `json:"slippage_bps"`
+	// ImpactBps is the distance of the VWAP from the price of the first level
+	// filled, in basis points
+	ImpactBps float64 `json:"impact_bps"`
+	// Complete is false when the book is too thin to fill the whole notional
+	Complete bool `json:"complete"`
+}
+
+// BestBid returns the best bid, if any
+func (o *OrderBook) BestBid() (Item, bool) {
+	if o == nil || len(o.Bids) == 0 {
+		return Item{}, false
+	}
+	return o.Bids[0], true
+}
+
+// BestAsk returns the best ask, if any
+func (o *OrderBook) BestAsk() (Item, bool) {
+	if o == nil || len(o.Asks) == 0 {
+		return Item{}, false
+	}
+	return o.Asks[0], true
+}
+
+// Mid returns the mid price between the best bid and ask
+func (o *OrderBook) Mid() float64 {
+	bid, okBid := o.BestBid()
+	ask, okAsk := o.BestAsk()
+	if !okBid || !okAsk {
+		return 0
+	}
+	return (bid.Price + ask.Price) / 2
+}
+
+// Spread returns the difference between the best ask and bid
+func (o *OrderBook) Spread() float64 {
+	bid, okBid := o.BestBid()
+	ask, okAsk := o.BestAsk()
+	if !okBid || !okAsk {
+		return 0
+	}
+	return ask.Price - bid.Price
+}
+
+// Imbalance returns (bid size - ask size) / (bid size + ask size) over the
+// top n levels of each side, between -1 (all asks) and 1 (all bids).
+// n <= 0 uses the whole book.
+func (o *OrderBook) Imbalance(n int) float64 {
+	if o == nil {
+		return 0
+	}
+	bidSize, _ := depth(o.Bids, n)
+	askSize, _ := depth(o.Asks, n)
+	if bidSize+askSize == 0 {
+		return 0
+	}
+	return (bidSize - askSize) / (bidSize + askSize)
+}
+
+// Microprice returns the mid weighted by the opposite top-of-book size,
+// which leans towards the side more likely to trade through
+func (o *OrderBook) Microprice() float64 {
+	bid, okBid := o.BestBid()
+	ask, okAsk := o.BestAsk()
+	if !okBid || !okAsk || bid.Amount+ask.Amount == 0 {
+		return 0
+	}
+	return (bid.Price*ask.Amount + ask.Price*bid.Amount) / (bid.Amount + ask.Amount)
+}
+
+// DepthWeightedMid returns the average of the size-weighted bid and ask
+// prices over the top n levels of each side. n <= 0 uses the whole book.
+func (o *OrderBook) DepthWeightedMid(n int) float64 {
+	if o == nil {
+		return 0
+	}
+	bidSize, bidNotional := depth(o.Bids, n)
+	askSize, askNotional := depth(o.Asks, n)
+	if bidSize == 0 || askSize == 0 {
+		return 0
+	}
+	return (bidNotional/bidSize + askNotional/askSize) / 2
+}
+
+// LiquidityWithinBps returns the cumulative bid and ask size priced within
+// bps basis points of the mid
+func (o *OrderBook) LiquidityWithinBps(bps float64) (bidSize, askSize float64) {
+	mid := o.Mid()
+	if mid == 0 {
+		return 0, 0
+	}
+	floor := mid * (1 - bps/10000)
+	ceil := mid * (1 + bps/10000)
+	for _, b := range o.Bids {
+		if b.Price < floor {
+			break
+		}
+		bidSize += b.Amount
+	}
+	for _, a := range o.Asks {
+		if a.Price > ceil {
+			break
+		}
+		askSize += a.Amount
+	}
+	return bidSize, askSize
+}
+
+// CostToFill walks the book to estimate filling an order of the given
+// quote notional. A "Buy" consumes the asks and a "Sell" the bids.
+func (o *OrderBook) CostToFill(side string, notional float64) FillEstimate {
+	est := FillEstimate{Side: side}
+	if o == nil {
+		return est
+	}
+	var levels []Item
+	switch side {
+	case "Buy":
+		levels = o.Asks
+	case "Sell":
+		levels = o.Bids
+	default:
+		return est
+	}
+	if len(levels) == 0 || notional <= 0 {
+		return est
+	}
+
+	remaining := notional
+	first := 0.0
+	for _, l := range levels {
+		if l.Price <= 0 || l.Amount <= 0 {
+			continue
+		}
+		levelNotional := l.Price * l.Amount
+		qty := l.Amount
+		if levelNotional > remaining {
+			qty = remaining / l.Price
+			levelNotional = remaining
+		}
+		if est.Levels == 0 {
+			first = l.Price
+		}
+		est.Qty += qty
+		est.Notional += levelNotional
+		est.WorstPrice = l.Price
+		est.Levels++
+		remaining -= levelNotional
+		if remaining <= notional*1e-12 {
+			est.Complete = true
+			break
+		}
+	}
+	if est.Qty == 0 {
+		return est
+	}
+
+	est.VWAP = est.Notional / est.Qty
+	est.ImpactBps = math.Abs(est.VWAP-first) / first * 10000
+	if mid := o.Mid(); mid != 0 {
+		est.SlippageBps = math.Abs(est.VWAP-mid) / mid * 10000
+	}
+	return est
+}
+
+// depth returns the total size and notional of the first n levels
+func depth(levels []Item, n int) (size, notional float64) {
+	if n <= 0 || n > len(levels) {
+		n = len(levels)
+	}
+	for _, l := range levels[:n] {
+		size += l.Amount
+		notional += l.Amount * l.Price
+	}
+	return size, notional
+}
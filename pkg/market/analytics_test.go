@@ -0,0 +1,88 @@
+package market
+
+import (
+	"math"
+	"testing"
+)
+
+func analyticsBook() *OrderBook {
+	return &OrderBook{
+		Bids: []Item{{Price: 99, Amount: 3}, {Price: 98, Amount: 2}, {Price: 90, Amount: 10}},
+		Asks: []Item{{Price: 101, Amount: 1}, {Price: 102, Amount: 4}, {Price: 110, Amount: 10}},
+	}
+}
+
+func approx(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestOrderBookAnalytics(t *testing.T) {
+	ob := analyticsBook()
+
+	if ob.Mid() != 100 || ob.Spread() != 2 {
+		t.Fatalf("unexpected mid/spread: %v %v", ob.Mid(), ob.Spread())
+	}
+	if got := ob.Imbalance(1); !approx(got, 0.5) {
+		t.Fatalf("unexpected top-1 imbalance: %v", got)
+	}
+	if got := ob.Imbalance(2); !approx(got, 0) {
+		t.Fatalf("unexpected top-2 imbalance: %v", got)
+	}
+	// (99*1 + 101*3) / 4
+	if got := ob.Microprice(); !approx(got, 100.5) {
+		t.Fatalf("unexpected microprice: %v", got)
+	}
+	// bid vwap (297+196)/5 = 98.6, ask vwap (101+408)/5 = 101.8
+	if got := ob.DepthWeightedMid(2); !approx(got, 100.2) {
+		t.Fatalf("unexpected depth-weighted mid: %v", got)
+	}
+
+	bid, ask := ob.LiquidityWithinBps(200)
+	if bid != 5 || ask != 5 {
+		t.Fatalf("unexpected liquidity within 200bps: %v %v", bid, ask)
+	}
+}
+
+func TestCostToFill(t *testing.T) {
+	ob := analyticsBook()
+
+	est := ob.CostToFill("Buy", 101+204)
+	if !est.Complete || est.Levels != 2 || !approx(est.Qty, 3) {
+		t.Fatalf("unexpected estimate: %+v", est)
+	}
+	if !approx(est.VWAP, 305.0/3) || est.WorstPrice != 102 {
+		t.Fatalf("unexpected vwap: %+v", est)
+	}
+	if !approx(est.SlippageBps, (305.0/3-100)/100*10000) {
+		t.Fatalf("unexpected slippage: %v", est.SlippageBps)
+	}
+
+	est = ob.CostToFill("Sell", 1e6)
+	if est.Complete || !approx(est.Qty, 15) {
+		t.Fatalf("expected a partial fill of the whole bid side, got %+v", est)
+	}
+
+	empty := &OrderBook{}
+	if est := empty.CostToFill("Buy", 100); est.Qty != 0 || empty.Microprice() != 0 {
+		t.Fatalf("expected zero values on an empty book, got %+v", est)
+	}
+
+	// Impact is measured from the first level filled, not an empty top level
+	stale := &OrderBook{Asks: []Item{{Price: 100, Amount: 0}, {Price: 101, Amount: 1}, {Price: 102, Amount: 2}}}
+	if est := stale.CostToFill("Buy", 101+102); !approx(est.ImpactBps, (203.0/2-101)/101*10000) {
+		t.Fatalf("unexpected impact: %+v", est)
+	}
+}
+
+func TestNilOrderBookAnalytics(t *testing.T) {
+	var ob *OrderBook
+	if ob.Mid() != 0 || ob.Spread() != 0 || ob.Imbalance(0) != 0 || ob.Microprice() != 0 || ob.DepthWeightedMid(0) != 0 {
+		t.Fatal("expected zero values on a nil book")
+	}
+	if bid, ask := ob.LiquidityWithinBps(10); bid != 0 || ask != 0 {
+		t.Fatalf("unexpected liquidity %v %v", bid, ask)
+	}
+	if est := ob.CostToFill("Buy", 100); est.Qty != 0 || est.Complete {
+		t.Fatalf("expected an empty estimate, got %+v", est)
+	}
+}
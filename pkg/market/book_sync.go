@@ -0,0 +1,195 @@
+package market
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrOrderBookGap is returned when a delta does not follow the last
+// applied update ID, or arrives before any snapshot. The symbol's deltas
+// are buffered from then on until a snapshot resynchronises the book.
+var ErrOrderBookGap = errors.New("orderbook sequence gap")
+
+// maxBufferedDeltas bounds the deltas kept while a resync is pending
+const maxBufferedDeltas = 10000
+
+// SnapshotFetcher fetches a full order book of a symbol together with its
+// update ID, for example from /v5/market/orderbook
+type SnapshotFetcher func(ctx context.Context, symbol string) (*OrderBook, int64, error)
+
+// bookSync tracks the update IDs of one symbol's book
+type bookSync struct {
+	updateID  int64
+	synced    bool // a snapshot has been loaded
+	resyncing bool // deltas are buffered until the next snapshot
+	fetching  bool // a snapshot fetch is in flight
+	buffer    []bufferedDelta
+}
+
+type bufferedDelta struct {
+	updateID int64
+	delta    *OrderBookL2Delta
+}
+
+// LoadSnapshotWithID replaces the levels of a symbol with a snapshot and
+// replays the deltas buffered since a gap that are newer than it
+func (o *OderBookLocal) LoadSnapshotWithID(symbol string, levels []*OrderBookL2, updateID int64) error {
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	o.replaceLevels(symbol, levels)
+	return o.seed(symbol, updateID)
+}
+
+// UpdateWithID applies a delta that carries the exchange update ID.
+// Stale deltas are ignored and deltas received during a resync are
+// buffered. ErrOrderBookGap tells the caller that a resync is needed.
+func (o *OderBookLocal) UpdateWithID(symbol string, delta *OrderBookL2Delta, updateID int64) error {
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	s := o.sync(symbol)
+	if s.resyncing {
+		s.bufferDelta(updateID, delta)
+		return nil
+	}
+	if !s.synced || updateID > s.updateID+1 {
+		s.resyncing = true
+		s.bufferDelta(updateID, delta)
+		if !s.synced {
+			return fmt.Errorf("%s: delta %d before snapshot: %w", symbol, updateID, ErrOrderBookGap)
+		}
+		return fmt.Errorf("%s: expected update %d, got %d: %w", symbol, s.updateID+1, updateID, ErrOrderBookGap)
+	}
+	if updateID <= s.updateID {
+		return nil
+	}
+
+	o.apply(delta)
+	s.updateID = updateID
+	return nil
+}
+
+// Resync fetches a snapshot through fetch, seeds the book of the symbol
+// with it and replays the buffered deltas newer than the snapshot. It is a
+// no-op while another fetch for the symbol is in flight. When the snapshot
+// is older than the oldest buffered delta, ErrOrderBookGap is returned and
+// the caller should retry.
+func (o *OderBookLocal) Resync(ctx context.Context, symbol string, fetch SnapshotFetcher) error {
+	o.m.Lock()
+	s := o.sync(symbol)
+	if s.fetching {
+		o.m.Unlock()
+		return nil
+	}
+	s.resyncing = true
+	s.fetching = true
+	o.m.Unlock()
+
+	ob, updateID, err := fetch(ctx, symbol)
+
+	o.m.Lock()
+	defer o.m.Unlock()
+	s.fetching = false
+	if err != nil {
+		return fmt.Errorf("%s: failed to fetch orderbook snapshot: %w", symbol, err)
+	}
+	if !s.resyncing {
+		// A WebSocket snapshot resynchronised the book in the meantime
+		return nil
+	}
+
+	o.replaceLevels(symbol, bookLevels(symbol, ob))
+	if !ob.Timestamp.IsZero() {
+		stamps := ob.Timestamps
+		stamps.ExchangeTime = ob.Timestamp
+		o.ts[symbol] = stamps
+	}
+	return o.seed(symbol, updateID)
+}
+
+// Synced reports whether the book of a symbol is seeded and gap free
+func (o *OderBookLocal) Synced(symbol string) bool {
+	o.m.Lock()
+	defer o.m.Unlock()
+	s, ok := o.syncs[symbol]
+	return ok && s.synced && !s.resyncing
+}
+
+// UpdateID returns the last update ID applied to the book of a symbol
+func (o *OderBookLocal) UpdateID(symbol string) int64 {
+	o.m.Lock()
+	defer o.m.Unlock()
+	if s, ok := o.syncs[symbol]; ok {
+		return s.updateID
+	}
+	return 0
+}
+
+// seed records a snapshot's update ID and replays the buffered deltas.
+// The caller must hold the lock.
+func (o *OderBookLocal) seed(symbol string, updateID int64) error {
+	s := o.sync(symbol)
+	s.updateID = updateID
+	s.synced = true
+	if !s.resyncing {
+		return nil
+	}
+
+	for i, b := range s.buffer {
+		if b.updateID <= s.updateID {
+			continue
+		}
+		if b.updateID != s.updateID+1 {
+			s.buffer = s.buffer[i:]
+			return fmt.Errorf("%s: snapshot %d is older than buffered update %d: %w", symbol, updateID, b.updateID, ErrOrderBookGap)
+		}
+		o.apply(b.delta)
+		s.updateID = b.updateID
+	}
+	s.buffer = nil
+	s.resyncing = false
+	return nil
+}
+
+// replaceLevels drops the levels of a symbol and loads new ones.
+// The caller must hold the lock.
+func (o *OderBookLocal) replaceLevels(symbol string, levels []*OrderBookL2) {
+	for k, v := range o.ob {
+		if v.Symbol == symbol {
+			delete(o.ob, k)
+		}
+	}
+	for _, v := range levels {
+		o.ob[v.Key()] = v
+	}
+}
+
+func (o *OderBookLocal) sync(symbol string) *bookSync {
+	s, ok := o.syncs[symbol]
+	if !ok {
+		s = &bookSync{}
+		o.syncs[symbol] = s
+	}
+	return s
+}
+
+func (s *bookSync) bufferDelta(updateID int64, delta *OrderBookL2Delta) {
+	s.buffer = append(s.buffer, bufferedDelta{updateID: updateID, delta: delta})
+	if len(s.buffer) > maxBufferedDeltas {
+		s.buffer = append(s.buffer[:0], s.buffer[len(s.buffer)-maxBufferedDeltas:]...)
+	}
+}
+
+// bookLevels converts a sorted order book into levels
+func bookLevels(symbol string, ob *OrderBook) []*OrderBookL2 {
+	levels := make([]*OrderBookL2, 0, len(ob.Bids)+len(ob.Asks))
+	for _, b := range ob.Bids {
+		levels = append(levels, &OrderBookL2{Price: b.Price, Side: "Buy", Size: b.Amount, Symbol: symbol})
+	}
+	for _, a := range ob.Asks {
+		levels = append(levels, &OrderBookL2{Price: a.Price, Side: "Sell", Size: a.Amount, Symbol: symbol})
+	}
+	return levels
+}
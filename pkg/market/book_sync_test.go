@@ -0,0 +1,98 @@
+package market
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func bidDelta(price, size float64) *OrderBookL2Delta {
+	return &OrderBookL2Delta{Insert: []*OrderBookL2{{Symbol: "BTCUSDT", Side: "Buy", Price: price, Size: size}}}
+}
+
+func TestUpdateWithIDDetectsGapAndReplaysAfterResync(t *testing.T) {
+	o := NewOrderBookLocal()
+	snapshot := []*OrderBookL2{
+		{Symbol: "BTCUSDT", Side: "Buy", Price: 100, Size: 1},
+		{Symbol: "BTCUSDT", Side: "Sell", Price: 101, Size: 1},
+	}
+	if err := o.LoadSnapshotWithID("BTCUSDT", snapshot, 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.UpdateWithID("BTCUSDT", bidDelta(100, 2), 11); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.UpdateWithID("BTCUSDT", bidDelta(100, 9), 11); err != nil {
+		t.Fatalf("stale delta: %v", err)
+	}
+
+	err := o.UpdateWithID("BTCUSDT", bidDelta(99, 1), 13)
+	if !errors.Is(err, ErrOrderBookGap) {
+		t.Fatalf("expected gap, got %v", err)
+	}
+	if o.Synced("BTCUSDT") {
+		t.Fatal("book reported synced after a gap")
+	}
+	if err := o.UpdateWithID("BTCUSDT", bidDelta(98, 1), 14); err != nil {
+		t.Fatalf("buffered delta: %v", err)
+	}
+
+	fetch := func(ctx context.Context, symbol string) (*OrderBook, int64, error) {
+		return &OrderBook{
+			Bids: []Item{{Price: 100, Amount: 3}},
+			Asks: []Item{{Price: 101, Amount: 1}},
+		}, 13, nil
+	}
+	if err := o.Resync(context.Background(), "BTCUSDT", fetch); err != nil {
+		t.Fatal(err)
+	}
+	if !o.Synced("BTCUSDT") || o.UpdateID("BTCUSDT") != 14 {
+		t.Fatalf("synced=%v updateID=%d", o.Synced("BTCUSDT"), o.UpdateID("BTCUSDT"))
+	}
+
+	// Update 13 is covered by the snapshot; only 14 is replayed
+	ob, updateID, synced := o.SnapshotState("BTCUSDT")
+	if len(ob.Bids) != 2 || ob.Bids[0].Amount != 3 || ob.Bids[1].Price != 98 {
+		t.Fatalf("unexpected bids: %+v", ob.Bids)
+	}
+	if updateID != 14 || !synced {
+		t.Fatalf("snapshot state synced=%v updateID=%d", synced, updateID)
+	}
+}
+
+func TestResyncWithStaleSnapshotKeepsBuffer(t *testing.T) {
+	o := NewOrderBookLocal()
+	err := o.UpdateWithID("BTCUSDT", bidDelta(100, 1), 20)
+	if !errors.Is(err, ErrOrderBookGap) {
+		t.Fatalf("expected gap before snapshot, got %v", err)
+	}
+
+	stale := func(ctx context.Context, symbol string) (*OrderBook, int64, error) {
+		return &OrderBook{}, 5, nil
+	}
+	if err := o.Resync(context.Background(), "BTCUSDT", stale); !errors.Is(err, ErrOrderBookGap) {
+		t.Fatalf("expected gap for stale snapshot, got %v", err)
+	}
+
+	fresh := func(ctx context.Context, symbol string) (*OrderBook, int64, error) {
+		return &OrderBook{}, 19, nil
+	}
+	if err := o.Resync(context.Background(), "BTCUSDT", fresh); err != nil {
+		t.Fatal(err)
+	}
+	if ob := o.Snapshot("BTCUSDT"); len(ob.Bids) != 1 || ob.Bids[0].Price != 100 {
+		t.Fatalf("buffered delta not replayed: %+v", ob.Bids)
+	}
+}
+
+func TestDeltaSizeZeroDeletesLevel(t *testing.T) {
+	o := NewOrderBookLocal()
+	o.LoadSnapshotWithID("BTCUSDT", []*OrderBookL2{{Symbol: "BTCUSDT", Side: "Buy", Price: 100, Size: 1}}, 1)
+	del := &OrderBookL2Delta{Delete: []*OrderBookL2{{Symbol: "BTCUSDT", Side: "Buy", Price: 100}}}
+	if err := o.UpdateWithID("BTCUSDT", del, 2); err != nil {
+		t.Fatal(err)
+	}
+	if ob := o.Snapshot("BTCUSDT"); len(ob.Bids) != 0 {
+		t.Fatalf("level not deleted: %+v", ob.Bids)
+	}
+}
@@ -0,0 +1,231 @@
+package market
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Candle is an OHLCV bar, either built locally from trades or received
+// from the exchange's kline topic
+type Candle struct {
+	Symbol     string        `json:"symbol"`
+	Interval   time.Duration `json:"interval"`
+	Start      time.Time     `json:"start"`
+	Open       float64       `json:"open"`
+	High       float64       `json:"high"`
+	Low        float64       `json:"low"`
+	Close      float64       `json:"close"`
+	Volume     float64       `json:"volume"`
+	Turnover   float64       `json:"turnover"`
+	BuyVolume  float64       `json:"buy_volume"`
+	SellVolume float64       `json:"sell_volume"`
+	TradeCount int           `json:"trade_count"`
+	Closed     bool          `json:"closed"`
+	// Exchange is set on candles decoded from the kline topic
+	Exchange bool `json:"exchange"`
+	// Reconciled is set once a local candle was corrected by the exchange kline
+	Reconciled bool `json:"reconciled"`
+	// Timestamps are set on exchange candles, with the time of the last
+	// match in the candle as MatchingTime
+	Timestamps
+}
+
+// End returns the time at which the candle's interval ends
+func (c *Candle) End() time.Time {
+	return c.Start.Add(c.Interval)
+}
+
+// KlineInterval converts a Bybit kline interval ("1", "60", "D", ...) into
+// a duration. Weekly and monthly klines have no fixed length and are rejected.
+func KlineInterval(interval string) (time.Duration, error) {
+	switch interval {
+	case "D":
+		return 24 * time.Hour, nil
+	case "W", "M":
+		return 0, fmt.Errorf("kline interval %s has no fixed duration", interval)
+	}
+	minutes, err := strconv.Atoi(interval)
+	if err != nil || minutes <= 0 {
+		return 0, fmt.Errorf("invalid kline interval: %s", interval)
+	}
+	return time.Duration(minutes) * time.Minute, nil
+}
+
+// CandleBuilder aggregates the trades of one symbol into candles of a
+// fixed interval. Every trade emits the in-progress candle; when a trade
+// falls into a later interval the current candle is emitted closed,
+// followed by a flat zero-volume candle for every interval without trades.
+// CandleBuilder is not safe for concurrent use; callers must synchronise.
+type CandleBuilder struct {
+	Symbol   string
+	Interval time.Duration
+	// MaxHistory is the number of closed candles kept for Candles and Reconcile
+	MaxHistory int
+	OnCandle   func(Candle)
+
+	current   *Candle
+	lastClose float64
+	history   []Candle
+}
+
+// NewCandleBuilder creates a candle builder for the given symbol and interval
+func NewCandleBuilder(symbol string, interval time.Duration, onCandle func(Candle)) *CandleBuilder {
+	return &CandleBuilder{
+		Symbol:     symbol,
+		Interval:   interval,
+		MaxHistory: 500,
+		OnCandle:   onCandle,
+	}
+}
+
+// AddTrade adds a trade to the candle of its interval. Trades older than
+// the in-progress candle, or of an interval already closed, are dropped;
+// Reconcile corrects closed candles with the exchange kline.
+func (b *CandleBuilder) AddTrade(trade Trade) {
+	start := trade.Time.Truncate(b.Interval)
+	if b.current != nil && start.Before(b.current.Start) {
+		return
+	}
+	if b.current == nil && len(b.history) > 0 && start.Before(b.history[len(b.history)-1].End()) {
+		return
+	}
+
+	b.Advance(start)
+	if b.current == nil {
+		b.current = &Candle{
+			Symbol:   b.Symbol,
+			Interval: b.Interval,
+			Start:    start,
+			Open:     trade.Price,
+			High:     trade.Price,
+			Low:      trade.Price,
+		}
+	}
+
+	c := b.current
+	if trade.Price > c.High {
+		c.High = trade.Price
+	}
+	if trade.Price < c.Low {
+		c.Low = trade.Price
+	}
+	c.Close = trade.Price
+	c.Volume += trade.Size
+	c.Turnover += trade.Size * trade.Price
+	switch trade.Side {
+	case "Buy":
+		c.BuyVolume += trade.Size
+	case "Sell":
+		c.SellVolume += trade.Size
+	}
+	c.TradeCount++
+
+	b.emit(*c)
+}
+
+// Advance closes the in-progress candle if now lies past its end and
+// emits flat candles for the intervals elapsed since. Trades advance the
+// builder on their own; call Advance from a timer to close candles on
+// quiet markets.
+func (b *CandleBuilder) Advance(now time.Time) {
+	start := now.Truncate(b.Interval)
+	if b.current != nil {
+		if !b.current.Start.Before(start) {
+			return
+		}
+		b.closeCurrent()
+	}
+	if len(b.history) == 0 {
+		return
+	}
+	for next := b.history[len(b.history)-1].End(); next.Before(start); next = next.Add(b.Interval) {
+		b.close(Candle{
+			Symbol:   b.Symbol,
+			Interval: b.Interval,
+			Start:    next,
+			Open:     b.lastClose,
+			High:     b.lastClose,
+			Low:      b.lastClose,
+			Close:    b.lastClose,
+		})
+	}
+}
+
+// Reconcile corrects a local candle with a confirmed exchange kline of the
+// same interval. Price and volume are taken from the exchange, while the
+// buy/sell split and trade count, which the kline does not carry, are kept.
+// It reports whether a candle was corrected.
+func (b *CandleBuilder) Reconcile(kline Candle) bool {
+	if !kline.Closed || kline.Interval != b.Interval {
+		return false
+	}
+
+	if b.current != nil && b.current.Start.Equal(kline.Start) {
+		applyKline(b.current, kline)
+		b.closeCurrent()
+		return true
+	}
+
+	for i := len(b.history) - 1; i >= 0; i-- {
+		c := &b.history[i]
+		if c.Start.Equal(kline.Start) {
+			applyKline(c, kline)
+			if i == len(b.history)-1 && b.current == nil {
+				b.lastClose = c.Close
+			}
+			b.emit(*c)
+			return true
+		}
+		if c.Start.Before(kline.Start) {
+			break
+		}
+	}
+	return false
+}
+
+// Current returns the in-progress candle, if any
+func (b *CandleBuilder) Current() (Candle, bool) {
+	if b.current == nil {
+		return Candle{}, false
+	}
+	return *b.current, true
+}
+
+// Candles returns a copy of the closed candles from oldest to newest
+func (b *CandleBuilder) Candles() []Candle {
+	return append([]Candle(nil), b.history...)
+}
+
+func (b *CandleBuilder) closeCurrent() {
+	c := *b.current
+	b.current = nil
+	b.close(c)
+}
+
+func (b *CandleBuilder) close(c Candle) {
+	c.Closed = true
+	b.lastClose = c.Close
+	b.history = append(b.history, c)
+	if b.MaxHistory > 0 && len(b.history) > b.MaxHistory {
+		b.history = append(b.history[:0], b.history[len(b.history)-b.MaxHistory:]...)
+	}
+	b.emit(c)
+}
+
+func (b *CandleBuilder) emit(c Candle) {
+	if b.OnCandle != nil {
+		b.OnCandle(c)
+	}
+}
+
+func applyKline(c *Candle, kline Candle) {
+	c.Open = kline.Open
+	c.High = kline.High
+	c.Low = kline.Low
+	c.Close = kline.Close
+	c.Volume = kline.Volume
+	c.Turnover = kline.Turnover
+	c.Closed = true
+	c.Reconciled = true
+}
@@ -0,0 +1,147 @@
+package market
+
+import (
+	"testing"
+	"time"
+)
+
+func candleTrade(sec int, side string, price, size float64) Trade {
+	return Trade{
+		Time:   time.Unix(int64(sec), 0),
+		Symbol: "BTCUSDT",
+		Side:   side,
+		Price:  price,
+		Size:   size,
+	}
+}
+
+func TestCandleBuilderAggregatesTrades(t *testing.T) {
+	var emitted []Candle
+	b := NewCandleBuilder("BTCUSDT", time.Minute, func(c Candle) { emitted = append(emitted, c) })
+
+	b.AddTrade(candleTrade(0, "Buy", 100, 1))
+	b.AddTrade(candleTrade(10, "Sell", 105, 2))
+	b.AddTrade(candleTrade(20, "Buy", 95, 1))
+	b.AddTrade(candleTrade(59, "Sell", 101, 1))
+
+	c, ok := b.Current()
+	if !ok {
+		t.Fatal("expected an in-progress candle")
+	}
+	if c.Open != 100 || c.High != 105 || c.Low != 95 || c.Close != 101 {
+		t.Fatalf("unexpected OHLC: %+v", c)
+	}
+	if c.Volume != 5 || c.BuyVolume != 2 || c.SellVolume != 3 || c.TradeCount != 4 || c.Closed {
+		t.Fatalf("unexpected volume: %+v", c)
+	}
+	if len(emitted) != 4 {
+		t.Fatalf("expected an in-progress candle per trade, got %d", len(emitted))
+	}
+}
+
+func TestCandleBuilderFillsEmptyIntervals(t *testing.T) {
+	var closed []Candle
+	b := NewCandleBuilder("BTCUSDT", time.Second, func(c Candle) {
+		if c.Closed {
+			closed = append(closed, c)
+		}
+	})
+
+	b.AddTrade(candleTrade(0, "Buy", 100, 1))
+	b.AddTrade(candleTrade(3, "Buy", 110, 1))
+
+	if len(closed) != 3 {
+		t.Fatalf("expected 3 closed candles, got %d", len(closed))
+	}
+	for i, c := range closed {
+		if !c.Start.Equal(time.Unix(int64(i), 0)) {
+			t.Fatalf("candle %d starts at %v", i, c.Start)
+		}
+	}
+	if gap := closed[1]; gap.Open != 100 || gap.Close != 100 || gap.Volume != 0 || gap.TradeCount != 0 {
+		t.Fatalf("unexpected gap candle: %+v", gap)
+	}
+
+	b.Advance(time.Unix(5, 0))
+	if len(closed) != 5 || closed[3].Close != 110 || closed[4].Open != 110 {
+		t.Fatalf("unexpected candles after advance: %+v", closed)
+	}
+	if _, ok := b.Current(); ok {
+		t.Fatal("expected no in-progress candle after advance")
+	}
+}
+
+func TestCandleBuilderDropsTradesOfClosedCandles(t *testing.T) {
+	var closed []Candle
+	b := NewCandleBuilder("BTCUSDT", time.Second, func(c Candle) {
+		if c.Closed {
+			closed = append(closed, c)
+		}
+	})
+
+	b.AddTrade(candleTrade(0, "Buy", 100, 1))
+	b.Advance(time.Unix(1, 0))
+	// A late trade of the closed candle does not reopen it
+	b.AddTrade(candleTrade(0, "Sell", 90, 1))
+	if _, ok := b.Current(); ok {
+		t.Fatal("expected the late trade to be dropped")
+	}
+	if c := b.Candles(); len(c) != 1 || c[0].TradeCount != 1 || c[0].Low != 100 {
+		t.Fatalf("unexpected candles: %+v", c)
+	}
+
+	// Quiet intervals are closed flat without an in-progress candle
+	b.Advance(time.Unix(3, 0))
+	b.AddTrade(candleTrade(3, "Buy", 105, 1))
+	if len(closed) != 3 || closed[1].Volume != 0 || !closed[2].Start.Equal(time.Unix(2, 0)) {
+		t.Fatalf("unexpected closed candles: %+v", closed)
+	}
+	if c, ok := b.Current(); !ok || !c.Start.Equal(time.Unix(3, 0)) || c.Open != 105 {
+		t.Fatalf("unexpected in-progress candle: %+v", c)
+	}
+}
+
+func TestCandleBuilderReconcile(t *testing.T) {
+	b := NewCandleBuilder("BTCUSDT", time.Minute, nil)
+	b.AddTrade(candleTrade(0, "Buy", 100, 1))
+	b.AddTrade(candleTrade(60, "Sell", 101, 1))
+
+	kline := Candle{
+		Symbol: "BTCUSDT", Interval: time.Minute, Start: time.Unix(0, 0),
+		Open: 99, High: 102, Low: 98, Close: 100.5, Volume: 3, Closed: true, Exchange: true,
+	}
+	if !b.Reconcile(kline) {
+		t.Fatal("expected the closed candle to be reconciled")
+	}
+	c := b.Candles()[0]
+	if !c.Reconciled || c.Open != 99 || c.Volume != 3 || c.BuyVolume != 1 || c.TradeCount != 1 {
+		t.Fatalf("unexpected reconciled candle: %+v", c)
+	}
+
+	// A confirmed kline for the in-progress candle closes it
+	kline.Start = time.Unix(60, 0)
+	if !b.Reconcile(kline) {
+		t.Fatal("expected the in-progress candle to be reconciled")
+	}
+	if _, ok := b.Current(); ok || len(b.Candles()) != 2 {
+		t.Fatal("expected the in-progress candle to be closed")
+	}
+
+	kline.Closed = false
+	kline.Start = time.Unix(120, 0)
+	if b.Reconcile(kline) {
+		t.Fatal("unconfirmed klines must not be reconciled")
+	}
+}
+
+func TestKlineInterval(t *testing.T) {
+	if d, err := KlineInterval("5"); err != nil || d != 5*time.Minute {
+		t.Fatalf("unexpected interval: %v %v", d, err)
+	}
+	if d, err := KlineInterval("D"); err != nil || d != 24*time.Hour {
+		t.Fatalf("unexpected interval: %v %v", d, err)
+	}
+	if _, err := KlineInterval("M"); err == nil {
+		t.Fatal("expected an error for monthly klines")
+	}
+}
@@ -0,0 +1,26 @@
+package market
+
+import "fmt"
+
+// Category is a Bybit v5 product category
+type Category string
+
+const (
+	CategorySpot    Category = "spot"
+	CategoryLinear  Category = "linear"
+	CategoryInverse Category = "inverse"
+	CategoryOption  Category = "option"
+)
+
+// Categories lists every product category
+var Categories = []Category{CategorySpot, CategoryLinear, CategoryInverse, CategoryOption}
+
+// ParseCategory validates a category name
+func ParseCategory(s string) (Category, error) {
+	for _, c := range Categories {
+		if string(c) == s {
+			return c, nil
+		}
+	}
+	return "", fmt.Errorf("unknown category: %q", s)
+}
@@ -0,0 +1,160 @@
+package market
+
+import (
+	"sync"
+	"time"
+)
+
+// Timestamps are the times of an event along its way: the matching engine
+// producing it (cts, or the trade time), the exchange sending the message
+// (its ts) and the connector receiving it. ReceivedTime carries a monotonic
+// clock reading while it is not serialized. Unknown times are zero.
+type Timestamps struct {
+	MatchingTime time.Time `json:"matching_time"`
+	ExchangeTime time.Time `json:"exchange_time"`
+	ReceivedTime time.Time `json:"received_time"`
+}
+
+// Latency returns the time from the exchange sending the event to its
+// receipt, including the clock offset, or zero when either time is unknown
+func (t Timestamps) Latency() time.Duration {
+	if t.ExchangeTime.IsZero() || t.ReceivedTime.IsZero() {
+		return 0
+	}
+	return t.ReceivedTime.Sub(t.ExchangeTime)
+}
+
+// MatchingLatency returns the time from the matching engine to the receipt
+// of the event, including the clock offset, or zero when either is unknown
+func (t Timestamps) MatchingLatency() time.Duration {
+	if t.MatchingTime.IsZero() || t.ReceivedTime.IsZero() {
+		return 0
+	}
+	return t.ReceivedTime.Sub(t.MatchingTime)
+}
+
+// Skew is an estimate of the local clock against the exchange's
+type Skew struct {
+	// Offset is the local clock minus the exchange's, positive when the
+	// local clock is ahead. It is only known once Synced.
+	Offset time.Duration `json:"offset"`
+	// Uncertainty is half the round trip of the server time request
+	// Offset was measured with
+	Uncertainty time.Duration `json:"uncertainty"`
+	Synced      bool          `json:"synced"`
+	// MinDelay is the smallest receive time minus message ts within the
+	// window: the fastest one-way latency plus Offset
+	MinDelay time.Duration `json:"min_delay"`
+}
+
+// Latency returns the one-way latency of the fastest recent messages with
+// the clock offset removed. A high latency with a small offset means the
+// network or the exchange is lagging; a delay explained by the offset means
+// the local clock is off.
+func (s Skew) Latency() time.Duration {
+	return s.MinDelay - s.Offset
+}
+
+// ClockSkew estimates the offset of the local clock from the exchange's.
+// Server time requests measure the offset within half their round trip,
+// NTP style; message timestamps bound it from above, since no message
+// arrives before it was sent.
+type ClockSkew struct {
+	// Window is how long message delays and server time samples are kept
+	Window time.Duration
+
+	mu      sync.Mutex
+	samples []skewSample
+	delays  [skewBuckets]delayBucket
+}
+
+type skewSample struct {
+	at          time.Time
+	offset      time.Duration
+	uncertainty time.Duration
+}
+
+// delayBucket keeps the smallest delay of a slice of the window
+type delayBucket struct {
+	start time.Time
+	min   time.Duration
+}
+
+const (
+	skewBuckets = 10
+	maxSamples  = 16
+)
+
+// NewClockSkew creates an estimator over a ten minute window
+func NewClockSkew() *ClockSkew {
+	return &ClockSkew{Window: 10 * time.Minute}
+}
+
+// ObserveServerTime records the exchange time server, answered to a
+// request sent at sent and received at received
+func (c *ClockSkew) ObserveServerTime(sent, server, received time.Time) {
+	rtt := received.Sub(sent)
+	if rtt < 0 || server.IsZero() {
+		return
+	}
+	s := skewSample{
+		at: received,
+		// The server read its clock half way through the round trip
+		offset:      sent.Add(rtt / 2).Sub(server),
+		uncertainty: rtt / 2,
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.samples = append(c.samples, s)
+	if len(c.samples) > maxSamples {
+		c.samples = c.samples[len(c.samples)-maxSamples:]
+	}
+}
+
+// ObserveMessage records the delay of a message sent by the exchange at
+// exchange and received at received
+func (c *ClockSkew) ObserveMessage(exchange, received time.Time) {
+	if exchange.IsZero() {
+		return
+	}
+	delay := received.Sub(exchange)
+	span := c.Window / skewBuckets
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b := &c.delays[int(received.UnixNano()/int64(span))%skewBuckets]
+	start := received.Truncate(span)
+	if !b.start.Equal(start) {
+		*b = delayBucket{start: start, min: delay}
+	} else if delay < b.min {
+		b.min = delay
+	}
+}
+
+// Estimate returns the current estimate at now. The offset is that of the
+// most precise server time sample within the window.
+func (c *ClockSkew) Estimate(now time.Time) Skew {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var s Skew
+	for _, sample := range c.samples {
+		if now.Sub(sample.at) > c.Window {
+			continue
+		}
+		if !s.Synced || sample.uncertainty < s.Uncertainty {
+			s.Offset, s.Uncertainty, s.Synced = sample.offset, sample.uncertainty, true
+		}
+	}
+	first := true
+	for _, b := range c.delays {
+		if b.start.IsZero() || now.Sub(b.start) > c.Window {
+			continue
+		}
+		if first || b.min < s.MinDelay {
+			s.MinDelay, first = b.min, false
+		}
+	}
+	return s
+}
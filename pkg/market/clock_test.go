@@ -0,0 +1,57 @@
+package market
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClockSkewPrefersPreciseSamples(t *testing.T) {
+	c := NewClockSkew()
+	start := time.Unix(1700000000, 0)
+	server := func(sent time.Time, rtt, offset time.Duration) {
+		c.ObserveServerTime(sent, sent.Add(rtt/2-offset), sent.Add(rtt))
+	}
+
+	if s := c.Estimate(start); s.Synced {
+		t.Fatalf("expected no estimate before a sample, got %+v", s)
+	}
+	// A slow request, then a fast one: the fast one wins
+	server(start, 400*time.Millisecond, 30*time.Millisecond)
+	server(start.Add(time.Second), 20*time.Millisecond, 50*time.Millisecond)
+	s := c.Estimate(start.Add(2 * time.Second))
+	if !s.Synced || s.Offset != 50*time.Millisecond || s.Uncertainty != 10*time.Millisecond {
+		t.Fatalf("unexpected estimate: %+v", s)
+	}
+
+	// Samples older than the window are dropped
+	server(start.Add(c.Window), 100*time.Millisecond, -20*time.Millisecond)
+	s = c.Estimate(start.Add(c.Window + 2*time.Second))
+	if s.Offset != -20*time.Millisecond || s.Uncertainty != 50*time.Millisecond {
+		t.Fatalf("expected the newer sample once the precise one expired, got %+v", s)
+	}
+}
+
+func TestClockSkewMinDelay(t *testing.T) {
+	c := NewClockSkew()
+	start := time.Unix(1700000000, 0)
+	for i, delay := range []time.Duration{80, 30, 60} {
+		received := start.Add(time.Duration(i) * time.Second)
+		c.ObserveMessage(received.Add(-delay*time.Millisecond), received)
+	}
+	c.ObserveServerTime(start, start.Add(-15*time.Millisecond), start.Add(10*time.Millisecond))
+
+	s := c.Estimate(start.Add(3 * time.Second))
+	if s.MinDelay != 30*time.Millisecond {
+		t.Fatalf("unexpected min delay %v", s.MinDelay)
+	}
+	if s.Offset != 20*time.Millisecond || s.Latency() != 10*time.Millisecond {
+		t.Fatalf("unexpected offset %v and latency %v", s.Offset, s.Latency())
+	}
+
+	// Delays leave the estimate with their bucket
+	later := start.Add(c.Window + time.Minute)
+	c.ObserveMessage(later.Add(-90*time.Millisecond), later)
+	if s := c.Estimate(later); s.MinDelay != 90*time.Millisecond {
+		t.Fatalf("expected the old delays to expire, got %v", s.MinDelay)
+	}
+}
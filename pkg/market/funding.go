@@ -0,0 +1,18 @@
+package market
+
+import "time"
+
+// FundingRate is a settled funding rate of a perpetual contract
+type FundingRate struct {
+	Symbol string    `json:"symbol"`
+	Rate   float64   `json:"rate"`
+	Time   time.Time `json:"time"`
+}
+
+// OpenInterest is the open interest of a contract at the end of an interval
+type OpenInterest struct {
+	Symbol   string        `json:"symbol"`
+	Interval time.Duration `json:"interval"`
+	Value    float64       `json:"value"`
+	Time     time.Time     `json:"time"`
+}
@@ -0,0 +1,106 @@
+package market
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Instrument holds the trading rules of a symbol
+type Instrument struct {
+	Symbol      string   `json:"symbol"`
+	Category    Category `json:"category"`
+	Status      string   `json:"status"`
+	BaseCoin    string   `json:"base_coin"`
+	QuoteCoin   string   `json:"quote_coin"`
+	TickSize    float64  `json:"tick_size"`
+	MinPrice    float64  `json:"min_price"`
+	MaxPrice    float64  `json:"max_price"`
+	QtyStep     float64  `json:"qty_step"`
+	MinQty      float64  `json:"min_qty"`
+	MaxQty      float64  `json:"max_qty"`
+	MinNotional float64  `json:"min_notional"`
+}
+
+// InstrumentStatusTrading is the status of an instrument open for trading
+const InstrumentStatusTrading = "Trading"
+
+// CheckPrice verifies that a price is on the tick grid and within limits
+func (i *Instrument) CheckPrice(price float64) error {
+	if price <= 0 {
+		return fmt.Errorf("%s: price must be positive", i.Symbol)
+	}
+	if i.TickSize > 0 && !onStep(price, i.TickSize) {
+		return fmt.Errorf("%s: price %v is not a multiple of tick size %v", i.Symbol, price, i.TickSize)
+	}
+	if i.MinPrice > 0 && price < i.MinPrice {
+		return fmt.Errorf("%s: price %v is below the minimum %v", i.Symbol, price, i.MinPrice)
+	}
+	if i.MaxPrice > 0 && price > i.MaxPrice {
+		return fmt.Errorf("%s: price %v is above the maximum %v", i.Symbol, price, i.MaxPrice)
+	}
+	return nil
+}
+
+// CheckQty verifies that a quantity is on the step grid and within limits
+func (i *Instrument) CheckQty(qty float64) error {
+	if qty <= 0 {
+		return fmt.Errorf("%s: qty must be positive", i.Symbol)
+	}
+	if i.QtyStep > 0 && !onStep(qty, i.QtyStep) {
+		return fmt.Errorf("%s: qty %v is not a multiple of qty step %v", i.Symbol, qty, i.QtyStep)
+	}
+	if i.MinQty > 0 && qty < i.MinQty {
+		return fmt.Errorf("%s: qty %v is below the minimum %v", i.Symbol, qty, i.MinQty)
+	}
+	if i.MaxQty > 0 && qty > i.MaxQty {
+		return fmt.Errorf("%s: qty %v is above the maximum %v", i.Symbol, qty, i.MaxQty)
+	}
+	return nil
+}
+
+// CheckNotional verifies that price * qty reaches the minimum order value
+func (i *Instrument) CheckNotional(price, qty float64) error {
+	if i.MinNotional > 0 && price*qty < i.MinNotional*(1-stepTolerance) {
+		return fmt.Errorf("%s: order value %v is below the minimum %v", i.Symbol, price*qty, i.MinNotional)
+	}
+	return nil
+}
+
+// RoundPrice rounds a price to the nearest tick
+func (i *Instrument) RoundPrice(price float64) float64 {
+	if i.TickSize <= 0 {
+		return price
+	}
+	return toStep(math.Round(price/i.TickSize), i.TickSize)
+}
+
+// RoundQty rounds a quantity down to the qty step, so an order never
+// exceeds the intended size
+func (i *Instrument) RoundQty(qty float64) float64 {
+	if i.QtyStep <= 0 {
+		return qty
+	}
+	return toStep(math.Floor(qty/i.QtyStep+stepTolerance), i.QtyStep)
+}
+
+// toStep returns n steps, trimmed to the decimals of step so that results
+// such as 0.30000000000000004 come out as 0.3
+func toStep(n, step float64) float64 {
+	decimals := 0
+	if s := strconv.FormatFloat(step, 'f', -1, 64); strings.Contains(s, ".") {
+		decimals = len(s) - strings.Index(s, ".") - 1
+	}
+	v, _ := strconv.ParseFloat(strconv.FormatFloat(n*step, 'f', decimals, 64), 64)
+	return v
+}
+
+// stepTolerance absorbs the float error of values parsed from decimals
+const stepTolerance = 1e-9
+
+// onStep reports whether v is a whole multiple of step
+func onStep(v, step float64) bool {
+	n := v / step
+	return math.Abs(n-math.Round(n)) <= stepTolerance*math.Max(1, math.Abs(n))
+}
@@ -0,0 +1,172 @@
+package market
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// InstrumentLoader fetches every instrument of a category, for example
+// from /v5/market/instruments-info
+type InstrumentLoader func(ctx context.Context, category Category) ([]Instrument, error)
+
+// InstrumentEvent reports a change to an instrument between two loads
+type InstrumentEvent struct {
+	Instrument     Instrument `json:"instrument"`
+	PreviousStatus string     `json:"previous_status"`
+	// Listed is set on instruments that appeared since the previous load
+	Listed bool `json:"listed"`
+	// Removed is set on instruments missing from the latest load
+	Removed bool `json:"removed"`
+}
+
+// InstrumentRegistry caches the trading rules of every instrument of the
+// configured categories. It is safe for concurrent use.
+type InstrumentRegistry struct {
+	Loader     InstrumentLoader
+	Categories []Category
+	// OnChange receives status changes, listings and removals. It is not
+	// called for the first load of a category.
+	OnChange func(InstrumentEvent)
+	// OnError receives the errors of the periodic refresh
+	OnError func(error)
+
+	mu          sync.RWMutex
+	instruments map[Category]map[string]Instrument
+}
+
+// NewInstrumentRegistry creates a registry loading the given categories,
+// or every category when none is given
+func NewInstrumentRegistry(loader InstrumentLoader, categories ...Category) *InstrumentRegistry {
+	if len(categories) == 0 {
+		categories = Categories
+	}
+	return &InstrumentRegistry{
+		Loader:      loader,
+		Categories:  categories,
+		instruments: make(map[Category]map[string]Instrument),
+	}
+}
+
+// Instrument returns the trading rules of a symbol
+func (r *InstrumentRegistry) Instrument(category Category, symbol string) (Instrument, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	inst, ok := r.instruments[category][symbol]
+	return inst, ok
+}
+
+// Instruments returns every instrument of a category
+func (r *InstrumentRegistry) Instruments(category Category) []Instrument {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]Instrument, 0, len(r.instruments[category]))
+	for _, inst := range r.instruments[category] {
+		out = append(out, inst)
+	}
+	return out
+}
+
+// Refresh reloads every category through the loader
+func (r *InstrumentRegistry) Refresh(ctx context.Context) error {
+	if r.Loader == nil {
+		return fmt.Errorf("instrument registry has no loader")
+	}
+	for _, category := range r.Categories {
+		instruments, err := r.Loader(ctx, category)
+		if err != nil {
+			return fmt.Errorf("failed to load %s instruments: %w", category, err)
+		}
+		r.Set(category, instruments)
+	}
+	return nil
+}
+
+// Run refreshes the registry every interval until the context is done
+func (r *InstrumentRegistry) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := r.Refresh(ctx); err != nil && r.OnError != nil {
+				r.OnError(err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Set replaces the instruments of a category and reports the changes
+func (r *InstrumentRegistry) Set(category Category, instruments []Instrument) {
+	next := make(map[string]Instrument, len(instruments))
+	for _, inst := range instruments {
+		inst.Category = category
+		next[inst.Symbol] = inst
+	}
+
+	r.mu.Lock()
+	prev, loaded := r.instruments[category]
+	r.instruments[category] = next
+	r.mu.Unlock()
+
+	if !loaded || r.OnChange == nil {
+		return
+	}
+	for symbol, inst := range next {
+		old, ok := prev[symbol]
+		switch {
+		case !ok:
+			r.OnChange(InstrumentEvent{Instrument: inst, Listed: true})
+		case old.Status != inst.Status:
+			r.OnChange(InstrumentEvent{Instrument: inst, PreviousStatus: old.Status})
+		}
+	}
+	for symbol, old := range prev {
+		if _, ok := next[symbol]; !ok {
+			r.OnChange(InstrumentEvent{Instrument: old, PreviousStatus: old.Status, Removed: true})
+		}
+	}
+}
+
+// LoadFile loads instruments saved by SaveFile, for use offline
+func (r *InstrumentRegistry) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read instruments file: %w", err)
+	}
+	var instruments []Instrument
+	if err := json.Unmarshal(data, &instruments); err != nil {
+		return fmt.Errorf("failed to decode instruments file: %w", err)
+	}
+
+	byCategory := make(map[Category][]Instrument)
+	for _, inst := range instruments {
+		if _, err := ParseCategory(string(inst.Category)); err != nil {
+			return fmt.Errorf("instrument %s: %w", inst.Symbol, err)
+		}
+		byCategory[inst.Category] = append(byCategory[inst.Category], inst)
+	}
+	for category, list := range byCategory {
+		r.Set(category, list)
+	}
+	return nil
+}
+
+// SaveFile writes every cached instrument to a JSON file
+func (r *InstrumentRegistry) SaveFile(path string) error {
+	var instruments []Instrument
+	for _, category := range Categories {
+		instruments = append(instruments, r.Instruments(category)...)
+	}
+	data, err := json.MarshalIndent(instruments, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode instruments: %w", err)
+	}
+	return os.WriteFile(path, data, 0o644)
+}
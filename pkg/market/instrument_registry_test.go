@@ -0,0 +1,86 @@
+package market
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestInstrumentRounding(t *testing.T) {
+	inst := Instrument{Symbol: "BTCUSDT", TickSize: 0.1, QtyStep: 0.001}
+
+	if got := inst.RoundPrice(30000.26); got != 30000.3 {
+		t.Fatalf("unexpected rounded price: %v", got)
+	}
+	if got := inst.RoundQty(0.0029); got != 0.002 {
+		t.Fatalf("unexpected rounded qty: %v", got)
+	}
+	if got := inst.RoundQty(0.003); got != 0.003 {
+		t.Fatalf("qty already on the step must not change: %v", got)
+	}
+	if err := inst.CheckPrice(inst.RoundPrice(0.1 + 0.2)); err != nil {
+		t.Fatalf("rounded price must pass validation: %v", err)
+	}
+}
+
+func TestInstrumentRegistryStatusEvents(t *testing.T) {
+	loads := [][]Instrument{
+		{{Symbol: "BTCUSDT", Status: "Trading"}, {Symbol: "ETHUSDT", Status: "Trading"}},
+		{{Symbol: "BTCUSDT", Status: "Settling"}, {Symbol: "SOLUSDT", Status: "PreLaunch"}},
+	}
+	n := 0
+	r := NewInstrumentRegistry(func(ctx context.Context, category Category) ([]Instrument, error) {
+		load := loads[n]
+		n++
+		return load, nil
+	}, CategoryLinear)
+
+	var events []InstrumentEvent
+	r.OnChange = func(e InstrumentEvent) { events = append(events, e) }
+
+	if err := r.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("the first load must not report changes: %+v", events)
+	}
+	if inst, ok := r.Instrument(CategoryLinear, "BTCUSDT"); !ok || inst.Category != CategoryLinear {
+		t.Fatalf("unexpected instrument: %+v", inst)
+	}
+
+	if err := r.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]InstrumentEvent{}
+	for _, e := range events {
+		got[e.Instrument.Symbol] = e
+	}
+	if e := got["BTCUSDT"]; e.PreviousStatus != "Trading" || e.Instrument.Status != "Settling" {
+		t.Fatalf("unexpected status change: %+v", e)
+	}
+	if !got["SOLUSDT"].Listed || !got["ETHUSDT"].Removed || len(events) != 3 {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+}
+
+func TestInstrumentRegistryFile(t *testing.T) {
+	r := NewInstrumentRegistry(nil)
+	r.Set(CategorySpot, []Instrument{{Symbol: "BTCUSDT", TickSize: 0.01}})
+	r.Set(CategoryOption, []Instrument{{Symbol: "BTC-30DEC22-18000-C", TickSize: 5}})
+
+	path := filepath.Join(t.TempDir(), "instruments.json")
+	if err := r.SaveFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewInstrumentRegistry(nil)
+	if err := loaded.LoadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if inst, ok := loaded.Instrument(CategoryOption, "BTC-30DEC22-18000-C"); !ok || inst.TickSize != 5 {
+		t.Fatalf("unexpected instrument: %+v", inst)
+	}
+	if _, ok := loaded.Instrument(CategoryLinear, "BTCUSDT"); ok {
+		t.Fatal("instruments must stay in their category")
+	}
+}
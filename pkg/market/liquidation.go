@@ -0,0 +1,205 @@
+package market
+
+import "time"
+
+// Liquidation is a forced close of a position, received from the
+// allLiquidation topic of linear and inverse contracts
+type Liquidation struct {
+	Symbol string `json:"symbol"`
+	// Side is the side of the liquidated position: a Buy liquidation closes
+	// a long by selling into the bids
+	Side  string    `json:"side"`
+	Size  float64   `json:"size"`
+	Price float64   `json:"price"`
+	Time  time.Time `json:"time"`
+	// Timestamps hold the liquidation time as MatchingTime
+	Timestamps
+}
+
+// Notional returns the quote value of the liquidation
+func (l *Liquidation) Notional() float64 {
+	return l.Size * l.Price
+}
+
+// OrderSide returns the side of the order closing the position, which is
+// the opposite of the position's side
+func (l *Liquidation) OrderSide() string {
+	if l.Side == "Buy" {
+		return "Sell"
+	}
+	return "Buy"
+}
+
+// CascadeConfig sets how liquidations are aggregated into cascade events
+type CascadeConfig struct {
+	// Windows are the rolling windows liquidations are summed over
+	Windows []time.Duration
+	// Thresholds are ascending ratios of the liquidated size in a window to
+	// the book depth the liquidation orders trade against. An event is
+	// raised each time a higher threshold is passed.
+	Thresholds []float64
+	// DepthBps is the distance from the mid, in basis points, within which
+	// the book depth is measured
+	DepthBps float64
+	// MinNotional is the liquidated notional a window needs before it
+	// raises events, so that thin books do not report single small fills
+	MinNotional float64
+}
+
+// DefaultCascadeConfig returns windows of 10 seconds and a minute, and
+// thresholds of a half, one and two times the depth within 50 bps
+func DefaultCascadeConfig() CascadeConfig {
+	return CascadeConfig{
+		Windows:    []time.Duration{10 * time.Second, time.Minute},
+		Thresholds: []float64{0.5, 1, 2},
+		DepthBps:   50,
+	}
+}
+
+// CascadeEvent reports the liquidations of one position side passing a
+// threshold within a window
+type CascadeEvent struct {
+	Symbol string `json:"symbol"`
+	// Side is the side of the liquidated positions
+	Side   string        `json:"side"`
+	Window time.Duration `json:"window"`
+	Count  int           `json:"count"`
+	Size   float64       `json:"size"`
+	// Notional is the quote value of the liquidations in the window
+	Notional float64 `json:"notional"`
+	// Depth is the size resting within DepthBps of the mid on the side of
+	// the book the liquidation orders trade against
+	Depth float64 `json:"depth"`
+	// Ratio is Size / Depth and Threshold the highest threshold it passed
+	Ratio     float64   `json:"ratio"`
+	Threshold float64   `json:"threshold"`
+	Time      time.Time `json:"time"`
+}
+
+// CascadeDetector aggregates the liquidations of one symbol by side over
+// rolling windows, measured against the time of the latest liquidation.
+// CascadeDetector is not safe for concurrent use; callers must synchronise.
+type CascadeDetector struct {
+	Symbol string
+	Config CascadeConfig
+
+	emit  func(CascadeEvent)
+	sides map[string]*cascadeSide
+}
+
+// cascadeSide holds the liquidations of one position side within the
+// longest window and the number of thresholds each window has passed
+type cascadeSide struct {
+	liquidations []Liquidation
+	levels       map[time.Duration]int
+}
+
+// NewCascadeDetector creates a detector passing its events to emit
+func NewCascadeDetector(symbol string, config CascadeConfig, emit func(CascadeEvent)) *CascadeDetector {
+	return &CascadeDetector{
+		Symbol: symbol,
+		Config: config,
+		emit:   emit,
+		sides:  make(map[string]*cascadeSide),
+	}
+}
+
+// Add adds a liquidation and compares each window with the depth of book.
+// Without a two-sided book no events are raised.
+func (d *CascadeDetector) Add(l Liquidation, book *OrderBook) {
+	s, ok := d.sides[l.Side]
+	if !ok {
+		s = &cascadeSide{levels: make(map[time.Duration]int)}
+		d.sides[l.Side] = s
+	}
+	s.liquidations = append(s.liquidations, l)
+	d.expire(s, l.Time)
+
+	var depth float64
+	if book != nil {
+		bids, asks := book.LiquidityWithinBps(d.Config.DepthBps)
+		depth = asks
+		if l.OrderSide() == "Sell" {
+			depth = bids
+		}
+	}
+
+	for _, w := range d.Config.Windows {
+		stats := s.stats(l.Time.Add(-w))
+		if depth == 0 || stats.Notional < d.Config.MinNotional {
+			continue
+		}
+		ratio := stats.Size / depth
+		level := 0
+		for level < len(d.Config.Thresholds) && ratio >= d.Config.Thresholds[level] {
+			level++
+		}
+		// A window falling back re-arms its lower thresholds
+		prev := s.levels[w]
+		s.levels[w] = level
+		if level <= prev || d.emit == nil {
+			continue
+		}
+		d.emit(CascadeEvent{
+			Symbol:    d.Symbol,
+			Side:      l.Side,
+			Window:    w,
+			Count:     stats.Count,
+			Size:      stats.Size,
+			Notional:  stats.Notional,
+			Depth:     depth,
+			Ratio:     ratio,
+			Threshold: d.Config.Thresholds[level-1],
+			Time:      l.Time,
+		})
+	}
+}
+
+// LiquidationStats holds aggregates over a set of liquidations
+type LiquidationStats struct {
+	Count    int     `json:"count"`
+	Size     float64 `json:"size"`
+	Notional float64 `json:"notional"`
+}
+
+// Stats returns the aggregates of the liquidations of a position side
+// within window of the latest one. Liquidations are only kept for the
+// longest of the configured windows.
+func (d *CascadeDetector) Stats(side string, window time.Duration) LiquidationStats {
+	s, ok := d.sides[side]
+	if !ok || len(s.liquidations) == 0 {
+		return LiquidationStats{}
+	}
+	return s.stats(s.liquidations[len(s.liquidations)-1].Time.Add(-window))
+}
+
+// expire drops the liquidations older than the longest window before now
+func (d *CascadeDetector) expire(s *cascadeSide, now time.Time) {
+	var longest time.Duration
+	for _, w := range d.Config.Windows {
+		if w > longest {
+			longest = w
+		}
+	}
+	cutoff := now.Add(-longest)
+	i := 0
+	for i < len(s.liquidations) && s.liquidations[i].Time.Before(cutoff) {
+		i++
+	}
+	s.liquidations = append(s.liquidations[:0], s.liquidations[i:]...)
+}
+
+// stats sums the liquidations from since on
+func (s *cascadeSide) stats(since time.Time) LiquidationStats {
+	var st LiquidationStats
+	for i := len(s.liquidations) - 1; i >= 0; i-- {
+		l := &s.liquidations[i]
+		if l.Time.Before(since) {
+			break
+		}
+		st.Count++
+		st.Size += l.Size
+		st.Notional += l.Notional()
+	}
+	return st
+}
@@ -0,0 +1,54 @@
+package market
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCascadeDetectorEscalatesAgainstDepth(t *testing.T) {
+	var events []CascadeEvent
+	d := NewCascadeDetector("BTCUSDT", CascadeConfig{
+		Windows:    []time.Duration{10 * time.Second},
+		Thresholds: []float64{0.5, 1},
+		DepthBps:   100,
+	}, func(e CascadeEvent) { events = append(events, e) })
+	// 4 bid within 100 bps of the 100.5 mid; the level at 99 is outside
+	book := &OrderBook{
+		Bids: []Item{{Price: 100, Amount: 3}, {Price: 99.9, Amount: 1}, {Price: 99, Amount: 10}},
+		Asks: []Item{{Price: 101, Amount: 1}},
+	}
+	start := time.Unix(1700000000, 0)
+	long := func(at time.Duration, size float64) {
+		d.Add(Liquidation{Symbol: "BTCUSDT", Side: "Buy", Size: size, Price: 100, Time: start.Add(at)}, book)
+	}
+
+	long(0, 1)
+	if len(events) != 0 {
+		t.Fatalf("expected no event below the first threshold, got %+v", events)
+	}
+	long(time.Second, 1.5)
+	long(2*time.Second, 0.1)
+	if len(events) != 1 || events[0].Threshold != 0.5 || events[0].Depth != 4 || events[0].Size != 2.5 {
+		t.Fatalf("expected one event at the first threshold, got %+v", events)
+	}
+	long(3*time.Second, 2)
+	if len(events) != 2 || events[1].Threshold != 1 || events[1].Count != 4 || events[1].Notional != 460 {
+		t.Fatalf("expected an escalation, got %+v", events)
+	}
+
+	// Shorts are liquidated into the asks and tracked separately
+	d.Add(Liquidation{Symbol: "BTCUSDT", Side: "Sell", Size: 0.6, Price: 101, Time: start.Add(3 * time.Second)}, book)
+	if len(events) != 3 || events[2].Side != "Sell" || events[2].Depth != 1 {
+		t.Fatalf("expected a short cascade against the asks, got %+v", events)
+	}
+
+	// Once the window rolled past them the thresholds re-arm
+	long(20*time.Second, 0.1)
+	if got := d.Stats("Buy", 10*time.Second); got.Count != 1 {
+		t.Fatalf("expected the old liquidations to leave the window, got %+v", got)
+	}
+	long(21*time.Second, 2)
+	if len(events) != 4 || events[3].Threshold != 0.5 {
+		t.Fatalf("expected a new event after the window cooled down, got %+v", events)
+	}
+}
@@ -7,23 +7,72 @@ import (
 )
 
 type OderBookLocal struct {
-	ob map[string]*OrderBookL2
-	m  sync.Mutex
+	ob    map[string]*OrderBookL2
+	ts    map[string]Timestamps // timestamps of the last update per symbol
+	syncs map[string]*bookSync  // update ID tracking per symbol, see book_sync.go
+	m     sync.Mutex
 }
 
-func (o *OderBookLocal) GetOrderBook(ob OrderBook, t Ticker) {
+// GetOrderBook returns the sorted book of a symbol together with the
+// ticker of its best bid and offer. The ticker is nil while either side
+// of the book is empty.
+func (o *OderBookLocal) GetOrderBook(symbol string) (*OrderBook, *Ticker) {
+	ob := o.Snapshot(symbol)
+	t, ok := ob.TopOfBook(symbol)
+	if !ok {
+		return ob, nil
+	}
+	return ob, &t
+}
+
+func NewOrderBookLocal() *OderBookLocal {
+	return &OderBookLocal{
+		ob:    make(map[string]*OrderBookL2),
+		ts:    make(map[string]Timestamps),
+		syncs: make(map[string]*bookSync),
+	}
+}
+
+// func NewOrderBookLocal() *OrderBookLocal {
+// 	o := &OrderBookLocal{
+// 		ob: make(map[string]*OrderBookL2),
+// 	}
+// 	return o
+// }
+
+// Snapshot builds a sorted order book from the local levels of the given symbol
+func (o *OderBookLocal) Snapshot(symbol string) *OrderBook {
+	o.m.Lock()
+	defer o.m.Unlock()
+	return o.snapshot(symbol)
+}
+
+// SnapshotState builds the order book of a symbol like Snapshot, with the
+// update ID and sync state of the same book
+func (o *OderBookLocal) SnapshotState(symbol string) (book *OrderBook, updateID int64, synced bool) {
+	o.m.Lock()
+	defer o.m.Unlock()
+	if s, ok := o.syncs[symbol]; ok {
+		updateID, synced = s.updateID, s.synced && !s.resyncing
+	}
+	return o.snapshot(symbol), updateID, synced
+}
+
+// snapshot builds the order book of a symbol. The caller must hold the lock.
+func (o *OderBookLocal) snapshot(symbol string) *OrderBook {
+	ob := &OrderBook{
+		Bids: []Item{},
+		Asks: []Item{},
+	}
 	for _, v := range o.ob {
+		if v.Symbol != symbol {
+			continue
+		}
 		switch v.Side {
 		case "Buy":
-			ob.Bids = append(ob.Bids, Item{
-				Price:  v.Price,
-				Amount: v.Size,
-			})
+			ob.Bids = append(ob.Bids, Item{Price: v.Price, Amount: v.Size})
 		case "Sell":
-			ob.Asks = append(ob.Asks, Item{
-				Price:  v.Price,
-				Amount: v.Size,
-			})
+			ob.Asks = append(ob.Asks, Item{Price: v.Price, Amount: v.Size})
 		}
 	}
 
@@ -35,34 +84,29 @@ func (o *OderBookLocal) GetOrderBook(ob OrderBook, t Ticker) {
 		return ob.Asks[i].Price < ob.Asks[j].Price
 	})
 
-	now := time.Now()
-	ob.Timestamp = now
-	// o.m.Lock()
-	// defer o.m.Unlock()
-
-	t = Ticker{
-		Bid:     ob.Bids[0].Price,
-		BidSize: ob.Bids[0].Amount,
-		Ask:     ob.Asks[0].Price,
-		AskSize: ob.Asks[0].Amount,
-		Time:    now,
+	ob.Timestamps = o.ts[symbol]
+	ob.Timestamp = ob.ExchangeTime
+	if ob.Timestamp.IsZero() {
+		ob.Timestamp = time.Now()
 	}
-
-	return
+	return ob
 }
 
-func NewOrderBookLocal() *OderBookLocal {
-	return &OderBookLocal{
-		ob: make(map[string]*OrderBookL2),
-	}
+// SetTimestamps records the timestamps of the last update of a symbol
+func (o *OderBookLocal) SetTimestamps(symbol string, ts Timestamps) {
+	o.m.Lock()
+	defer o.m.Unlock()
+	o.ts[symbol] = ts
 }
 
-// func NewOrderBookLocal() *OrderBookLocal {
-// 	o := &OrderBookLocal{
-// 		ob: make(map[string]*OrderBookL2),
-// 	}
-// 	return o
-// }
+// Remove drops the levels and sync state of a symbol
+func (o *OderBookLocal) Remove(symbol string) {
+	o.m.Lock()
+	defer o.m.Unlock()
+	o.replaceLevels(symbol, nil)
+	delete(o.ts, symbol)
+	delete(o.syncs, symbol)
+}
 
 func (o *OderBookLocal) LoadSnapshot(newOrderBook []*OrderBookL2) error {
 	o.m.Lock()
@@ -79,7 +123,11 @@ func (o *OderBookLocal) LoadSnapshot(newOrderBook []*OrderBookL2) error {
 func (o *OderBookLocal) Update(delta *OrderBookL2Delta) {
 	o.m.Lock()
 	defer o.m.Unlock()
+	o.apply(delta)
+}
 
+// apply applies a delta; the caller must hold the lock
+func (o *OderBookLocal) apply(delta *OrderBookL2Delta) {
 	for _, e := range delta.Delete {
 		delete(o.ob, e.Key())
 	}
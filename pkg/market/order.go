@@ -11,7 +11,7 @@ type Order struct {
 	Symbol         string    `json:"symbol"`
 	Side           string    `json:"side"`
 	OrderType      string    `json:"order_type"`
-	Price          float32   `json:"price"`
+	Price          float64   `json:"price"`
 	Qty            float64   `json:"qty"`
 	TimeInForce    string    `json:"time_in_force"`
 	CreateType     string    `json:"create_type"`
@@ -36,6 +36,8 @@ type OrderBook struct {
 	Bids      []Item    `json:"bids"`
 	Asks      []Item    `json:"asks"`
 	Timestamp time.Time `json:"timestamp"`
+	// Timestamps are those of the last update applied to the book
+	Timestamps
 }
 
 // Item trandformed data types
@@ -64,7 +66,39 @@ func (o *OrderBook) GetBids() []Item {
 	return o.Bids
 }
 
-func (o *OrderBookL2) Key() string {
-	return strconv.FormatInt(o.ID, 10)
+// Clone returns a deep copy of the order book
+func (o *OrderBook) Clone() *OrderBook {
+	if o == nil {
+		return nil
+	}
+	return &OrderBook{
+		Bids:       append([]Item(nil), o.Bids...),
+		Asks:       append([]Item(nil), o.Asks...),
+		Timestamp:  o.Timestamp,
+		Timestamps: o.Timestamps,
+	}
+}
+
+// TopOfBook returns the best bid and offer of the book as a ticker,
+// stamped with the book's timestamp
+func (o *OrderBook) TopOfBook(symbol string) (Ticker, bool) {
+	if o == nil || len(o.Bids) == 0 || len(o.Asks) == 0 {
+		return Ticker{}, false
+	}
+	return Ticker{
+		Symbol:     symbol,
+		Bid:        o.Bids[0].Price,
+		BidSize:    o.Bids[0].Amount,
+		Ask:        o.Asks[0].Price,
+		AskSize:    o.Asks[0].Amount,
+		Time:       o.Timestamp,
+		Timestamps: o.Timestamps,
+		Derived:    true,
+	}, true
 }
 
+// Key identifies a price level. v5 books carry no level IDs, so levels
+// are keyed by symbol, side and price.
+func (o *OrderBookL2) Key() string {
+	return o.Symbol + ":" + o.Side + ":" + strconv.FormatFloat(o.Price, 'f', -1, 64)
+}
@@ -2,11 +2,20 @@ package market
 
 import "time"
 
-//
 type Ticker struct {
+	Symbol  string    `json:"symbol"`
 	Bid     float64   `json:"bid"`
 	BidSize float64   `json:"bid_size"`
 	Ask     float64   `json:"ask"`
 	AskSize float64   `json:"ask_size"`
 	Time    time.Time `json:"time"`
+	// LastPrice is only set on tickers received from the tickers topic
+	LastPrice float64 `json:"last_price"`
+	// Derived is set on tickers computed from the local order book
+	Derived bool `json:"derived"`
+	// Seq counts the top-of-book changes of a derived ticker
+	Seq int64 `json:"seq"`
+	// Timestamps are those of the message, or of the book update for a
+	// derived ticker
+	Timestamps
 }
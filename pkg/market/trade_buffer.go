@@ -0,0 +1,260 @@
+package market
+
+import "time"
+
+// TradeStats holds aggregates over a set of trades
+type TradeStats struct {
+	Count      int     `json:"count"`
+	Volume     float64 `json:"volume"`
+	BuyVolume  float64 `json:"buy_volume"`
+	SellVolume float64 `json:"sell_volume"`
+	Notional   float64 `json:"notional"`
+	VWAP       float64 `json:"vwap"`
+}
+
+func (s *TradeStats) add(t *windowTrade, sign float64) {
+	s.Count += int(sign)
+	s.Volume += sign * t.size
+	s.Notional += sign * t.size * t.price
+	switch t.side {
+	case "Buy":
+		s.BuyVolume += sign * t.size
+	case "Sell":
+		s.SellVolume += sign * t.size
+	}
+	if s.Count == 0 {
+		// Reset to avoid accumulating float error once the window is empty
+		*s = TradeStats{}
+		return
+	}
+	if s.Volume > 0 {
+		s.VWAP = s.Notional / s.Volume
+	}
+}
+
+// windowTrade is what the rolling windows keep of a trade
+type windowTrade struct {
+	time  time.Time
+	side  string
+	size  float64
+	price float64
+}
+
+func newWindowTrade(t *Trade) windowTrade {
+	return windowTrade{time: t.Time, side: t.Side, size: t.Size, price: t.Price}
+}
+
+// rollingWindow keeps running aggregates over the trades of the last d
+type rollingWindow struct {
+	d     time.Duration
+	start uint64 // sequence of the oldest trade inside the window
+	stats TradeStats
+}
+
+// TradeBuffer is a fixed-capacity ring buffer of trades for one symbol.
+// It keeps rolling aggregates over the configured windows, which end at
+// the time they are read, so a quiet market empties them. The windows
+// expire trades by time only: they cover every trade within their
+// duration, also those the ring has already overwritten.
+// TradeBuffer is not safe for concurrent use; callers must synchronise.
+type TradeBuffer struct {
+	trades  []Trade
+	next    uint64 // sequence assigned to the next trade
+	windows []*rollingWindow
+	// history holds the trades within the longest window, oldest first;
+	// historyStart is the sequence of its first trade
+	history      []windowTrade
+	historyStart uint64
+}
+
+// NewTradeBuffer creates a trade buffer holding up to capacity trades
+// with rolling aggregates over each of the given windows
+func NewTradeBuffer(capacity int, windows ...time.Duration) *TradeBuffer {
+	if capacity < 1 {
+		capacity = 1
+	}
+	b := &TradeBuffer{
+		trades: make([]Trade, capacity),
+	}
+	for _, d := range windows {
+		if d > 0 {
+			b.windows = append(b.windows, &rollingWindow{d: d})
+		}
+	}
+	return b
+}
+
+// Cap returns the capacity of the buffer
+func (b *TradeBuffer) Cap() int {
+	return len(b.trades)
+}
+
+// Len returns the number of trades currently held
+func (b *TradeBuffer) Len() int {
+	if b.next < uint64(len(b.trades)) {
+		return int(b.next)
+	}
+	return len(b.trades)
+}
+
+// Add appends a trade, overwriting the oldest one once the buffer is full
+func (b *TradeBuffer) Add(trade Trade) {
+	*b.at(b.next) = trade
+	b.next++
+	if len(b.windows) == 0 {
+		return
+	}
+
+	seq := b.historyStart + uint64(len(b.history))
+	wt := newWindowTrade(&trade)
+	b.history = append(b.history, wt)
+	first := seq
+	for _, w := range b.windows {
+		w.stats.add(&wt, 1)
+		cutoff := trade.Time.Add(-w.d)
+		for w.start < seq && b.historyAt(w.start).time.Before(cutoff) {
+			w.stats.add(b.historyAt(w.start), -1)
+			w.start++
+		}
+		if w.start < first {
+			first = w.start
+		}
+	}
+	// Drop the trades that left every window
+	b.history = b.history[first-b.historyStart:]
+	b.historyStart = first
+}
+
+func (b *TradeBuffer) historyAt(seq uint64) *windowTrade {
+	return &b.history[seq-b.historyStart]
+}
+
+// Range calls fn for each trade from oldest to newest until fn returns
+// false. The trade passed to fn points into the buffer and must not be
+// retained or modified.
+func (b *TradeBuffer) Range(fn func(*Trade) bool) {
+	for seq := b.oldest(); seq < b.next; seq++ {
+		if !fn(b.at(seq)) {
+			return
+		}
+	}
+}
+
+// Trades returns a copy of all trades from oldest to newest
+func (b *TradeBuffer) Trades() []Trade {
+	return b.copyFrom(b.oldest())
+}
+
+// Last returns a copy of the most recent n trades from oldest to newest
+func (b *TradeBuffer) Last(n int) []Trade {
+	if n <= 0 {
+		return nil
+	}
+	seq := b.oldest()
+	if b.next-seq > uint64(n) {
+		seq = b.next - uint64(n)
+	}
+	return b.copyFrom(seq)
+}
+
+// Since returns a copy of the trades within d before now
+func (b *TradeBuffer) Since(d time.Duration, now time.Time) []Trade {
+	return b.SinceTime(now.Add(-d))
+}
+
+// SinceTime returns a copy of the trades at or after t
+func (b *TradeBuffer) SinceTime(t time.Time) []Trade {
+	return b.copyFrom(b.search(func(tr *Trade) bool { return !tr.Time.Before(t) }))
+}
+
+// SinceID returns a copy of the trades that came after the trade with the
+// given ID. If the ID is no longer in the buffer all trades are returned
+// and ok is false, telling the caller that trades may have been missed.
+func (b *TradeBuffer) SinceID(id string) (trades []Trade, ok bool) {
+	for seq := b.next; seq > b.oldest(); seq-- {
+		if b.at(seq-1).TradeId == id {
+			return b.copyFrom(seq), true
+		}
+	}
+	return b.Trades(), false
+}
+
+// Stats returns the aggregates of the trades within d before now, from
+// the rolling window configured with d. Windows that were not configured
+// are computed on demand from the buffered trades, so they only cover the
+// last Cap trades. A now before the latest trade, as with a local clock
+// behind the exchange's, counts from the latest trade instead.
+func (b *TradeBuffer) Stats(d time.Duration, now time.Time) TradeStats {
+	var stats TradeStats
+	if b.next == 0 {
+		return stats
+	}
+	if last := b.at(b.next - 1).Time; now.Before(last) {
+		now = last
+	}
+	cutoff := now.Add(-d)
+	for _, w := range b.windows {
+		if w.d != d {
+			continue
+		}
+		// Take out the trades that left the window since the last one
+		// was added, without modifying it: readers may share the buffer.
+		stats = w.stats
+		end := b.historyStart + uint64(len(b.history))
+		for seq := w.start; seq < end && b.historyAt(seq).time.Before(cutoff); seq++ {
+			stats.add(b.historyAt(seq), -1)
+		}
+		return stats
+	}
+	for seq := b.search(func(tr *Trade) bool { return !tr.Time.Before(cutoff) }); seq < b.next; seq++ {
+		wt := newWindowTrade(b.at(seq))
+		stats.add(&wt, 1)
+	}
+	return stats
+}
+
+// Windows returns the windows that rolling aggregates are kept for
+func (b *TradeBuffer) Windows() []time.Duration {
+	out := make([]time.Duration, len(b.windows))
+	for i, w := range b.windows {
+		out[i] = w.d
+	}
+	return out
+}
+
+func (b *TradeBuffer) oldest() uint64 {
+	if b.next < uint64(len(b.trades)) {
+		return 0
+	}
+	return b.next - uint64(len(b.trades))
+}
+
+func (b *TradeBuffer) at(seq uint64) *Trade {
+	return &b.trades[seq%uint64(len(b.trades))]
+}
+
+func (b *TradeBuffer) copyFrom(seq uint64) []Trade {
+	if seq >= b.next {
+		return nil
+	}
+	out := make([]Trade, 0, b.next-seq)
+	for ; seq < b.next; seq++ {
+		out = append(out, *b.at(seq))
+	}
+	return out
+}
+
+// search returns the first sequence for which pred holds, assuming trades
+// are ordered so that pred is false and then true
+func (b *TradeBuffer) search(pred func(*Trade) bool) uint64 {
+	lo, hi := b.oldest(), b.next
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		if pred(b.at(mid)) {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	return lo
+}
@@ -0,0 +1,137 @@
+package market
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+func bufferTrade(i int, side string, t0 time.Time) Trade {
+	return Trade{
+		Time:    t0.Add(time.Duration(i) * time.Second),
+		Symbol:  "BTCUSDT",
+		Side:    side,
+		Size:    1,
+		Price:   float64(100 + i),
+		TradeId: fmt.Sprint(i),
+	}
+}
+
+func TestTradeBufferWrapsAround(t *testing.T) {
+	b := NewTradeBuffer(3)
+	t0 := time.Unix(0, 0)
+	for i := 0; i < 5; i++ {
+		b.Add(bufferTrade(i, "Buy", t0))
+	}
+
+	if b.Len() != 3 {
+		t.Fatalf("expected 3 trades, got %d", b.Len())
+	}
+	trades := b.Trades()
+	for i, id := range []string{"2", "3", "4"} {
+		if trades[i].TradeId != id {
+			t.Fatalf("trade %d: expected id %s, got %s", i, id, trades[i].TradeId)
+		}
+	}
+	if last := b.Last(2); len(last) != 2 || last[0].TradeId != "3" {
+		t.Fatalf("unexpected last trades: %+v", last)
+	}
+}
+
+func TestTradeBufferQueries(t *testing.T) {
+	b := NewTradeBuffer(10)
+	t0 := time.Unix(0, 0)
+	for i := 0; i < 6; i++ {
+		b.Add(bufferTrade(i, "Buy", t0))
+	}
+
+	now := t0.Add(5 * time.Second)
+	if got := b.Since(2*time.Second, now); len(got) != 3 || got[0].TradeId != "3" {
+		t.Fatalf("unexpected trades since 2s: %+v", got)
+	}
+	if got := b.Since(2*time.Second, now.Add(time.Minute)); len(got) != 0 {
+		t.Fatalf("expected no trades within 2s of a later now: %+v", got)
+	}
+
+	got, ok := b.SinceID("4")
+	if !ok || len(got) != 1 || got[0].TradeId != "5" {
+		t.Fatalf("unexpected trades since id 4: %+v %v", got, ok)
+	}
+	if got, ok := b.SinceID("missing"); ok || len(got) != 6 {
+		t.Fatalf("expected all trades and ok=false for unknown id, got %d %v", len(got), ok)
+	}
+
+	n := 0
+	b.Range(func(*Trade) bool {
+		n++
+		return n < 2
+	})
+	if n != 2 {
+		t.Fatalf("expected Range to stop after 2 trades, got %d", n)
+	}
+}
+
+func TestTradeBufferRollingStats(t *testing.T) {
+	b := NewTradeBuffer(4, 2*time.Second)
+	t0 := time.Unix(0, 0)
+	sides := []string{"Buy", "Sell", "Buy", "Sell", "Buy", "Buy"}
+	for i, side := range sides {
+		b.Add(bufferTrade(i, side, t0))
+
+		// The configured window must always agree with an on-demand scan,
+		// also between trades
+		now := t0.Add(time.Duration(i)*time.Second + 1500*time.Millisecond)
+		want := b.Stats(2*time.Second+time.Nanosecond, now)
+		got := b.Stats(2*time.Second, now)
+		if got.Count != want.Count || math.Abs(got.VWAP-want.VWAP) > 1e-9 {
+			t.Fatalf("after trade %d: rolling %+v, scanned %+v", i, got, want)
+		}
+	}
+
+	stats := b.Stats(2*time.Second, t0.Add(5*time.Second))
+	// Trades 3, 4 and 5 fall within two seconds of trade 5
+	if stats.Count != 3 || stats.BuyVolume != 2 || stats.SellVolume != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if stats.VWAP != 104 {
+		t.Fatalf("expected vwap 104, got %v", stats.VWAP)
+	}
+
+	// A quiet market empties the window without new trades
+	if stats := b.Stats(2*time.Second, t0.Add(time.Minute)); stats.Count != 0 || stats.Volume != 0 {
+		t.Fatalf("expected an empty window a minute later, got %+v", stats)
+	}
+	// A clock behind the exchange's counts from the latest trade
+	if stats := b.Stats(2*time.Second, t0); stats.Count != 3 {
+		t.Fatalf("expected the window to end at the latest trade, got %+v", stats)
+	}
+}
+
+func TestTradeBufferStatsOutliveCapacity(t *testing.T) {
+	b := NewTradeBuffer(10, time.Minute)
+	t0 := time.Unix(0, 0)
+	for i := 0; i < 50; i++ {
+		tr := bufferTrade(i, "Buy", t0)
+		tr.Time = t0.Add(time.Duration(i) * time.Second / 10)
+		b.Add(tr)
+	}
+	if b.Len() != 10 {
+		t.Fatalf("expected 10 buffered trades, got %d", b.Len())
+	}
+	// The window covers every trade of the last minute, not just the buffered ones
+	stats := b.Stats(time.Minute, t0.Add(5*time.Second))
+	if stats.Count != 50 || stats.Volume != 50 || math.Abs(stats.VWAP-124.5) > 1e-9 {
+		t.Fatalf("expected stats over all 50 trades, got %+v", stats)
+	}
+
+	// Trades leave the window by time only
+	b.Add(bufferTrade(65, "Sell", t0))
+	stats = b.Stats(time.Minute, t0.Add(65*time.Second))
+	if stats.Count != 1 || stats.SellVolume != 1 || stats.BuyVolume != 0 {
+		t.Fatalf("expected only the last trade within the window, got %+v", stats)
+	}
+	if len(b.history) != 1 {
+		t.Fatalf("expected expired trades to be released, %d kept", len(b.history))
+	}
+}
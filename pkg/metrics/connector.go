@@ -0,0 +1,195 @@
+package metrics
+
+import (
+	"bybit_connector/pkg/market"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Connector holds the metrics of the connector's streams. Its methods do
+// nothing on a nil Connector, so components record unconditionally and
+// metrics stay disabled until one is set. It serves them over HTTP in the
+// Prometheus exposition formats.
+type Connector struct {
+	// Registry holds the connector's metrics; register others to serve them too
+	Registry *prometheus.Registry
+
+	handler         http.Handler
+	messages        *prometheus.CounterVec
+	parseErrors     *prometheus.CounterVec
+	reconnects      *prometheus.CounterVec
+	connected       *prometheus.GaugeVec
+	pingRTT         *prometheus.HistogramVec
+	dispatch        prometheus.Histogram
+	bookUpdates     *prometheus.CounterVec
+	sequenceGaps    *prometheus.CounterVec
+	resyncs         *prometheus.CounterVec
+	exchangeLatency *prometheus.HistogramVec
+	matchingLatency *prometheus.HistogramVec
+	clockOffset     prometheus.Gauge
+	clockError      prometheus.Gauge
+	minDelay        prometheus.Gauge
+}
+
+// latencyBuckets span sub-millisecond dispatch to multi-second exchange delays
+var latencyBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// NewConnector registers the connector's metrics in a new registry
+func NewConnector() *Connector {
+	r := prometheus.NewRegistry()
+	f := promauto.With(r)
+	return &Connector{
+		Registry: r,
+		handler:  promhttp.HandlerFor(r, promhttp.HandlerOpts{Registry: r}),
+		messages: f.NewCounterVec(prometheus.CounterOpts{Name: "bybit_ws_messages_total",
+			Help: "WebSocket messages received per topic; control messages have the topic \"control\"."}, []string{"topic"}),
+		parseErrors: f.NewCounterVec(prometheus.CounterOpts{Name: "bybit_parse_errors_total",
+			Help: "Messages the parser failed to decode, per topic."}, []string{"topic"}),
+		reconnects: f.NewCounterVec(prometheus.CounterOpts{Name: "bybit_ws_reconnects_total",
+			Help: "Reconnect attempts per connection and reason."}, []string{"connection", "reason"}),
+		connected: f.NewGaugeVec(prometheus.GaugeOpts{Name: "bybit_ws_connected",
+			Help: "1 while a connection is up, 0 from a read error until the reconnect succeeds."}, []string{"connection"}),
+		pingRTT: f.NewHistogramVec(prometheus.HistogramOpts{Name: "bybit_ws_ping_rtt_seconds",
+			Help: "Time from a ping to its pong per connection.", Buckets: latencyBuckets}, []string{"connection"}),
+		dispatch: f.NewHistogram(prometheus.HistogramOpts{Name: "bybit_handler_dispatch_seconds",
+			Help: "Time the handler takes to parse and apply a message and deliver its events.", Buckets: latencyBuckets}),
+		bookUpdates: f.NewCounterVec(prometheus.CounterOpts{Name: "bybit_book_updates_total",
+			Help: "Snapshots and deltas applied to the local book per symbol."}, []string{"symbol"}),
+		sequenceGaps: f.NewCounterVec(prometheus.CounterOpts{Name: "bybit_book_sequence_gaps_total",
+			Help: "Book deltas that did not follow the previous update ID, per symbol."}, []string{"symbol"}),
+		resyncs: f.NewCounterVec(prometheus.CounterOpts{Name: "bybit_book_resyncs_total",
+			Help: "Book resyncs from REST per symbol and result (ok or failed)."}, []string{"symbol", "result"}),
+		exchangeLatency: f.NewHistogramVec(prometheus.HistogramOpts{Name: "bybit_exchange_latency_seconds",
+			Help:    "Time from the exchange's ts to the receipt of a message, per topic. Includes the clock offset.",
+			Buckets: latencyBuckets}, []string{"topic"}),
+		matchingLatency: f.NewHistogramVec(prometheus.HistogramOpts{Name: "bybit_matching_latency_seconds",
+			Help:    "Time from the matching engine (cts or trade time) to the receipt of a message, per topic. Includes the clock offset.",
+			Buckets: latencyBuckets}, []string{"topic"}),
+		clockOffset: f.NewGauge(prometheus.GaugeOpts{Name: "bybit_clock_offset_seconds",
+			Help: "Local clock minus the exchange's, measured with server time requests."}),
+		clockError: f.NewGauge(prometheus.GaugeOpts{Name: "bybit_clock_offset_uncertainty_seconds",
+			Help: "Half the round trip of the server time request bybit_clock_offset_seconds was measured with."}),
+		minDelay: f.NewGauge(prometheus.GaugeOpts{Name: "bybit_min_message_delay_seconds",
+			Help: "Smallest receive time minus ts of recent messages: the fastest latency plus the clock offset."}),
+	}
+}
+
+// ServeHTTP serves the metrics of the registry
+func (c *Connector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.handler.ServeHTTP(w, r)
+}
+
+// Message records a message of a topic
+func (c *Connector) Message(topic string) {
+	if c == nil {
+		return
+	}
+	if topic == "" {
+		topic = "control"
+	}
+	c.messages.WithLabelValues(topic).Inc()
+}
+
+// Latency records the latencies of a parsed message of a topic. Unknown
+// times are skipped.
+func (c *Connector) Latency(topic string, ts market.Timestamps) {
+	if c == nil {
+		return
+	}
+	if !ts.ExchangeTime.IsZero() && !ts.ReceivedTime.IsZero() {
+		c.exchangeLatency.WithLabelValues(topic).Observe(ts.Latency().Seconds())
+	}
+	if !ts.MatchingTime.IsZero() && !ts.ReceivedTime.IsZero() {
+		c.matchingLatency.WithLabelValues(topic).Observe(ts.MatchingLatency().Seconds())
+	}
+}
+
+// ClockSkew records an estimate of the local clock against the exchange's.
+// The offset gauges are left alone until it is synced.
+func (c *Connector) ClockSkew(s market.Skew) {
+	if c == nil {
+		return
+	}
+	if s.Synced {
+		c.clockOffset.Set(s.Offset.Seconds())
+		c.clockError.Set(s.Uncertainty.Seconds())
+	}
+	c.minDelay.Set(s.MinDelay.Seconds())
+}
+
+// ParseError records a message the parser failed to decode, or a sequence
+// gap when err is market.ErrOrderBookGap
+func (c *Connector) ParseError(topic, symbol string, err error) {
+	if c == nil {
+		return
+	}
+	if errors.Is(err, market.ErrOrderBookGap) {
+		c.sequenceGaps.WithLabelValues(symbol).Inc()
+		return
+	}
+	if topic == "" {
+		topic = "unknown"
+	}
+	c.parseErrors.WithLabelValues(topic).Inc()
+}
+
+// Reconnect records a reconnect of a connection and why it was needed
+func (c *Connector) Reconnect(connection, reason string) {
+	if c == nil {
+		return
+	}
+	c.reconnects.WithLabelValues(connection, reason).Inc()
+}
+
+// Connected records the state of a connection
+func (c *Connector) Connected(connection string, up bool) {
+	if c == nil {
+		return
+	}
+	v := 0.0
+	if up {
+		v = 1
+	}
+	c.connected.WithLabelValues(connection).Set(v)
+}
+
+// PingRTT records the round trip time of a ping
+func (c *Connector) PingRTT(connection string, rtt time.Duration) {
+	if c == nil {
+		return
+	}
+	c.pingRTT.WithLabelValues(connection).Observe(rtt.Seconds())
+}
+
+// Dispatch records the time the handler spent on a message
+func (c *Connector) Dispatch(d time.Duration) {
+	if c == nil {
+		return
+	}
+	c.dispatch.Observe(d.Seconds())
+}
+
+// BookUpdate records an update of a symbol's local book
+func (c *Connector) BookUpdate(symbol string) {
+	if c == nil {
+		return
+	}
+	c.bookUpdates.WithLabelValues(symbol).Inc()
+}
+
+// Resync records a finished resync of a symbol's book, failed when err is set
+func (c *Connector) Resync(symbol string, err error) {
+	if c == nil {
+		return
+	}
+	result := "ok"
+	if err != nil {
+		result = "failed"
+	}
+	c.resyncs.WithLabelValues(symbol, result).Inc()
+}
@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"bybit_connector/pkg/market"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNilConnectorIsDisabled(t *testing.T) {
+	var c *Connector
+	c.Message("orderbook.50.BTCUSDT")
+	c.Latency("orderbook.50.BTCUSDT", market.Timestamps{ExchangeTime: time.UnixMilli(1), ReceivedTime: time.Now()})
+	c.ClockSkew(market.Skew{Synced: true})
+	c.ParseError("", "", fmt.Errorf("bad json"))
+	c.Reconnect("linear", "read_error")
+	c.Resync("BTCUSDT", nil)
+}
+
+func TestConnectorSeparatesGapsFromParseErrors(t *testing.T) {
+	c := NewConnector()
+	c.Message("orderbook.50.BTCUSDT")
+	c.Message("")
+	c.Latency("orderbook.50.BTCUSDT", market.Timestamps{
+		MatchingTime: time.UnixMilli(1699999999000),
+		ExchangeTime: time.UnixMilli(1700000000000),
+		ReceivedTime: time.UnixMilli(1700000000250),
+	})
+	c.ParseError("orderbook.50.BTCUSDT", "BTCUSDT", fmt.Errorf("apply: %w", market.ErrOrderBookGap))
+	c.ParseError("tickers.BTCUSDT", "BTCUSDT", fmt.Errorf("bad price"))
+
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	b := rec.Body
+	for _, line := range []string{
+		`bybit_ws_messages_total{topic="orderbook.50.BTCUSDT"} 1`,
+		`bybit_ws_messages_total{topic="control"} 1`,
+		`bybit_book_sequence_gaps_total{symbol="BTCUSDT"} 1`,
+		`bybit_parse_errors_total{topic="tickers.BTCUSDT"} 1`,
+		`bybit_exchange_latency_seconds_bucket{topic="orderbook.50.BTCUSDT",le="0.25"} 1`,
+		`bybit_exchange_latency_seconds_bucket{topic="orderbook.50.BTCUSDT",le="0.1"} 0`,
+		`bybit_matching_latency_seconds_bucket{topic="orderbook.50.BTCUSDT",le="1"} 0`,
+		`bybit_matching_latency_seconds_bucket{topic="orderbook.50.BTCUSDT",le="2.5"} 1`,
+	} {
+		if !strings.Contains(b.String(), line+"\n") {
+			t.Errorf("missing %s in:\n%s", line, b.String())
+		}
+	}
+	if strings.Contains(b.String(), `bybit_parse_errors_total{topic="orderbook.50.BTCUSDT"}`) {
+		t.Errorf("a sequence gap was counted as a parse error")
+	}
+}
@@ -0,0 +1,235 @@
+// Package ratelimit paces requests to stay within the Bybit v5 rate limits.
+// Buckets are grouped per limit group, so the REST client and the trade
+// WebSocket can share one per-UID budget.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is returned when a request cannot get a token in time,
+// or is low priority and would have to queue
+var ErrRateLimited = errors.New("rate limited")
+
+// Priority orders the requests queued on a bucket. The zero value is
+// PriorityNormal.
+type Priority int
+
+const (
+	// PriorityLow requests never queue: they fail with ErrRateLimited
+	// when no token is available right away
+	PriorityLow Priority = iota - 1
+	PriorityNormal
+	// PriorityHigh requests are served before queued normal ones
+	PriorityHigh
+)
+
+// Bucket is a token bucket with a priority queue of waiters. It is
+// calibrated from the limit headers Bybit sends with each response.
+type Bucket struct {
+	mu           sync.Mutex
+	rate         float64 // tokens per second
+	burst        float64
+	tokens       float64
+	last         time.Time
+	blockedUntil time.Time
+	waiters      []*waiter
+	timer        *time.Timer
+}
+
+type waiter struct {
+	priority Priority
+	ready    chan struct{}
+	granted  bool
+}
+
+// NewBucket creates a full bucket refilled at perSecond tokens per second
+// and holding at most burst tokens
+func NewBucket(perSecond float64, burst int) *Bucket {
+	if perSecond <= 0 {
+		perSecond = 1
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &Bucket{
+		rate:   perSecond,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait takes a token, queueing behind requests of the same or higher
+// priority. It fails early with ErrRateLimited when the context deadline
+// falls before the token would be available.
+func (b *Bucket) Wait(ctx context.Context, priority Priority) error {
+	b.mu.Lock()
+	now := time.Now()
+	b.refill(now)
+	if len(b.waiters) == 0 && !now.Before(b.blockedUntil) && b.tokens >= 1 {
+		b.tokens--
+		b.mu.Unlock()
+		return nil
+	}
+	if priority < PriorityNormal {
+		b.mu.Unlock()
+		return ErrRateLimited
+	}
+
+	w := &waiter{priority: priority, ready: make(chan struct{})}
+	pos := len(b.waiters)
+	for i, q := range b.waiters {
+		if q.priority < priority {
+			pos = i
+			break
+		}
+	}
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(now.Add(b.estimate(now, pos))) {
+		b.mu.Unlock()
+		return fmt.Errorf("%w: no capacity before deadline", ErrRateLimited)
+	}
+	b.waiters = append(b.waiters, nil)
+	copy(b.waiters[pos+1:], b.waiters[pos:])
+	b.waiters[pos] = w
+	b.dispatch(now)
+	b.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if w.granted {
+			// Granted while the context was cancelled: hand the token back
+			b.tokens++
+			b.dispatch(time.Now())
+		} else {
+			b.remove(w)
+		}
+		return ctx.Err()
+	}
+}
+
+// Calibrate aligns the bucket with the limit reported by the exchange:
+// limit requests per second, remaining of them left in the current window,
+// which ends at reset. Other processes sharing the UID are accounted for
+// because the exchange's count is authoritative.
+func (b *Bucket) Calibrate(limit, remaining int, reset time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.refill(now)
+	if limit > 0 {
+		b.rate = float64(limit)
+		b.burst = float64(limit)
+	}
+	if remaining >= 0 && float64(remaining) < b.tokens {
+		b.tokens = float64(remaining)
+	}
+	if remaining == 0 && reset.After(b.blockedUntil) {
+		b.blockedUntil = reset
+	}
+	b.dispatch(now)
+}
+
+// Penalize empties the bucket and holds every request until the given
+// time, after the exchange rejected a request for exceeding the limit
+func (b *Bucket) Penalize(until time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(time.Now())
+	b.tokens = 0
+	if until.After(b.blockedUntil) {
+		b.blockedUntil = until
+	}
+	b.dispatch(time.Now())
+}
+
+// Status returns the current budget of the bucket
+func (b *Bucket) Status() Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.refill(now)
+	s := Status{PerSecond: b.rate, Burst: int(b.burst), Remaining: b.tokens, Queued: len(b.waiters)}
+	if b.blockedUntil.After(now) {
+		s.BlockedUntil = b.blockedUntil
+	}
+	return s
+}
+
+// refill adds the tokens earned since the last refill.
+// The caller must hold the lock.
+func (b *Bucket) refill(now time.Time) {
+	if now.After(b.last) {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+}
+
+// estimate returns how long a waiter at position pos would wait.
+// The caller must hold the lock.
+func (b *Bucket) estimate(now time.Time, pos int) time.Duration {
+	var wait time.Duration
+	if b.blockedUntil.After(now) {
+		wait = b.blockedUntil.Sub(now)
+	}
+	if missing := float64(pos+1) - b.tokens; missing > 0 {
+		wait += time.Duration(missing / b.rate * float64(time.Second))
+	}
+	return wait
+}
+
+// dispatch grants tokens to queued waiters in order and arms a timer for
+// the next one. The caller must hold the lock.
+func (b *Bucket) dispatch(now time.Time) {
+	b.refill(now)
+	if now.Before(b.blockedUntil) {
+		b.arm(b.blockedUntil.Sub(now))
+		return
+	}
+	for len(b.waiters) > 0 && b.tokens >= 1 {
+		w := b.waiters[0]
+		b.waiters = b.waiters[1:]
+		b.tokens--
+		w.granted = true
+		close(w.ready)
+	}
+	if len(b.waiters) > 0 {
+		b.arm(time.Duration((1 - b.tokens) / b.rate * float64(time.Second)))
+	}
+}
+
+// arm schedules a dispatch unless one is already pending
+func (b *Bucket) arm(d time.Duration) {
+	if b.timer != nil {
+		return
+	}
+	b.timer = time.AfterFunc(d, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.timer = nil
+		b.dispatch(time.Now())
+	})
+}
+
+func (b *Bucket) remove(w *waiter) {
+	for i, q := range b.waiters {
+		if q == w {
+			b.waiters = append(b.waiters[:i], b.waiters[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit groups. Private endpoints are limited per UID and per endpoint;
+// public market data shares one per-IP budget.
+const (
+	GroupPublic      = "public"
+	GroupWSConnect   = "ws.connect"
+	GroupWSSubscribe = "ws.subscribe"
+)
+
+// Limit is the budget of a group
+type Limit struct {
+	PerSecond float64
+	Burst     int
+}
+
+// DefaultLimits are the documented v5 limits for a standard account. Groups
+// of private endpoints are named after their REST path.
+var DefaultLimits = map[string]Limit{
+	GroupPublic:                  {PerSecond: 120, Burst: 600}, // 600 requests per 5s per IP
+	GroupWSConnect:               {PerSecond: 500.0 / 300, Burst: 20},
+	GroupWSSubscribe:             {PerSecond: 10, Burst: 10},
+	"/v5/order/create":           {PerSecond: 10, Burst: 10},
+	"/v5/order/amend":            {PerSecond: 10, Burst: 10},
+	"/v5/order/cancel":           {PerSecond: 10, Burst: 10},
+	"/v5/order/cancel-all":       {PerSecond: 10, Burst: 10},
+	"/v5/order/create-batch":     {PerSecond: 10, Burst: 10},
+	"/v5/order/amend-batch":      {PerSecond: 10, Burst: 10},
+	"/v5/order/cancel-batch":     {PerSecond: 10, Burst: 10},
+	"/v5/order/realtime":         {PerSecond: 50, Burst: 50},
+	"/v5/order/history":          {PerSecond: 50, Burst: 50},
+	"/v5/execution/list":         {PerSecond: 50, Burst: 50},
+	"/v5/position/list":          {PerSecond: 50, Burst: 50},
+	"/v5/account/wallet-balance": {PerSecond: 50, Burst: 50},
+}
+
+// defaultPrivateLimit applies to private endpoints missing from DefaultLimits
+var defaultPrivateLimit = Limit{PerSecond: 10, Burst: 10}
+
+// wsOps maps trade WebSocket ops onto the REST groups they share a budget with
+var wsOps = map[string]string{
+	"order.create":       "/v5/order/create",
+	"order.amend":        "/v5/order/amend",
+	"order.cancel":       "/v5/order/cancel",
+	"order.create-batch": "/v5/order/create-batch",
+	"order.amend-batch":  "/v5/order/amend-batch",
+	"order.cancel-batch": "/v5/order/cancel-batch",
+}
+
+// Group returns the limit group of a REST path or trade WebSocket op
+func Group(pathOrOp string) string {
+	if g, ok := wsOps[pathOrOp]; ok {
+		return g
+	}
+	if strings.HasPrefix(pathOrOp, "/v5/market/") {
+		return GroupPublic
+	}
+	return pathOrOp
+}
+
+// Status is the budget left in a group
+type Status struct {
+	Group        string    `json:"group"`
+	PerSecond    float64   `json:"per_second"`
+	Burst        int       `json:"burst"`
+	Remaining    float64   `json:"remaining"`
+	Queued       int       `json:"queued"`
+	BlockedUntil time.Time `json:"blocked_until"`
+}
+
+// Limiter holds one bucket per limit group. Share a single Limiter between
+// every client using the same account and IP.
+type Limiter struct {
+	mu      sync.Mutex
+	limits  map[string]Limit
+	buckets map[string]*Bucket
+}
+
+// NewLimiter creates a limiter with DefaultLimits
+func NewLimiter() *Limiter {
+	l := &Limiter{
+		limits:  make(map[string]Limit, len(DefaultLimits)),
+		buckets: make(map[string]*Bucket),
+	}
+	for g, limit := range DefaultLimits {
+		l.limits[g] = limit
+	}
+	return l
+}
+
+// SetLimit overrides the budget of a group, for example for VIP accounts
+func (l *Limiter) SetLimit(group string, limit Limit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limits[group] = limit
+	l.buckets[group] = NewBucket(limit.PerSecond, limit.Burst)
+}
+
+// Bucket returns the bucket of a group, creating it on first use
+func (l *Limiter) Bucket(group string) *Bucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[group]
+	if !ok {
+		limit, ok := l.limits[group]
+		if !ok {
+			limit = defaultPrivateLimit
+		}
+		b = NewBucket(limit.PerSecond, limit.Burst)
+		l.buckets[group] = b
+	}
+	return b
+}
+
+// Wait takes a token from a group at the priority carried by the context
+func (l *Limiter) Wait(ctx context.Context, group string) error {
+	return l.Bucket(group).Wait(ctx, PriorityFrom(ctx))
+}
+
+// Observe calibrates a group from the X-Bapi-Limit, X-Bapi-Limit-Status
+// and X-Bapi-Limit-Reset-Timestamp response headers. Responses without
+// them are ignored.
+func (l *Limiter) Observe(group string, header http.Header) {
+	status := header.Get("X-Bapi-Limit-Status")
+	if status == "" {
+		return
+	}
+	remaining, err := strconv.Atoi(status)
+	if err != nil {
+		return
+	}
+	limit, _ := strconv.Atoi(header.Get("X-Bapi-Limit"))
+	var reset time.Time
+	if ms, err := strconv.ParseInt(header.Get("X-Bapi-Limit-Reset-Timestamp"), 10, 64); err == nil {
+		reset = time.UnixMilli(ms)
+	}
+	l.Bucket(group).Calibrate(limit, remaining, reset)
+}
+
+// Penalize holds a group until the given time, or for one second when it
+// is zero, after the exchange rejected a request for exceeding the limit
+func (l *Limiter) Penalize(group string, until time.Time) {
+	if until.IsZero() {
+		until = time.Now().Add(time.Second)
+	}
+	l.Bucket(group).Penalize(until)
+}
+
+// Remaining returns the tokens left in a group
+func (l *Limiter) Remaining(group string) float64 {
+	return l.Bucket(group).Status().Remaining
+}
+
+// Status returns the budget of every group used so far, sorted by group
+func (l *Limiter) Status() []Status {
+	l.mu.Lock()
+	groups := make([]string, 0, len(l.buckets))
+	for g := range l.buckets {
+		groups = append(groups, g)
+	}
+	l.mu.Unlock()
+	sort.Strings(groups)
+
+	statuses := make([]Status, 0, len(groups))
+	for _, g := range groups {
+		s := l.Bucket(g).Status()
+		s.Group = g
+		statuses = append(statuses, s)
+	}
+	return statuses
+}
+
+type priorityKey struct{}
+
+// WithPriority returns a context whose rate-limited requests use priority p
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// PriorityFrom returns the priority carried by a context, PriorityNormal by default
+func PriorityFrom(ctx context.Context) Priority {
+	if p, ok := ctx.Value(priorityKey{}).(Priority); ok {
+		return p
+	}
+	return PriorityNormal
+}
@@ -0,0 +1,96 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestBucketLowPriorityIsRejectedWhenEmpty(t *testing.T) {
+	b := NewBucket(1, 1)
+	if err := b.Wait(context.Background(), PriorityLow); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Wait(context.Background(), PriorityLow); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("expected ErrRateLimited, got %v", err)
+	}
+}
+
+func TestBucketServesHighPriorityFirst(t *testing.T) {
+	b := NewBucket(20, 1)
+	b.Wait(context.Background(), PriorityNormal)
+
+	order := make(chan Priority, 2)
+	started := make(chan struct{})
+	go func() {
+		close(started)
+		b.Wait(context.Background(), PriorityNormal)
+		order <- PriorityNormal
+	}()
+	<-started
+	for b.Status().Queued == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	go func() {
+		b.Wait(context.Background(), PriorityHigh)
+		order <- PriorityHigh
+	}()
+
+	if first := <-order; first != PriorityHigh {
+		t.Fatalf("expected the high priority request first, got %v", first)
+	}
+	<-order
+}
+
+func TestBucketFailsFastBeforeDeadline(t *testing.T) {
+	b := NewBucket(1, 1)
+	b.Wait(context.Background(), PriorityNormal)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := b.Wait(ctx, PriorityNormal); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("expected ErrRateLimited, got %v", err)
+	}
+	if time.Since(start) > 20*time.Millisecond {
+		t.Fatal("expected the request to fail without waiting")
+	}
+}
+
+func TestObserveCalibratesFromHeaders(t *testing.T) {
+	l := NewLimiter()
+	reset := time.Now().Add(200 * time.Millisecond)
+	header := http.Header{}
+	header.Set("X-Bapi-Limit", "20")
+	header.Set("X-Bapi-Limit-Status", "0")
+	header.Set("X-Bapi-Limit-Reset-Timestamp", strconv.FormatInt(reset.UnixMilli(), 10))
+	l.Observe("/v5/order/create", header)
+
+	s := l.Bucket("/v5/order/create").Status()
+	if s.PerSecond != 20 || s.Burst != 20 || s.BlockedUntil.IsZero() {
+		t.Fatalf("unexpected status: %+v", s)
+	}
+
+	start := time.Now()
+	if err := l.Wait(context.Background(), Group("order.create")); err != nil {
+		t.Fatal(err)
+	}
+	if waited := time.Since(start); waited < 150*time.Millisecond {
+		t.Fatalf("expected to wait for the reset, waited %v", waited)
+	}
+}
+
+func TestGroup(t *testing.T) {
+	for in, want := range map[string]string{
+		"/v5/market/orderbook": GroupPublic,
+		"order.cancel":         "/v5/order/cancel",
+		"/v5/order/cancel":     "/v5/order/cancel",
+	} {
+		if got := Group(in); got != want {
+			t.Errorf("Group(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
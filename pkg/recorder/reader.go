@@ -0,0 +1,48 @@
+package recorder
+
+import (
+	"bufio"
+	"bybit_connector/pkg/market"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Files returns the existing files of a stream for the days from start to
+// end, oldest first
+func Files(dir string, category market.Category, symbol, kind string, start, end time.Time) []string {
+	var files []string
+	day := start.UTC().Truncate(24 * time.Hour)
+	for !day.After(end) {
+		path := Path(dir, category, symbol, kind, day)
+		if _, err := os.Stat(path); err == nil {
+			files = append(files, path)
+		}
+		day = day.Add(24 * time.Hour)
+	}
+	return files
+}
+
+// ReadFile calls fn with each line of a recorded file until fn returns an error
+func ReadFile(path string, fn func(line []byte) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		if err := fn(scanner.Bytes()); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+// Package recorder stores market data as JSON lines, one file per
+// category, symbol, kind and UTC day:
+//
+//	<dir>/<category>/<symbol>/<kind>/2006-01-02.jsonl
+//
+// The live recorder and the backfill tool write the same layout, so
+// history and live capture can be read back as one stream.
+package recorder
+
+import (
+	"bufio"
+	"bybit_connector/pkg/market"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Kinds of recorded data. Each line holds the JSON of the market type.
+const (
+	KindTrades    = "trades"    // market.Trade
+	KindOrderBook = "orderbook" // market.OrderBook
+	KindTickers   = "tickers"   // market.Ticker
+	KindFunding   = "funding"   // market.FundingRate
+)
+
+// KlineKind returns the kind of exchange klines (market.Candle) of a Bybit interval
+func KlineKind(interval string) string {
+	return "kline_" + interval
+}
+
+// OpenInterestKind returns the kind of open interest (market.OpenInterest)
+// sampled at a Bybit intervalTime
+func OpenInterestKind(interval string) string {
+	return "open_interest_" + interval
+}
+
+// Path returns the file holding a day of records
+func Path(dir string, category market.Category, symbol, kind string, day time.Time) string {
+	return filepath.Join(dir, string(category), symbol, kind, day.UTC().Format("2006-01-02")+".jsonl")
+}
+
+// Writer appends records to their daily files. Files are opened on first
+// use and closed when their stream moves on to the next day.
+type Writer struct {
+	Dir string
+
+	mu      sync.Mutex
+	streams map[string]*stream
+}
+
+type stream struct {
+	path string
+	file *os.File
+	buf  *bufio.Writer
+}
+
+// NewWriter creates a writer storing under dir
+func NewWriter(dir string) *Writer {
+	return &Writer{Dir: dir, streams: make(map[string]*stream)}
+}
+
+// Write appends v as one JSON line to the file of the day of t
+func (w *Writer) Write(category market.Category, symbol, kind string, t time.Time, v interface{}) error {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s record: %w", kind, err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	key := string(category) + "/" + symbol + "/" + kind
+	path := Path(w.Dir, category, symbol, kind, t)
+	s, ok := w.streams[key]
+	if !ok || s.path != path {
+		if ok {
+			if err := s.close(); err != nil {
+				return err
+			}
+		}
+		if s, err = open(path); err != nil {
+			return err
+		}
+		w.streams[key] = s
+	}
+
+	s.buf.Write(line)
+	if err := s.buf.WriteByte('\n'); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// Flush writes the buffered records of every open file to disk
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, s := range w.streams {
+		if err := s.buf.Flush(); err != nil {
+			return fmt.Errorf("failed to write %s: %w", s.path, err)
+		}
+	}
+	return nil
+}
+
+// Close flushes and closes every open file
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var first error
+	for key, s := range w.streams {
+		if err := s.close(); err != nil && first == nil {
+			first = err
+		}
+		delete(w.streams, key)
+	}
+	return first
+}
+
+func open(path string) (*stream, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	return &stream{path: path, file: f, buf: bufio.NewWriter(f)}, nil
+}
+
+func (s *stream) close() error {
+	if err := s.buf.Flush(); err != nil {
+		s.file.Close()
+		return fmt.Errorf("failed to write %s: %w", s.path, err)
+	}
+	return s.file.Close()
+}
@@ -0,0 +1,44 @@
+package recorder
+
+import (
+	"bybit_connector/pkg/market"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestWriterSplitsFilesByDay(t *testing.T) {
+	dir := t.TempDir()
+	w := NewWriter(dir)
+
+	day1 := time.Date(2024, 1, 1, 23, 59, 0, 0, time.UTC)
+	day2 := day1.Add(2 * time.Minute)
+	for _, ts := range []time.Time{day1, day1, day2} {
+		trade := market.Trade{Symbol: "BTCUSDT", Price: 100, Time: ts}
+		if err := w.Write(market.CategoryLinear, "BTCUSDT", KindTrades, ts, trade); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files := Files(dir, market.CategoryLinear, "BTCUSDT", KindTrades, day1.Add(-48*time.Hour), day2)
+	if len(files) != 2 {
+		t.Fatalf("expected a file per day, got %v", files)
+	}
+	for i, want := range []int{2, 1} {
+		lines := 0
+		err := ReadFile(files[i], func(line []byte) error {
+			var trade market.Trade
+			lines++
+			return json.Unmarshal(line, &trade)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lines != want {
+			t.Fatalf("%s: expected %d lines, got %d", files[i], want, lines)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package rest
+
+import (
+	"context"
+	"net/url"
+)
+
+// Account endpoints (/v5/account/*)
+
+// CoinBalance is the balance of one coin in a wallet
+type CoinBalance struct {
+	Coin                string  `json:"coin"`
+	Equity              float64 `json:"equity"`
+	WalletBalance       float64 `json:"wallet_balance"`
+	Locked              float64 `json:"locked"`
+	UnrealisedPnl       float64 `json:"unrealised_pnl"`
+	CumRealisedPnl      float64 `json:"cum_realised_pnl"`
+	AvailableToWithdraw float64 `json:"available_to_withdraw"`
+}
+
+// WalletBalance is the balance of an account
+type WalletBalance struct {
+	AccountType           string        `json:"account_type"`
+	TotalEquity           float64       `json:"total_equity"`
+	TotalWalletBalance    float64       `json:"total_wallet_balance"`
+	TotalAvailableBalance float64       `json:"total_available_balance"`
+	Coins                 []CoinBalance `json:"coins"`
+}
+
+// GetWalletBalance fetches the balance of an account type such as "UNIFIED"
+func (c *Client) GetWalletBalance(ctx context.Context, accountType string) ([]WalletBalance, error) {
+	query := url.Values{}
+	query.Set("accountType", accountType)
+
+	var result struct {
+		List []struct {
+			AccountType           string `json:"accountType"`
+			TotalEquity           string `json:"totalEquity"`
+			TotalWalletBalance    string `json:"totalWalletBalance"`
+			TotalAvailableBalance string `json:"totalAvailableBalance"`
+			Coin                  []struct {
+				Coin                string `json:"coin"`
+				Equity              string `json:"equity"`
+				WalletBalance       string `json:"walletBalance"`
+				Locked              string `json:"locked"`
+				UnrealisedPnl       string `json:"unrealisedPnl"`
+				CumRealisedPnl      string `json:"cumRealisedPnl"`
+				AvailableToWithdraw string `json:"availableToWithdraw"`
+			} `json:"coin"`
+		} `json:"list"`
+	}
+	if err := c.Get(ctx, "/v5/account/wallet-balance", query, true, &result); err != nil {
+		return nil, err
+	}
+
+	balances := make([]WalletBalance, 0, len(result.List))
+	for _, w := range result.List {
+		balance := WalletBalance{
+			AccountType:           w.AccountType,
+			TotalEquity:           parseFloat(w.TotalEquity),
+			TotalWalletBalance:    parseFloat(w.TotalWalletBalance),
+			TotalAvailableBalance: parseFloat(w.TotalAvailableBalance),
+		}
+		for _, coin := range w.Coin {
+			balance.Coins = append(balance.Coins, CoinBalance{
+				Coin:                coin.Coin,
+				Equity:              parseFloat(coin.Equity),
+				WalletBalance:       parseFloat(coin.WalletBalance),
+				Locked:              parseFloat(coin.Locked),
+				UnrealisedPnl:       parseFloat(coin.UnrealisedPnl),
+				CumRealisedPnl:      parseFloat(coin.CumRealisedPnl),
+				AvailableToWithdraw: parseFloat(coin.AvailableToWithdraw),
+			})
+		}
+		balances = append(balances, balance)
+	}
+	return balances, nil
+}
@@ -0,0 +1,276 @@
+// Package rest implements a client for the Bybit v5 REST API
+package rest
+
+import (
+	"bybit_connector/internal/config"
+	"bybit_connector/pkg/market"
+	"bybit_connector/pkg/ratelimit"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const defaultRecvWindow = 5 * time.Second
+
+// Client is a Bybit v5 REST client. Public endpoints work without
+// credentials; private ones are signed with HMAC-SHA256.
+type Client struct {
+	BaseURL    string
+	APIKey     string
+	APISecret  string
+	RecvWindow time.Duration
+	HTTPClient *http.Client
+	// Instruments, when set, validates orders against the trading rules
+	// of their symbol before they are sent
+	Instruments InstrumentSource
+	// Limiter, when set, paces requests per limit group and is calibrated
+	// from the rate limit headers of each response. Share it with the
+	// trade WebSocket client so both draw from the same budget.
+	Limiter *ratelimit.Limiter
+
+	// now returns the time used to stamp signed requests
+	now func() time.Time
+	// credMu guards APIKey and APISecret against SetCredentials
+	credMu sync.RWMutex
+}
+
+// NewClient creates a REST client from the connector configuration
+func NewClient(conf *config.Config) *Client {
+	c := &Client{
+		BaseURL:    conf.BybitRESTBaseURL,
+		APIKey:     conf.BybitAPIKey,
+		APISecret:  conf.BybitAPISecret,
+		RecvWindow: time.Duration(conf.RecvWindow) * time.Millisecond,
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+		Limiter:    ratelimit.NewLimiter(),
+		now:        time.Now,
+	}
+	if c.BaseURL == "" {
+		c.BaseURL = conf.Endpoints().REST()
+	}
+	if c.RecvWindow <= 0 {
+		c.RecvWindow = defaultRecvWindow
+	}
+	return c
+}
+
+// SetCredentials replaces the API key pair, e.g. after a key rotation.
+// Requests already signed keep the old key.
+func (c *Client) SetCredentials(apiKey, apiSecret string) {
+	c.credMu.Lock()
+	defer c.credMu.Unlock()
+	c.APIKey = apiKey
+	c.APISecret = apiSecret
+}
+
+func (c *Client) credentials() (string, string) {
+	c.credMu.RLock()
+	defer c.credMu.RUnlock()
+	return c.APIKey, c.APISecret
+}
+
+// APIError is returned when Bybit answers with a non-zero retCode
+type APIError struct {
+	Code    int
+	Message string
+	Method  string
+	Path    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("bybit %s %s: retCode %d: %s", e.Method, e.Path, e.Code, e.Message)
+}
+
+// RateLimited reports whether the request was rejected for exceeding a
+// rate limit (10006 per UID, 10018 per IP)
+func (e *APIError) RateLimited() bool {
+	return e.Code == 10006 || e.Code == 10018
+}
+
+// HTTPError is returned when the response status is not 200 and the body
+// is not a v5 response
+type HTTPError struct {
+	StatusCode int
+	Body       string
+	Method     string
+	Path       string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("bybit %s %s: http status %d: %s", e.Method, e.Path, e.StatusCode, e.Body)
+}
+
+// response is the envelope of every v5 response
+type response struct {
+	RetCode    int             `json:"retCode"`
+	RetMsg     string          `json:"retMsg"`
+	Result     json.RawMessage `json:"result"`
+	RetExtInfo json.RawMessage `json:"retExtInfo"`
+	Time       int64           `json:"time"`
+}
+
+// InstrumentSource looks up the trading rules of a symbol
+type InstrumentSource interface {
+	Instrument(category market.Category, symbol string) (market.Instrument, bool)
+}
+
+// Get sends a GET request and decodes the result into out
+func (c *Client) Get(ctx context.Context, path string, query url.Values, signed bool, out interface{}) error {
+	return c.do(ctx, http.MethodGet, path, query.Encode(), nil, signed, out, nil)
+}
+
+// Post sends a signed POST request with a JSON body and decodes the result into out
+func (c *Client) Post(ctx context.Context, path string, body interface{}, out interface{}) error {
+	return c.post(ctx, path, body, out, nil)
+}
+
+// post is Post that also decodes retExtInfo into ext
+func (c *Client) post(ctx context.Context, path string, body, out, ext interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request body: %w", err)
+	}
+	return c.do(ctx, http.MethodPost, path, "", payload, true, out, ext)
+}
+
+func (c *Client) do(ctx context.Context, method, path, query string, body []byte, signed bool, out, ext interface{}) error {
+	endpoint := c.BaseURL + path
+	if query != "" {
+		endpoint += "?" + query
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	var apiKey, apiSecret string
+	if signed {
+		apiKey, apiSecret = c.credentials()
+		if apiKey == "" || apiSecret == "" {
+			return fmt.Errorf("bybit %s %s: api credentials are required", method, path)
+		}
+	}
+
+	group := ratelimit.Group(path)
+	if c.Limiter != nil {
+		if err := c.Limiter.Wait(ctx, group); err != nil {
+			return fmt.Errorf("bybit %s %s: %w", method, path, err)
+		}
+	}
+
+	// Sign after the wait, so that time spent in the limiter does not count
+	// against the recv window
+	if signed {
+		payload := query
+		if method == http.MethodPost {
+			payload = string(body)
+		}
+		c.sign(req.Header, apiKey, apiSecret, payload)
+	}
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("bybit %s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+	if c.Limiter != nil {
+		c.Limiter.Observe(group, resp.Header)
+	}
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("bybit %s %s: failed to read response: %w", method, path, err)
+	}
+
+	var r response
+	if err := json.Unmarshal(raw, &r); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return &HTTPError{StatusCode: resp.StatusCode, Body: string(raw), Method: method, Path: path}
+		}
+		return fmt.Errorf("bybit %s %s: failed to decode response: %w", method, path, err)
+	}
+	if r.RetCode != 0 {
+		apiErr := &APIError{Code: r.RetCode, Message: r.RetMsg, Method: method, Path: path}
+		if apiErr.RateLimited() && c.Limiter != nil {
+			c.Limiter.Penalize(group, parseMillis(resp.Header.Get("X-Bapi-Limit-Reset-Timestamp")))
+		}
+		return apiErr
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &HTTPError{StatusCode: resp.StatusCode, Body: string(raw), Method: method, Path: path}
+	}
+
+	if ext != nil && len(r.RetExtInfo) > 0 {
+		if err := json.Unmarshal(r.RetExtInfo, ext); err != nil {
+			return fmt.Errorf("bybit %s %s: failed to decode retExtInfo: %w", method, path, err)
+		}
+	}
+	if out == nil || len(r.Result) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(r.Result, out); err != nil {
+		return fmt.Errorf("bybit %s %s: failed to decode result: %w", method, path, err)
+	}
+	return nil
+}
+
+// sign adds the X-BAPI-* authentication headers. The signature covers
+// timestamp + api key + recv window + payload, where the payload is the
+// query string of a GET or the JSON body of a POST.
+func (c *Client) sign(header http.Header, apiKey, apiSecret, payload string) {
+	timestamp := strconv.FormatInt(c.clock().UnixMilli(), 10)
+	recvWindow := strconv.FormatInt(c.RecvWindow.Milliseconds(), 10)
+
+	h := hmac.New(sha256.New, []byte(apiSecret))
+	h.Write([]byte(timestamp + apiKey + recvWindow + payload))
+
+	header.Set("X-BAPI-API-KEY", apiKey)
+	header.Set("X-BAPI-TIMESTAMP", timestamp)
+	header.Set("X-BAPI-RECV-WINDOW", recvWindow)
+	header.Set("X-BAPI-SIGN", hex.EncodeToString(h.Sum(nil)))
+	header.Set("X-BAPI-SIGN-TYPE", "2")
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return c.HTTPClient
+}
+
+func (c *Client) clock() time.Time {
+	if c.now == nil {
+		return time.Now()
+	}
+	return c.now()
+}
+
+// parseFloat converts a Bybit decimal string. Bybit sends "" for unset
+// values, which is read as zero.
+func parseFloat(s string) float64 {
+	v, _ := strconv.ParseFloat(s, 64)
+	return v
+}
+
+// parseMillis converts a Bybit millisecond timestamp string
+func parseMillis(s string) time.Time {
+	ms, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || ms == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
@@ -0,0 +1,221 @@
+package rest
+
+import (
+	"bybit_connector/internal/config"
+	"bybit_connector/pkg/market"
+	"bybit_connector/pkg/ratelimit"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// newTestClient starts a local stand-in for the Bybit API
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	c := NewClient(&config.Config{
+		BybitRESTBaseURL: server.URL,
+		BybitAPIKey:      "key",
+		BybitAPISecret:   "secret",
+		RecvWindow:       5000,
+	})
+	c.now = func() time.Time { return time.UnixMilli(1700000000000) }
+	return c
+}
+
+func expectedSignature(payload string) string {
+	h := hmac.New(sha256.New, []byte("secret"))
+	h.Write([]byte("1700000000000" + "key" + "5000" + payload))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func TestSignedGet(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v5/position/list" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if got := r.Header.Get("X-BAPI-SIGN"); got != expectedSignature(r.URL.RawQuery) {
+			t.Errorf("unexpected signature %s", got)
+		}
+		if r.Header.Get("X-BAPI-API-KEY") != "key" || r.Header.Get("X-BAPI-RECV-WINDOW") != "5000" {
+			t.Errorf("missing auth headers: %v", r.Header)
+		}
+		io.WriteString(w, `{"retCode":0,"retMsg":"OK","result":{"list":[{"symbol":"BTCUSDT","side":"Buy","size":"0.5","avgPrice":"30000","leverage":"10","seq":7}]}}`)
+	})
+
+	positions, err := c.GetPositions(context.Background(), market.CategoryLinear, "BTCUSDT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(positions) != 1 || positions[0].Size != 0.5 || positions[0].EntryPrice != 30000 || positions[0].PositionSeq != 7 {
+		t.Fatalf("unexpected positions: %+v", positions)
+	}
+}
+
+func TestSignedPost(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if got := r.Header.Get("X-BAPI-SIGN"); got != expectedSignature(string(body)) {
+			t.Errorf("unexpected signature %s for body %s", got, body)
+		}
+		io.WriteString(w, `{"retCode":0,"retMsg":"OK","result":{}}`)
+	})
+
+	if err := c.Post(context.Background(), "/v5/order/cancel-all", map[string]string{"category": "linear"}, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"retCode":10001,"retMsg":"params error","result":{}}`)
+	})
+
+	_, err := c.GetTickers(context.Background(), market.CategorySpot, "BTCUSDT")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != 10001 || apiErr.Message != "params error" {
+		t.Fatalf("expected an APIError, got %v", err)
+	}
+}
+
+func TestHTTPError(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+	})
+
+	_, err := c.GetServerTime(context.Background())
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected an HTTPError, got %v", err)
+	}
+}
+
+func TestSignedRequestRequiresCredentials(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request should not be sent")
+	})
+	c.APISecret = ""
+
+	if _, err := c.GetOpenOrders(context.Background(), market.CategorySpot, ""); err == nil {
+		t.Fatal("expected an error without credentials")
+	}
+}
+
+func TestGetOrderBookAndKlines(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-BAPI-SIGN") != "" {
+			t.Error("public endpoints must not be signed")
+		}
+		switch r.URL.Path {
+		case "/v5/market/orderbook":
+			io.WriteString(w, `{"retCode":0,"retMsg":"OK","result":{"s":"BTCUSDT","b":[["99","1"],["100","2"]],"a":[["102","1"],["101","3"]],"ts":1700000000000,"u":42,"seq":9}}`)
+		case "/v5/market/kline":
+			io.WriteString(w, `{"retCode":0,"retMsg":"OK","result":{"symbol":"BTCUSDT","list":[`+
+				`["1700000000000","2","3","1","2.5","10","25"],`+
+				`["1699999940000","1","2","1","2","5","10"]]}}`)
+		}
+	})
+
+	snap, err := c.GetOrderBook(context.Background(), market.CategoryLinear, "BTCUSDT", 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.UpdateID != 42 || snap.Book.Bids[0].Price != 100 || snap.Book.Asks[0].Price != 101 {
+		t.Fatalf("unexpected snapshot: %+v", snap.Book)
+	}
+
+	candles, err := c.GetKlines(context.Background(), market.CategoryLinear, "BTCUSDT", "1", time.Time{}, time.Time{}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candles) != 2 || !candles[0].Start.Before(candles[1].Start) {
+		t.Fatalf("expected candles oldest first: %+v", candles)
+	}
+	if !candles[0].Closed || candles[1].Closed {
+		t.Fatalf("unexpected closed flags: %+v", candles)
+	}
+}
+
+func TestRateLimitedResponsePenalizesGroup(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Bapi-Limit", "10")
+		w.Header().Set("X-Bapi-Limit-Status", "0")
+		w.Header().Set("X-Bapi-Limit-Reset-Timestamp", strconv.FormatInt(time.Now().Add(time.Minute).UnixMilli(), 10))
+		io.WriteString(w, `{"retCode":10006,"retMsg":"Too many visits!","result":{}}`)
+	})
+
+	_, err := c.CancelAll(context.Background(), CancelAllRequest{Category: market.CategoryLinear, Symbol: "BTCUSDT"})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || !apiErr.RateLimited() {
+		t.Fatalf("expected a rate limit APIError, got %v", err)
+	}
+	if s := c.Limiter.Bucket("/v5/order/cancel-all").Status(); s.BlockedUntil.IsZero() || s.Remaining >= 1 {
+		t.Fatalf("expected the group to be blocked, got %+v", s)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := c.CancelAll(ctx, CancelAllRequest{Category: market.CategoryLinear, Symbol: "BTCUSDT"}); err == nil {
+		t.Fatal("expected the next request to be held by the limiter")
+	}
+}
+
+func TestSignedRequestStampedAfterLimiterWait(t *testing.T) {
+	var stamps []int64
+	var received []time.Time
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		ts, _ := strconv.ParseInt(r.Header.Get("X-BAPI-TIMESTAMP"), 10, 64)
+		stamps = append(stamps, ts)
+		received = append(received, time.Now())
+		io.WriteString(w, `{"retCode":0,"retMsg":"OK","result":{"list":[]}}`)
+	})
+	c.now = nil
+	// One token, refilled after 300ms
+	c.Limiter.SetLimit("/v5/position/list", ratelimit.Limit{PerSecond: 1.0 / 0.3, Burst: 1})
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.GetPositions(context.Background(), market.CategoryLinear, "BTCUSDT"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(stamps) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(stamps))
+	}
+	if wait := received[1].Sub(received[0]); wait < 200*time.Millisecond {
+		t.Fatalf("expected the limiter to hold the second request, it waited %v", wait)
+	}
+	// The second request is stamped when it is sent, not when it was queued
+	if lag := received[1].Sub(time.UnixMilli(stamps[1])); lag < -time.Millisecond || lag > 100*time.Millisecond {
+		t.Fatalf("timestamp %d is %v before the send time", stamps[1], lag)
+	}
+}
+
+func TestGetOpenInterestFollowsCursor(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("cursor") == "" {
+			io.WriteString(w, `{"retCode":0,"retMsg":"OK","result":{"symbol":"BTCUSDT","list":[`+
+				`{"openInterest":"3","timestamp":"1700000600000"},{"openInterest":"2","timestamp":"1700000300000"}],"nextPageCursor":"p2"}}`)
+			return
+		}
+		io.WriteString(w, `{"retCode":0,"retMsg":"OK","result":{"symbol":"BTCUSDT","list":[`+
+			`{"openInterest":"1","timestamp":"1700000000000"}],"nextPageCursor":""}}`)
+	})
+
+	values, err := c.GetOpenInterest(context.Background(), market.CategoryLinear, "BTCUSDT", "5min", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 3 || values[0].Value != 1 || values[2].Value != 3 || values[0].Interval != 5*time.Minute {
+		t.Fatalf("expected three samples oldest first: %+v", values)
+	}
+}
@@ -0,0 +1,82 @@
+package rest
+
+import (
+	"bybit_connector/pkg/market"
+	"context"
+	"net/url"
+)
+
+// GetInstruments fetches the trading rules of every instrument of a
+// category from /v5/market/instruments-info, following the page cursor.
+// It can be used as a market.InstrumentLoader.
+func (c *Client) GetInstruments(ctx context.Context, category market.Category) ([]market.Instrument, error) {
+	var instruments []market.Instrument
+	cursor := ""
+	for {
+		query := url.Values{}
+		query.Set("category", string(category))
+		query.Set("limit", "1000")
+		if cursor != "" {
+			query.Set("cursor", cursor)
+		}
+
+		var result struct {
+			List []struct {
+				Symbol      string `json:"symbol"`
+				Status      string `json:"status"`
+				BaseCoin    string `json:"baseCoin"`
+				QuoteCoin   string `json:"quoteCoin"`
+				PriceFilter struct {
+					MinPrice string `json:"minPrice"`
+					MaxPrice string `json:"maxPrice"`
+					TickSize string `json:"tickSize"`
+				} `json:"priceFilter"`
+				LotSizeFilter struct {
+					BasePrecision    string `json:"basePrecision"`
+					QtyStep          string `json:"qtyStep"`
+					MinOrderQty      string `json:"minOrderQty"`
+					MaxOrderQty      string `json:"maxOrderQty"`
+					MinOrderAmt      string `json:"minOrderAmt"`
+					MinNotionalValue string `json:"minNotionalValue"`
+				} `json:"lotSizeFilter"`
+			} `json:"list"`
+			NextPageCursor string `json:"nextPageCursor"`
+		}
+		if err := c.Get(ctx, "/v5/market/instruments-info", query, false, &result); err != nil {
+			return nil, err
+		}
+
+		for _, i := range result.List {
+			// Spot names its qty step basePrecision and its minimum order
+			// value minOrderAmt; derivatives use qtyStep and minNotionalValue
+			qtyStep := i.LotSizeFilter.QtyStep
+			if qtyStep == "" {
+				qtyStep = i.LotSizeFilter.BasePrecision
+			}
+			minNotional := i.LotSizeFilter.MinNotionalValue
+			if minNotional == "" {
+				minNotional = i.LotSizeFilter.MinOrderAmt
+			}
+
+			instruments = append(instruments, market.Instrument{
+				Symbol:      i.Symbol,
+				Category:    category,
+				Status:      i.Status,
+				BaseCoin:    i.BaseCoin,
+				QuoteCoin:   i.QuoteCoin,
+				TickSize:    parseFloat(i.PriceFilter.TickSize),
+				MinPrice:    parseFloat(i.PriceFilter.MinPrice),
+				MaxPrice:    parseFloat(i.PriceFilter.MaxPrice),
+				QtyStep:     parseFloat(qtyStep),
+				MinQty:      parseFloat(i.LotSizeFilter.MinOrderQty),
+				MaxQty:      parseFloat(i.LotSizeFilter.MaxOrderQty),
+				MinNotional: parseFloat(minNotional),
+			})
+		}
+
+		if result.NextPageCursor == "" || len(result.List) == 0 {
+			return instruments, nil
+		}
+		cursor = result.NextPageCursor
+	}
+}
@@ -0,0 +1,327 @@
+package rest
+
+import (
+	"bybit_connector/pkg/market"
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Market data endpoints (/v5/market/*). None of them need credentials.
+
+// GetServerTime returns the exchange time
+func (c *Client) GetServerTime(ctx context.Context) (time.Time, error) {
+	var result struct {
+		TimeNano string `json:"timeNano"`
+	}
+	if err := c.Get(ctx, "/v5/market/time", nil, false, &result); err != nil {
+		return time.Time{}, err
+	}
+	ns, err := strconv.ParseInt(result.TimeNano, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid server time %q: %w", result.TimeNano, err)
+	}
+	return time.Unix(0, ns), nil
+}
+
+// OrderBookSnapshot is an order book fetched from /v5/market/orderbook
+type OrderBookSnapshot struct {
+	Symbol   string
+	Book     *market.OrderBook
+	UpdateID int64
+	Seq      int64
+}
+
+// GetOrderBook fetches an order book snapshot with up to limit levels per side
+func (c *Client) GetOrderBook(ctx context.Context, category market.Category, symbol string, limit int) (*OrderBookSnapshot, error) {
+	query := url.Values{}
+	query.Set("category", string(category))
+	query.Set("symbol", symbol)
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	var result struct {
+		S   string     `json:"s"`
+		B   [][]string `json:"b"`
+		A   [][]string `json:"a"`
+		Ts  int64      `json:"ts"`
+		U   int64      `json:"u"`
+		Seq int64      `json:"seq"`
+	}
+	if err := c.Get(ctx, "/v5/market/orderbook", query, false, &result); err != nil {
+		return nil, err
+	}
+
+	ob := &market.OrderBook{
+		Bids:      levels(result.B),
+		Asks:      levels(result.A),
+		Timestamp: time.UnixMilli(result.Ts),
+	}
+	sort.Slice(ob.Bids, func(i, j int) bool { return ob.Bids[i].Price > ob.Bids[j].Price })
+	sort.Slice(ob.Asks, func(i, j int) bool { return ob.Asks[i].Price < ob.Asks[j].Price })
+
+	return &OrderBookSnapshot{Symbol: result.S, Book: ob, UpdateID: result.U, Seq: result.Seq}, nil
+}
+
+// GetTickers fetches the tickers of a category, or of a single symbol
+func (c *Client) GetTickers(ctx context.Context, category market.Category, symbol string) ([]market.Ticker, error) {
+	query := url.Values{}
+	query.Set("category", string(category))
+	if symbol != "" {
+		query.Set("symbol", symbol)
+	}
+
+	var result struct {
+		List []struct {
+			Symbol    string `json:"symbol"`
+			LastPrice string `json:"lastPrice"`
+			Bid1Price string `json:"bid1Price"`
+			Bid1Size  string `json:"bid1Size"`
+			Ask1Price string `json:"ask1Price"`
+			Ask1Size  string `json:"ask1Size"`
+		} `json:"list"`
+	}
+	if err := c.Get(ctx, "/v5/market/tickers", query, false, &result); err != nil {
+		return nil, err
+	}
+
+	now := c.clock()
+	tickers := make([]market.Ticker, 0, len(result.List))
+	for _, t := range result.List {
+		tickers = append(tickers, market.Ticker{
+			Symbol:    t.Symbol,
+			Bid:       parseFloat(t.Bid1Price),
+			BidSize:   parseFloat(t.Bid1Size),
+			Ask:       parseFloat(t.Ask1Price),
+			AskSize:   parseFloat(t.Ask1Size),
+			LastPrice: parseFloat(t.LastPrice),
+			Time:      now,
+		})
+	}
+	return tickers, nil
+}
+
+// GetRecentTrades fetches the most recent public trades of a symbol
+func (c *Client) GetRecentTrades(ctx context.Context, category market.Category, symbol string, limit int) ([]market.Trade, error) {
+	query := url.Values{}
+	query.Set("category", string(category))
+	query.Set("symbol", symbol)
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	var result struct {
+		List []struct {
+			ExecID       string `json:"execId"`
+			Symbol       string `json:"symbol"`
+			Price        string `json:"price"`
+			Size         string `json:"size"`
+			Side         string `json:"side"`
+			Time         string `json:"time"`
+			IsBlockTrade bool   `json:"isBlockTrade"`
+		} `json:"list"`
+	}
+	if err := c.Get(ctx, "/v5/market/recent-trade", query, false, &result); err != nil {
+		return nil, err
+	}
+
+	trades := make([]market.Trade, 0, len(result.List))
+	for _, t := range result.List {
+		trades = append(trades, market.Trade{
+			Time:         parseMillis(t.Time),
+			TradeTimeMs:  t.Time,
+			Symbol:       t.Symbol,
+			Side:         t.Side,
+			Size:         parseFloat(t.Size),
+			Price:        parseFloat(t.Price),
+			TradeId:      t.ExecID,
+			IsBlockTrade: t.IsBlockTrade,
+		})
+	}
+	return trades, nil
+}
+
+// GetKlines fetches closed and in-progress klines between start and end.
+// Bybit returns them newest first; they are returned oldest first.
+func (c *Client) GetKlines(ctx context.Context, category market.Category, symbol, interval string, start, end time.Time, limit int) ([]market.Candle, error) {
+	d, err := market.KlineInterval(interval)
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	query.Set("category", string(category))
+	query.Set("symbol", symbol)
+	query.Set("interval", interval)
+	if !start.IsZero() {
+		query.Set("start", strconv.FormatInt(start.UnixMilli(), 10))
+	}
+	if !end.IsZero() {
+		query.Set("end", strconv.FormatInt(end.UnixMilli(), 10))
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	var result struct {
+		Symbol string     `json:"symbol"`
+		List   [][]string `json:"list"`
+	}
+	if err := c.Get(ctx, "/v5/market/kline", query, false, &result); err != nil {
+		return nil, err
+	}
+
+	now := c.clock()
+	candles := make([]market.Candle, 0, len(result.List))
+	for i := len(result.List) - 1; i >= 0; i-- {
+		k := result.List[i]
+		if len(k) < 7 {
+			return nil, fmt.Errorf("invalid kline entry: %v", k)
+		}
+		candle := market.Candle{
+			Symbol:   symbol,
+			Interval: d,
+			Start:    parseMillis(k[0]),
+			Open:     parseFloat(k[1]),
+			High:     parseFloat(k[2]),
+			Low:      parseFloat(k[3]),
+			Close:    parseFloat(k[4]),
+			Volume:   parseFloat(k[5]),
+			Turnover: parseFloat(k[6]),
+			Exchange: true,
+		}
+		candle.Closed = !candle.End().After(now)
+		candles = append(candles, candle)
+	}
+	return candles, nil
+}
+
+// GetFundingHistory fetches the funding rates settled between start and
+// end, oldest first. Bybit returns at most limit (200) rates, the newest ones.
+func (c *Client) GetFundingHistory(ctx context.Context, category market.Category, symbol string, start, end time.Time, limit int) ([]market.FundingRate, error) {
+	query := url.Values{}
+	query.Set("category", string(category))
+	query.Set("symbol", symbol)
+	if !start.IsZero() {
+		query.Set("startTime", strconv.FormatInt(start.UnixMilli(), 10))
+	}
+	if !end.IsZero() {
+		query.Set("endTime", strconv.FormatInt(end.UnixMilli(), 10))
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	var result struct {
+		List []struct {
+			Symbol               string `json:"symbol"`
+			FundingRate          string `json:"fundingRate"`
+			FundingRateTimestamp string `json:"fundingRateTimestamp"`
+		} `json:"list"`
+	}
+	if err := c.Get(ctx, "/v5/market/funding/history", query, false, &result); err != nil {
+		return nil, err
+	}
+
+	rates := make([]market.FundingRate, 0, len(result.List))
+	for i := len(result.List) - 1; i >= 0; i-- {
+		f := result.List[i]
+		rates = append(rates, market.FundingRate{
+			Symbol: f.Symbol,
+			Rate:   parseFloat(f.FundingRate),
+			Time:   parseMillis(f.FundingRateTimestamp),
+		})
+	}
+	return rates, nil
+}
+
+// OpenInterestIntervals maps the intervalTime values of
+// /v5/market/open-interest to their length
+var OpenInterestIntervals = map[string]time.Duration{
+	"5min":  5 * time.Minute,
+	"15min": 15 * time.Minute,
+	"30min": 30 * time.Minute,
+	"1h":    time.Hour,
+	"4h":    4 * time.Hour,
+	"1d":    24 * time.Hour,
+}
+
+// GetOpenInterest fetches the open interest between start and end, oldest
+// first, following the cursor pagination
+func (c *Client) GetOpenInterest(ctx context.Context, category market.Category, symbol, interval string, start, end time.Time) ([]market.OpenInterest, error) {
+	d, ok := OpenInterestIntervals[interval]
+	if !ok {
+		return nil, fmt.Errorf("invalid open interest interval %q", interval)
+	}
+
+	query := url.Values{}
+	query.Set("category", string(category))
+	query.Set("symbol", symbol)
+	query.Set("intervalTime", interval)
+	query.Set("limit", "200")
+	if !start.IsZero() {
+		query.Set("startTime", strconv.FormatInt(start.UnixMilli(), 10))
+	}
+	if !end.IsZero() {
+		query.Set("endTime", strconv.FormatInt(end.UnixMilli(), 10))
+	}
+
+	var values []market.OpenInterest
+	for {
+		var result struct {
+			Symbol string `json:"symbol"`
+			List   []struct {
+				OpenInterest string `json:"openInterest"`
+				Timestamp    string `json:"timestamp"`
+			} `json:"list"`
+			NextPageCursor string `json:"nextPageCursor"`
+		}
+		if err := c.Get(ctx, "/v5/market/open-interest", query, false, &result); err != nil {
+			return nil, err
+		}
+		for _, oi := range result.List {
+			values = append(values, market.OpenInterest{
+				Symbol:   symbol,
+				Interval: d,
+				Value:    parseFloat(oi.OpenInterest),
+				Time:     parseMillis(oi.Timestamp),
+			})
+		}
+		if result.NextPageCursor == "" || len(result.List) == 0 {
+			break
+		}
+		query.Set("cursor", result.NextPageCursor)
+	}
+
+	sort.Slice(values, func(i, j int) bool { return values[i].Time.Before(values[j].Time) })
+	return values, nil
+}
+
+// levels converts [price, size] pairs into order book items
+func levels(raw [][]string) []market.Item {
+	items := make([]market.Item, 0, len(raw))
+	for _, l := range raw {
+		if len(l) < 2 {
+			continue
+		}
+		items = append(items, market.Item{Price: parseFloat(l[0]), Amount: parseFloat(l[1])})
+	}
+	return items
+}
+
+// SnapshotFetcher returns a fetcher reseeding local books from
+// /v5/market/orderbook with up to limit levels per side. Bybit's REST
+// update ID matches the WebSocket stream of the same depth.
+func (c *Client) SnapshotFetcher(category market.Category, limit int) market.SnapshotFetcher {
+	return func(ctx context.Context, symbol string) (*market.OrderBook, int64, error) {
+		snap, err := c.GetOrderBook(ctx, category, symbol, limit)
+		if err != nil {
+			return nil, 0, err
+		}
+		return snap.Book, snap.UpdateID, nil
+	}
+}
@@ -0,0 +1,149 @@
+package rest
+
+import (
+	"bybit_connector/pkg/exucution"
+	"bybit_connector/pkg/market"
+	"context"
+	"net/url"
+	"strconv"
+)
+
+// Trade endpoints (/v5/order/*, /v5/execution/*)
+
+// orderResult is an order as returned by the v5 order endpoints
+type orderResult struct {
+	OrderID        string `json:"orderId"`
+	OrderLinkID    string `json:"orderLinkId"`
+	Symbol         string `json:"symbol"`
+	Side           string `json:"side"`
+	OrderType      string `json:"orderType"`
+	Price          string `json:"price"`
+	Qty            string `json:"qty"`
+	TimeInForce    string `json:"timeInForce"`
+	CreateType     string `json:"createType"`
+	CancelType     string `json:"cancelType"`
+	OrderStatus    string `json:"orderStatus"`
+	LeavesQty      string `json:"leavesQty"`
+	CumExecQty     string `json:"cumExecQty"`
+	CumExecValue   string `json:"cumExecValue"`
+	CumExecFee     string `json:"cumExecFee"`
+	AvgPrice       string `json:"avgPrice"`
+	TakeProfit     string `json:"takeProfit"`
+	StopLoss       string `json:"stopLoss"`
+	ReduceOnly     bool   `json:"reduceOnly"`
+	CloseOnTrigger bool   `json:"closeOnTrigger"`
+	UpdatedTime    string `json:"updatedTime"`
+}
+
+func (o *orderResult) toOrder() market.Order {
+	return market.Order{
+		OrderID:        o.OrderID,
+		OrderLinkID:    o.OrderLinkID,
+		Symbol:         o.Symbol,
+		Side:           o.Side,
+		OrderType:      o.OrderType,
+		Price:          parseFloat(o.Price),
+		Qty:            parseFloat(o.Qty),
+		TimeInForce:    o.TimeInForce,
+		CreateType:     o.CreateType,
+		CancelType:     o.CancelType,
+		OrderStatus:    o.OrderStatus,
+		LeavesQty:      parseFloat(o.LeavesQty),
+		CumExecQty:     parseFloat(o.CumExecQty),
+		CumExecValue:   parseFloat(o.CumExecValue),
+		CumExecFee:     parseFloat(o.CumExecFee),
+		Timestamp:      parseMillis(o.UpdatedTime),
+		TakeProfit:     parseFloat(o.TakeProfit),
+		StopLoss:       parseFloat(o.StopLoss),
+		LastExecPrice:  parseFloat(o.AvgPrice),
+		ReduceOnly:     o.ReduceOnly,
+		CloseOnTrigger: o.CloseOnTrigger,
+	}
+}
+
+// GetOpenOrders fetches the open orders of a category, optionally for one symbol
+func (c *Client) GetOpenOrders(ctx context.Context, category market.Category, symbol string) ([]market.Order, error) {
+	return c.getOrders(ctx, "/v5/order/realtime", category, symbol, 0)
+}
+
+// GetOrderHistory fetches up to limit recent orders of a category
+func (c *Client) GetOrderHistory(ctx context.Context, category market.Category, symbol string, limit int) ([]market.Order, error) {
+	return c.getOrders(ctx, "/v5/order/history", category, symbol, limit)
+}
+
+func (c *Client) getOrders(ctx context.Context, path string, category market.Category, symbol string, limit int) ([]market.Order, error) {
+	query := url.Values{}
+	query.Set("category", string(category))
+	if symbol != "" {
+		query.Set("symbol", symbol)
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	var result struct {
+		List []orderResult `json:"list"`
+	}
+	if err := c.Get(ctx, path, query, true, &result); err != nil {
+		return nil, err
+	}
+
+	orders := make([]market.Order, 0, len(result.List))
+	for i := range result.List {
+		orders = append(orders, result.List[i].toOrder())
+	}
+	return orders, nil
+}
+
+// GetExecutions fetches up to limit recent executions of a category
+func (c *Client) GetExecutions(ctx context.Context, category market.Category, symbol string, limit int) ([]exucution.Execution, error) {
+	query := url.Values{}
+	query.Set("category", string(category))
+	if symbol != "" {
+		query.Set("symbol", symbol)
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	var result struct {
+		List []struct {
+			Symbol      string `json:"symbol"`
+			Side        string `json:"side"`
+			OrderID     string `json:"orderId"`
+			OrderLinkID string `json:"orderLinkId"`
+			ExecID      string `json:"execId"`
+			ExecPrice   string `json:"execPrice"`
+			OrderQty    string `json:"orderQty"`
+			ExecType    string `json:"execType"`
+			ExecQty     string `json:"execQty"`
+			ExecFee     string `json:"execFee"`
+			LeavesQty   string `json:"leavesQty"`
+			IsMaker     bool   `json:"isMaker"`
+			ExecTime    string `json:"execTime"`
+		} `json:"list"`
+	}
+	if err := c.Get(ctx, "/v5/execution/list", query, true, &result); err != nil {
+		return nil, err
+	}
+
+	executions := make([]exucution.Execution, 0, len(result.List))
+	for _, e := range result.List {
+		executions = append(executions, exucution.Execution{
+			Symbol:      e.Symbol,
+			Side:        e.Side,
+			OrderID:     e.OrderID,
+			ExecID:      e.ExecID,
+			OredrLinkID: e.OrderLinkID,
+			Price:       parseFloat(e.ExecPrice),
+			OrderQty:    parseFloat(e.OrderQty),
+			ExecType:    e.ExecType,
+			ExecQty:     parseFloat(e.ExecQty),
+			ExecFee:     parseFloat(e.ExecFee),
+			LeavesQty:   parseFloat(e.LeavesQty),
+			IsMaker:     e.IsMaker,
+			TradeTime:   parseMillis(e.ExecTime),
+		})
+	}
+	return executions, nil
+}
@@ -0,0 +1,70 @@
+package rest
+
+import (
+	"bybit_connector/pkg/exucution"
+	"bybit_connector/pkg/market"
+	"context"
+	"net/url"
+)
+
+// Position endpoints (/v5/position/*)
+
+// GetPositions fetches the open positions of a category, optionally for one symbol
+func (c *Client) GetPositions(ctx context.Context, category market.Category, symbol string) ([]exucution.Position, error) {
+	query := url.Values{}
+	query.Set("category", string(category))
+	if symbol != "" {
+		query.Set("symbol", symbol)
+	}
+
+	var result struct {
+		List []struct {
+			Symbol         string `json:"symbol"`
+			Side           string `json:"side"`
+			Size           string `json:"size"`
+			AvgPrice       string `json:"avgPrice"`
+			PositionValue  string `json:"positionValue"`
+			Leverage       string `json:"leverage"`
+			LiqPrice       string `json:"liqPrice"`
+			BustPrice      string `json:"bustPrice"`
+			PositionIM     string `json:"positionIM"`
+			TakeProfit     string `json:"takeProfit"`
+			StopLoss       string `json:"stopLoss"`
+			TrailingStop   string `json:"trailingStop"`
+			CurRealisedPnl string `json:"curRealisedPnl"`
+			CumRealisedPnl string `json:"cumRealisedPnl"`
+			PositionStatus string `json:"positionStatus"`
+			RiskID         int    `json:"riskId"`
+			AutoAddMargin  int    `json:"autoAddMargin"`
+			Seq            int64  `json:"seq"`
+		} `json:"list"`
+	}
+	if err := c.Get(ctx, "/v5/position/list", query, true, &result); err != nil {
+		return nil, err
+	}
+
+	positions := make([]exucution.Position, 0, len(result.List))
+	for _, p := range result.List {
+		positions = append(positions, exucution.Position{
+			Symbol:         p.Symbol,
+			Side:           p.Side,
+			Size:           parseFloat(p.Size),
+			EntryPrice:     parseFloat(p.AvgPrice),
+			PositionValue:  parseFloat(p.PositionValue),
+			Leverage:       parseFloat(p.Leverage),
+			LiqPrice:       parseFloat(p.LiqPrice),
+			BustPrice:      parseFloat(p.BustPrice),
+			PositionMargin: parseFloat(p.PositionIM),
+			TakeProfit:     parseFloat(p.TakeProfit),
+			StopLoss:       parseFloat(p.StopLoss),
+			TrailingStop:   parseFloat(p.TrailingStop),
+			RealisedPnl:    parseFloat(p.CurRealisedPnl),
+			CumRealisedPnl: parseFloat(p.CumRealisedPnl),
+			PositionStatus: p.PositionStatus,
+			RiskID:         p.RiskID,
+			AutoAddMargin:  p.AutoAddMargin,
+			PositionSeq:    p.Seq,
+		})
+	}
+	return positions, nil
+}
@@ -0,0 +1,428 @@
+package rest
+
+import (
+	"bybit_connector/pkg/market"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Order placement, amendment and cancellation (/v5/order/*)
+
+const (
+	SideBuy  = "Buy"
+	SideSell = "Sell"
+
+	OrderTypeLimit  = "Limit"
+	OrderTypeMarket = "Market"
+
+	TimeInForceGTC      = "GTC"
+	TimeInForceIOC      = "IOC"
+	TimeInForceFOK      = "FOK"
+	TimeInForcePostOnly = "PostOnly"
+
+	// maxBatchSize is the largest batch Bybit accepts for derivatives and
+	// options; spot batches are limited to maxSpotBatchSize
+	maxBatchSize     = 20
+	maxSpotBatchSize = 10
+)
+
+// ErrInvalidOrder is wrapped by the errors of requests rejected by their
+// validation, before reaching the exchange
+var ErrInvalidOrder = errors.New("invalid order")
+
+// Decimal is a number sent to Bybit as a decimal string, never in exponent form
+type Decimal float64
+
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(strconv.FormatFloat(float64(d), 'f', -1, 64))), nil
+}
+
+// CreateOrderRequest is a new order. Either Qty is in base coin or, for
+// spot market orders with MarketUnit "quoteCoin", in quote coin.
+type CreateOrderRequest struct {
+	Category       market.Category `json:"category"`
+	Symbol         string          `json:"symbol"`
+	Side           string          `json:"side"`
+	OrderType      string          `json:"orderType"`
+	Qty            Decimal         `json:"qty"`
+	Price          Decimal         `json:"price,omitempty"`
+	TimeInForce    string          `json:"timeInForce,omitempty"`
+	OrderLinkID    string          `json:"orderLinkId,omitempty"`
+	MarketUnit     string          `json:"marketUnit,omitempty"`
+	PositionIdx    int             `json:"positionIdx,omitempty"`
+	ReduceOnly     bool            `json:"reduceOnly,omitempty"`
+	CloseOnTrigger bool            `json:"closeOnTrigger,omitempty"`
+	TriggerPrice   Decimal         `json:"triggerPrice,omitempty"`
+	TakeProfit     Decimal         `json:"takeProfit,omitempty"`
+	StopLoss       Decimal         `json:"stopLoss,omitempty"`
+	TpTriggerBy    string          `json:"tpTriggerBy,omitempty"`
+	SlTriggerBy    string          `json:"slTriggerBy,omitempty"`
+}
+
+// Validate checks the request on its own, without instrument rules
+func (r *CreateOrderRequest) Validate() error {
+	if _, err := market.ParseCategory(string(r.Category)); err != nil {
+		return err
+	}
+	if r.Symbol == "" {
+		return fmt.Errorf("symbol is required")
+	}
+	if r.Side != SideBuy && r.Side != SideSell {
+		return fmt.Errorf("%s: invalid side %q", r.Symbol, r.Side)
+	}
+	if r.Qty <= 0 {
+		return fmt.Errorf("%s: qty must be positive", r.Symbol)
+	}
+	switch r.OrderType {
+	case OrderTypeLimit:
+		if r.Price <= 0 {
+			return fmt.Errorf("%s: limit orders require a price", r.Symbol)
+		}
+	case OrderTypeMarket:
+		if r.TimeInForce == TimeInForcePostOnly {
+			return fmt.Errorf("%s: market orders cannot be post-only", r.Symbol)
+		}
+	default:
+		return fmt.Errorf("%s: invalid order type %q", r.Symbol, r.OrderType)
+	}
+	switch r.TimeInForce {
+	case "", TimeInForceGTC, TimeInForceIOC, TimeInForceFOK, TimeInForcePostOnly:
+	default:
+		return fmt.Errorf("%s: invalid time in force %q", r.Symbol, r.TimeInForce)
+	}
+	if r.ReduceOnly && r.Category == market.CategorySpot {
+		return fmt.Errorf("%s: reduce-only is not supported for spot", r.Symbol)
+	}
+	if len(r.OrderLinkID) > 36 {
+		return fmt.Errorf("%s: orderLinkId is longer than 36 characters", r.Symbol)
+	}
+	if r.Price > 0 && r.Side == SideBuy {
+		if r.TakeProfit > 0 && r.TakeProfit <= r.Price || r.StopLoss > 0 && r.StopLoss >= r.Price {
+			return fmt.Errorf("%s: take profit must be above and stop loss below a buy price", r.Symbol)
+		}
+	}
+	if r.Price > 0 && r.Side == SideSell {
+		if r.TakeProfit > 0 && r.TakeProfit >= r.Price || r.StopLoss > 0 && r.StopLoss <= r.Price {
+			return fmt.Errorf("%s: take profit must be below and stop loss above a sell price", r.Symbol)
+		}
+	}
+	return nil
+}
+
+// ValidateInstrument checks the request against the trading rules of its symbol
+func (r *CreateOrderRequest) ValidateInstrument(inst market.Instrument) error {
+	if inst.Status != "" && inst.Status != market.InstrumentStatusTrading {
+		return fmt.Errorf("%s: instrument is not trading (%s)", r.Symbol, inst.Status)
+	}
+	quoteQty := r.MarketUnit == "quoteCoin"
+	if !quoteQty {
+		if err := inst.CheckQty(float64(r.Qty)); err != nil {
+			return err
+		}
+	}
+	for _, price := range []Decimal{r.Price, r.TriggerPrice, r.TakeProfit, r.StopLoss} {
+		if price == 0 {
+			continue
+		}
+		if err := inst.CheckPrice(float64(price)); err != nil {
+			return err
+		}
+	}
+	if r.Price > 0 && !quoteQty {
+		return inst.CheckNotional(float64(r.Price), float64(r.Qty))
+	}
+	return nil
+}
+
+// Order maps an accepted request to an order with the IDs assigned by the
+// exchange. It is shared by the REST and WebSocket order entry.
+func (r *CreateOrderRequest) Order(orderID, orderLinkID string) market.Order {
+	return market.Order{
+		OrderID:        orderID,
+		OrderLinkID:    orderLinkID,
+		Symbol:         r.Symbol,
+		Side:           r.Side,
+		OrderType:      r.OrderType,
+		Price:          float64(r.Price),
+		Qty:            float64(r.Qty),
+		TimeInForce:    r.TimeInForce,
+		OrderStatus:    "Created",
+		LeavesQty:      float64(r.Qty),
+		TakeProfit:     float64(r.TakeProfit),
+		StopLoss:       float64(r.StopLoss),
+		ReduceOnly:     r.ReduceOnly,
+		CloseOnTrigger: r.CloseOnTrigger,
+	}
+}
+
+// AmendOrderRequest changes an open order identified by OrderID or OrderLinkID
+type AmendOrderRequest struct {
+	Category     market.Category `json:"category"`
+	Symbol       string          `json:"symbol"`
+	OrderID      string          `json:"orderId,omitempty"`
+	OrderLinkID  string          `json:"orderLinkId,omitempty"`
+	Qty          Decimal         `json:"qty,omitempty"`
+	Price        Decimal         `json:"price,omitempty"`
+	TriggerPrice Decimal         `json:"triggerPrice,omitempty"`
+	TakeProfit   Decimal         `json:"takeProfit,omitempty"`
+	StopLoss     Decimal         `json:"stopLoss,omitempty"`
+}
+
+// Validate checks the request on its own, without instrument rules
+func (r *AmendOrderRequest) Validate() error {
+	if err := validateOrderRef(r.Category, r.Symbol, r.OrderID, r.OrderLinkID); err != nil {
+		return err
+	}
+	if r.Qty == 0 && r.Price == 0 && r.TriggerPrice == 0 && r.TakeProfit == 0 && r.StopLoss == 0 {
+		return fmt.Errorf("%s: nothing to amend", r.Symbol)
+	}
+	return nil
+}
+
+// ValidateInstrument checks the request against the trading rules of its symbol
+func (r *AmendOrderRequest) ValidateInstrument(inst market.Instrument) error {
+	if r.Qty != 0 {
+		if err := inst.CheckQty(float64(r.Qty)); err != nil {
+			return err
+		}
+	}
+	for _, price := range []Decimal{r.Price, r.TriggerPrice, r.TakeProfit, r.StopLoss} {
+		if price == 0 {
+			continue
+		}
+		if err := inst.CheckPrice(float64(price)); err != nil {
+			return err
+		}
+	}
+	if r.Price > 0 && r.Qty > 0 {
+		return inst.CheckNotional(float64(r.Price), float64(r.Qty))
+	}
+	return nil
+}
+
+// Order maps an accepted amendment to an order carrying the IDs and the
+// amended fields
+func (r *AmendOrderRequest) Order(orderID, orderLinkID string) market.Order {
+	return market.Order{
+		OrderID:     orderID,
+		OrderLinkID: orderLinkID,
+		Symbol:      r.Symbol,
+		Price:       float64(r.Price),
+		Qty:         float64(r.Qty),
+		TakeProfit:  float64(r.TakeProfit),
+		StopLoss:    float64(r.StopLoss),
+	}
+}
+
+// CancelOrderRequest cancels an open order identified by OrderID or OrderLinkID
+type CancelOrderRequest struct {
+	Category    market.Category `json:"category"`
+	Symbol      string          `json:"symbol"`
+	OrderID     string          `json:"orderId,omitempty"`
+	OrderLinkID string          `json:"orderLinkId,omitempty"`
+}
+
+// Validate checks the request
+func (r *CancelOrderRequest) Validate() error {
+	return validateOrderRef(r.Category, r.Symbol, r.OrderID, r.OrderLinkID)
+}
+
+// CancelAllRequest cancels every open order matching the filter. Linear
+// and inverse require one of Symbol, BaseCoin or SettleCoin.
+type CancelAllRequest struct {
+	Category   market.Category `json:"category"`
+	Symbol     string          `json:"symbol,omitempty"`
+	BaseCoin   string          `json:"baseCoin,omitempty"`
+	SettleCoin string          `json:"settleCoin,omitempty"`
+}
+
+// orderRef is the result of the order endpoints that only echo the IDs
+type orderRef struct {
+	OrderID     string `json:"orderId"`
+	OrderLinkID string `json:"orderLinkId"`
+}
+
+// CreateOrder validates and places an order. The returned order carries
+// the request's fields and the IDs assigned by the exchange.
+func (c *Client) CreateOrder(ctx context.Context, req CreateOrderRequest) (market.Order, error) {
+	if err := c.validateCreate(&req); err != nil {
+		return market.Order{}, err
+	}
+
+	var result orderRef
+	if err := c.Post(ctx, "/v5/order/create", req, &result); err != nil {
+		return market.Order{}, err
+	}
+	return req.Order(result.OrderID, result.OrderLinkID), nil
+}
+
+// AmendOrder validates and amends an open order. The returned order only
+// carries the IDs and the amended fields.
+func (c *Client) AmendOrder(ctx context.Context, req AmendOrderRequest) (market.Order, error) {
+	if err := req.Validate(); err != nil {
+		return market.Order{}, invalidOrder(err)
+	}
+	if inst, err := c.instrument(req.Category, req.Symbol); err != nil {
+		return market.Order{}, invalidOrder(err)
+	} else if inst != nil {
+		if err := req.ValidateInstrument(*inst); err != nil {
+			return market.Order{}, invalidOrder(err)
+		}
+	}
+
+	var result orderRef
+	if err := c.Post(ctx, "/v5/order/amend", req, &result); err != nil {
+		return market.Order{}, err
+	}
+	return req.Order(result.OrderID, result.OrderLinkID), nil
+}
+
+// CancelOrder cancels an open order. The returned order only carries the IDs;
+// its final status arrives on the order stream or from GetOrderHistory.
+func (c *Client) CancelOrder(ctx context.Context, req CancelOrderRequest) (market.Order, error) {
+	if err := req.Validate(); err != nil {
+		return market.Order{}, invalidOrder(err)
+	}
+
+	var result orderRef
+	if err := c.Post(ctx, "/v5/order/cancel", req, &result); err != nil {
+		return market.Order{}, err
+	}
+	return market.Order{OrderID: result.OrderID, OrderLinkID: result.OrderLinkID, Symbol: req.Symbol}, nil
+}
+
+// CancelAll cancels every open order matching the request and returns their IDs
+func (c *Client) CancelAll(ctx context.Context, req CancelAllRequest) ([]market.Order, error) {
+	if _, err := market.ParseCategory(string(req.Category)); err != nil {
+		return nil, err
+	}
+	if (req.Category == market.CategoryLinear || req.Category == market.CategoryInverse) &&
+		req.Symbol == "" && req.BaseCoin == "" && req.SettleCoin == "" {
+		return nil, fmt.Errorf("%s: symbol, baseCoin or settleCoin is required", req.Category)
+	}
+
+	var result struct {
+		List []orderRef `json:"list"`
+	}
+	if err := c.Post(ctx, "/v5/order/cancel-all", req, &result); err != nil {
+		return nil, err
+	}
+	orders := make([]market.Order, 0, len(result.List))
+	for _, ref := range result.List {
+		orders = append(orders, market.Order{OrderID: ref.OrderID, OrderLinkID: ref.OrderLinkID, Symbol: req.Symbol})
+	}
+	return orders, nil
+}
+
+// BatchResult is the outcome of one order of a batch
+type BatchResult struct {
+	Order market.Order
+	Err   error
+}
+
+// BatchCreate validates and places several orders of one category in a
+// single request. The whole batch is rejected if any order fails
+// validation; otherwise each result carries the exchange's verdict.
+func (c *Client) BatchCreate(ctx context.Context, category market.Category, reqs []CreateOrderRequest) ([]BatchResult, error) {
+	limit := maxBatchSize
+	if category == market.CategorySpot {
+		limit = maxSpotBatchSize
+	}
+	if len(reqs) == 0 || len(reqs) > limit {
+		return nil, fmt.Errorf("batch size must be between 1 and %d, got %d", limit, len(reqs))
+	}
+	for i := range reqs {
+		if reqs[i].Category == "" {
+			reqs[i].Category = category
+		}
+		if reqs[i].Category != category {
+			return nil, fmt.Errorf("order %d: category %s does not match batch category %s", i, reqs[i].Category, category)
+		}
+		if err := c.validateCreate(&reqs[i]); err != nil {
+			return nil, fmt.Errorf("order %d: %w", i, err)
+		}
+	}
+
+	body := struct {
+		Category market.Category      `json:"category"`
+		Request  []CreateOrderRequest `json:"request"`
+	}{category, reqs}
+
+	var result struct {
+		List []orderRef `json:"list"`
+	}
+	var ext struct {
+		List []struct {
+			Code int    `json:"code"`
+			Msg  string `json:"msg"`
+		} `json:"list"`
+	}
+	if err := c.post(ctx, "/v5/order/create-batch", body, &result, &ext); err != nil {
+		return nil, err
+	}
+
+	results := make([]BatchResult, len(reqs))
+	for i := range reqs {
+		if i < len(ext.List) && ext.List[i].Code != 0 {
+			results[i].Err = &APIError{Code: ext.List[i].Code, Message: ext.List[i].Msg, Method: "POST", Path: "/v5/order/create-batch"}
+			continue
+		}
+		var ref orderRef
+		if i < len(result.List) {
+			ref = result.List[i]
+		}
+		results[i].Order = reqs[i].Order(ref.OrderID, ref.OrderLinkID)
+	}
+	return results, nil
+}
+
+// validateCreate runs the static and instrument checks of a new order
+func (c *Client) validateCreate(req *CreateOrderRequest) error {
+	if err := req.Validate(); err != nil {
+		return invalidOrder(err)
+	}
+	inst, err := c.instrument(req.Category, req.Symbol)
+	if err != nil {
+		return invalidOrder(err)
+	}
+	if inst == nil {
+		return nil
+	}
+	if err := req.ValidateInstrument(*inst); err != nil {
+		return invalidOrder(err)
+	}
+	return nil
+}
+
+// invalidOrder marks err as a validation error
+func invalidOrder(err error) error {
+	return fmt.Errorf("%w: %w", ErrInvalidOrder, err)
+}
+
+// instrument returns the trading rules of a symbol, or nil when the client
+// has no instrument source
+func (c *Client) instrument(category market.Category, symbol string) (*market.Instrument, error) {
+	if c.Instruments == nil {
+		return nil, nil
+	}
+	inst, ok := c.Instruments.Instrument(category, symbol)
+	if !ok {
+		return nil, fmt.Errorf("%s: unknown %s instrument", symbol, category)
+	}
+	return &inst, nil
+}
+
+func validateOrderRef(category market.Category, symbol, orderID, orderLinkID string) error {
+	if _, err := market.ParseCategory(string(category)); err != nil {
+		return err
+	}
+	if symbol == "" {
+		return fmt.Errorf("symbol is required")
+	}
+	if orderID == "" && orderLinkID == "" {
+		return fmt.Errorf("%s: orderId or orderLinkId is required", symbol)
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package rest
+
+import (
+	"bybit_connector/pkg/market"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+)
+
+type staticInstruments map[string]market.Instrument
+
+func (s staticInstruments) Instrument(category market.Category, symbol string) (market.Instrument, bool) {
+	inst, ok := s[symbol]
+	return inst, ok && inst.Category == category
+}
+
+var testInstruments = staticInstruments{
+	"BTCUSDT": {
+		Symbol: "BTCUSDT", Category: market.CategoryLinear, Status: market.InstrumentStatusTrading,
+		TickSize: 0.1, QtyStep: 0.001, MinQty: 0.001, MaxQty: 100, MinNotional: 5,
+	},
+}
+
+func TestCreateOrder(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if body["qty"] != "0.002" || body["price"] != "30000.1" || body["orderLinkId"] != "link-1" {
+			t.Errorf("unexpected body: %v", body)
+		}
+		if _, ok := body["takeProfit"]; ok {
+			t.Errorf("unset fields must be omitted: %v", body)
+		}
+		io.WriteString(w, `{"retCode":0,"retMsg":"OK","result":{"orderId":"abc","orderLinkId":"link-1"}}`)
+	})
+	c.Instruments = testInstruments
+
+	order, err := c.CreateOrder(context.Background(), CreateOrderRequest{
+		Category:    market.CategoryLinear,
+		Symbol:      "BTCUSDT",
+		Side:        SideBuy,
+		OrderType:   OrderTypeLimit,
+		Qty:         0.002,
+		Price:       30000.1,
+		TimeInForce: TimeInForcePostOnly,
+		OrderLinkID: "link-1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.OrderID != "abc" || order.Qty != 0.002 || order.Price != 30000.1 || order.OrderStatus != "Created" {
+		t.Fatalf("unexpected order: %+v", order)
+	}
+}
+
+func TestCreateOrderValidation(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("invalid orders must not be sent")
+	})
+	c.Instruments = testInstruments
+
+	valid := CreateOrderRequest{
+		Category: market.CategoryLinear, Symbol: "BTCUSDT", Side: SideBuy,
+		OrderType: OrderTypeLimit, Qty: 0.01, Price: 30000,
+	}
+	cases := map[string]func(r *CreateOrderRequest){
+		"price off tick":     func(r *CreateOrderRequest) { r.Price = 30000.05 },
+		"qty off step":       func(r *CreateOrderRequest) { r.Qty = 0.0015 },
+		"below notional":     func(r *CreateOrderRequest) { r.Price = 100; r.Qty = 0.01 },
+		"missing price":      func(r *CreateOrderRequest) { r.Price = 0 },
+		"bad side":           func(r *CreateOrderRequest) { r.Side = "buy" },
+		"unknown symbol":     func(r *CreateOrderRequest) { r.Symbol = "ETHUSDT" },
+		"spot reduce-only":   func(r *CreateOrderRequest) { r.Category = market.CategorySpot; r.ReduceOnly = true },
+		"stop loss above":    func(r *CreateOrderRequest) { r.StopLoss = 31000 },
+		"post-only market":   func(r *CreateOrderRequest) { r.OrderType = OrderTypeMarket; r.TimeInForce = TimeInForcePostOnly },
+		"invalid time force": func(r *CreateOrderRequest) { r.TimeInForce = "GTD" },
+	}
+	for name, mutate := range cases {
+		req := valid
+		mutate(&req)
+		if _, err := c.CreateOrder(context.Background(), req); !errors.Is(err, ErrInvalidOrder) {
+			t.Errorf("%s: expected a validation error, got %v", name, err)
+		}
+	}
+}
+
+func TestBatchCreate(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v5/order/create-batch" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		io.WriteString(w, `{"retCode":0,"retMsg":"OK","result":{"list":[{"orderId":"1","orderLinkId":""},{"orderId":"","orderLinkId":""}]},`+
+			`"retExtInfo":{"list":[{"code":0,"msg":"OK"},{"code":110007,"msg":"insufficient balance"}]}}`)
+	})
+
+	order := CreateOrderRequest{Symbol: "BTCUSDT", Side: SideSell, OrderType: OrderTypeMarket, Qty: 1}
+	results, err := c.BatchCreate(context.Background(), market.CategoryLinear, []CreateOrderRequest{order, order})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Err != nil || results[0].Order.OrderID != "1" {
+		t.Fatalf("unexpected first result: %+v", results[0])
+	}
+	var apiErr *APIError
+	if !errors.As(results[1].Err, &apiErr) || apiErr.Code != 110007 {
+		t.Fatalf("unexpected second result: %+v", results[1])
+	}
+}
+
+func TestCancelRequiresOrderRef(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("invalid cancels must not be sent")
+	})
+	if _, err := c.CancelOrder(context.Background(), CancelOrderRequest{Category: market.CategoryLinear, Symbol: "BTCUSDT"}); err == nil {
+		t.Fatal("expected an error without order id")
+	}
+	if _, err := c.CancelAll(context.Background(), CancelAllRequest{Category: market.CategoryLinear}); err == nil {
+		t.Fatal("expected an error without a filter")
+	}
+}
+
+func TestDecimalMarshal(t *testing.T) {
+	b, _ := json.Marshal(Decimal(0.00000001))
+	if string(b) != `"0.00000001"` {
+		t.Fatalf("unexpected decimal encoding: %s", b)
+	}
+}
+
+func TestGetInstrumentsPaginates(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("cursor") == "" {
+			io.WriteString(w, `{"retCode":0,"retMsg":"OK","result":{"list":[{"symbol":"BTCUSDT","status":"Trading",`+
+				`"priceFilter":{"tickSize":"0.10"},"lotSizeFilter":{"qtyStep":"0.001","minOrderQty":"0.001","minNotionalValue":"5"}}],"nextPageCursor":"next"}}`)
+			return
+		}
+		io.WriteString(w, `{"retCode":0,"retMsg":"OK","result":{"list":[{"symbol":"ETHUSDT","status":"Settling",`+
+			`"priceFilter":{"tickSize":"0.01"},"lotSizeFilter":{"qtyStep":"0.01"}}],"nextPageCursor":""}}`)
+	})
+
+	instruments, err := c.GetInstruments(context.Background(), market.CategoryLinear)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(instruments) != 2 || instruments[0].TickSize != 0.1 || instruments[0].MinNotional != 5 || instruments[1].Status != "Settling" {
+		t.Fatalf("unexpected instruments: %+v", instruments)
+	}
+
+	registry := market.NewInstrumentRegistry(c.GetInstruments, market.CategoryLinear)
+	if err := registry.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	c.Instruments = registry
+	if _, ok := c.Instruments.Instrument(market.CategoryLinear, "ETHUSDT"); !ok {
+		t.Fatal("expected the registry to serve loaded instruments")
+	}
+}